@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,6 +9,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/jobs"
+	"github.com/omega/notes-app/internal/middleware"
 	"github.com/omega/notes-app/internal/routes"
 )
 
@@ -23,15 +26,22 @@ func main() {
 		log.Fatalf("Ошибка при подключении к базе данных: %v", err)
 	}
 
-	// Создаем экземпляр Gin
-	router := gin.Default()
+	// Запускаем фоновые задачи
+	jobs.StartTrashPurge(context.Background(), database.GetDB())
+	jobs.StartPositionRebalance(context.Background(), database.GetDB())
+	jobs.StartBurnNotePurge(context.Background(), database.GetDB())
+
+	// Создаем экземпляр Gin. Токен WebSocket убирается из адреса до журнала запросов.
+	router := gin.New()
+	router.Use(middleware.SocketTokenFromQuery(), gin.Logger(), gin.Recovery())
 
 	// Настраиваем CORS
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, If-Match, If-None-Match, X-Link-Password, X-Workspace-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -55,4 +65,4 @@ func main() {
 	if err := router.Run(fmt.Sprintf(":%s", port)); err != nil {
 		log.Fatalf("Ошибка при запуске сервера: %v", err)
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Области доступа (scopes), которые может запросить стороннее приложение
+const (
+	ScopeProfile    = "profile"
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+)
+
+// SupportedScopes — все поддерживаемые области доступа
+var SupportedScopes = []string{ScopeProfile, ScopeNotesRead, ScopeNotesWrite}
+
+// Префиксы непрозрачных токенов OAuth2 позволяют отличить их от JWT первой стороны
+const (
+	AccessTokenPrefix  = "oat_"
+	RefreshTokenPrefix = "ort_"
+	ClientSecretPrefix = "ocs_"
+)
+
+// Время жизни кодов авторизации и токенов OAuth2
+const (
+	AuthorizationCodeTTL = 10 * time.Minute
+	AccessTokenTTL       = time.Hour
+	RefreshTokenTTL      = 30 * 24 * time.Hour
+)
+
+// PKCEMethodS256 — единственный поддерживаемый метод PKCE (RFC 7636)
+const PKCEMethodS256 = "S256"
+
+// GenerateOpaqueToken создает случайный токен с префиксом и возвращает его вместе с хешем.
+// В базе данных хранится только хеш, сам токен показывается клиенту один раз.
+func GenerateOpaqueToken(prefix string) (string, string, error) {
+	random, err := GenerateRandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := prefix + random
+	return token, HashToken(token), nil
+}
+
+// HashToken возвращает SHA-256 хеш токена в шестнадцатеричном виде.
+// Токены содержат 256 бит случайности, поэтому медленное хеширование не требуется.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAccessToken сообщает, является ли строка токеном доступа OAuth2
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// ParseScopes разбирает список областей доступа, разделенных пробелами,
+// и проверяет, что каждая из них поддерживается
+func ParseScopes(scope string) ([]string, error) {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if !containsScope(SupportedScopes, s) {
+			return nil, fmt.Errorf("неизвестная область доступа %q", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// ScopesSubset проверяет, что все запрошенные области входят в разрешенные
+func ScopesSubset(requested, allowed []string) bool {
+	for _, s := range requested {
+		if !containsScope(allowed, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasScope сообщает, содержится ли область доступа в списке
+func HasScope(scopes []string, scope string) bool {
+	return containsScope(scopes, scope)
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyPKCE проверяет code_verifier против сохраненного code_challenge (метод S256)
+func VerifyPKCE(verifier, challenge string) bool {
+	// RFC 7636: code_verifier содержит от 43 до 128 символов
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// ValidateRedirectURI проверяет адрес перенаправления приложения (RFC 8252): https,
+// http только на loopback-адрес для нативных приложений или собственная схема
+// приложения из списка OAUTH_REDIRECT_SCHEMES. Фрагмент и данные пользователя запрещены.
+func ValidateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return errors.New("redirect_uri должен быть абсолютным URL")
+	}
+	if u.Fragment != "" || u.User != nil {
+		return errors.New("redirect_uri не должен содержать фрагмент и данные пользователя")
+	}
+
+	switch scheme := strings.ToLower(u.Scheme); scheme {
+	case "https":
+		if u.Host == "" {
+			return errors.New("в redirect_uri не указан хост")
+		}
+		return nil
+	case "http":
+		if !isLoopbackHost(u.Hostname()) {
+			return errors.New("http допускается в redirect_uri только для loopback-адресов")
+		}
+		return nil
+	default:
+		for _, allowed := range strings.Split(os.Getenv("OAUTH_REDIRECT_SCHEMES"), ",") {
+			if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(allowed, scheme) {
+				return nil
+			}
+		}
+		return fmt.Errorf("схема %s не разрешена для redirect_uri", u.Scheme)
+	}
+}
+
+// isLoopbackHost сообщает, указывает ли хост на локальную машину
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
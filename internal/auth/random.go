@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// GenerateRandomString возвращает криптографически стойкую случайную строку
+// из n случайных байт в URL-безопасной base64-кодировке
+func GenerateRandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+)
+
+// ErrSAMLNotConfigured возвращается, если SAML SSO не настроен в переменных окружения
+var ErrSAMLNotConfigured = errors.New("SAML SSO не настроен")
+
+// Пути SAML-эндпоинтов относительно SAML_ROOT_URL
+const (
+	SAMLMetadataPath = "/api/auth/saml/metadata"
+	SAMLACSPath      = "/api/auth/saml/acs"
+)
+
+// Атрибуты, в которых IdP обычно передает email и имя пользователя
+var (
+	samlEmailAttributes = []string{
+		"email",
+		"mail",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+	}
+	samlUsernameAttributes = []string{
+		"username",
+		"uid",
+		"urn:oid:0.9.2342.19200300.100.1.1",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+	}
+)
+
+// SAMLConfig содержит настройки поставщика услуг (SP)
+type SAMLConfig struct {
+	RootURL           string
+	EntityID          string
+	KeyPair           tls.Certificate
+	IDPMetadata       *saml.EntityDescriptor
+	AllowIDPInitiated bool
+}
+
+// SAMLIdentity представляет данные пользователя, извлеченные из утверждения IdP
+type SAMLIdentity struct {
+	NameID   string
+	Email    string
+	Username string
+}
+
+var (
+	samlOnce sync.Once
+	samlSP   *saml.ServiceProvider
+	samlErr  error
+)
+
+// GetServiceProvider возвращает SAML SP, настроенный из переменных окружения.
+// Метаданные IdP загружаются один раз при первом обращении.
+func GetServiceProvider() (*saml.ServiceProvider, error) {
+	samlOnce.Do(func() {
+		var cfg *SAMLConfig
+		cfg, samlErr = LoadSAMLConfig()
+		if samlErr != nil {
+			return
+		}
+		samlSP, samlErr = NewServiceProvider(cfg)
+	})
+	return samlSP, samlErr
+}
+
+// LoadSAMLConfig читает настройки SAML из переменных окружения
+func LoadSAMLConfig() (*SAMLConfig, error) {
+	rootURL := os.Getenv("SAML_ROOT_URL")
+	metadataURL := os.Getenv("SAML_IDP_METADATA_URL")
+	metadataFile := os.Getenv("SAML_IDP_METADATA_FILE")
+	if rootURL == "" || (metadataURL == "" && metadataFile == "") {
+		return nil, ErrSAMLNotConfigured
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(os.Getenv("SAML_SP_CERT_FILE"), os.Getenv("SAML_SP_KEY_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при загрузке сертификата SP: %w", err)
+	}
+
+	var idpMetadata *saml.EntityDescriptor
+	if metadataFile != "" {
+		data, err := os.ReadFile(metadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при чтении метаданных IdP: %w", err)
+		}
+		idpMetadata, err = samlsp.ParseMetadata(data)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при разборе метаданных IdP: %w", err)
+		}
+	} else {
+		u, err := url.Parse(metadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("неверный SAML_IDP_METADATA_URL: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		idpMetadata, err = samlsp.FetchMetadata(ctx, http.DefaultClient, *u)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при загрузке метаданных IdP: %w", err)
+		}
+	}
+
+	return &SAMLConfig{
+		RootURL:           rootURL,
+		EntityID:          os.Getenv("SAML_ENTITY_ID"),
+		KeyPair:           keyPair,
+		IDPMetadata:       idpMetadata,
+		AllowIDPInitiated: os.Getenv("SAML_ALLOW_IDP_INITIATED") == "true",
+	}, nil
+}
+
+// NewServiceProvider создает SAML SP по переданной конфигурации
+func NewServiceProvider(cfg *SAMLConfig) (*saml.ServiceProvider, error) {
+	rootURL, err := url.Parse(strings.TrimRight(cfg.RootURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("неверный SAML_ROOT_URL: %w", err)
+	}
+
+	key, ok := cfg.KeyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("ключ SP должен быть RSA-ключом")
+	}
+	cert, err := x509.ParseCertificate(cfg.KeyPair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при разборе сертификата SP: %w", err)
+	}
+
+	metadataURL := rootURL.ResolveReference(&url.URL{Path: SAMLMetadataPath})
+	acsURL := rootURL.ResolveReference(&url.URL{Path: SAMLACSPath})
+
+	entityID := cfg.EntityID
+	if entityID == "" {
+		entityID = metadataURL.String()
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          entityID,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       cfg.IDPMetadata,
+		AuthnNameIDFormat: saml.EmailAddressNameIDFormat,
+		AllowIDPInitiated: cfg.AllowIDPInitiated,
+	}, nil
+}
+
+// SignRelayState подписывает ID SAML-запроса, чтобы ACS мог проверить,
+// что ответ IdP относится к запросу, начатому этим сервером. Ненулевой linkUserID
+// означает, что запрос начат для привязки учетной записи IdP к этому пользователю;
+// подпись не защищает привязку от подброшенной ссылки, поэтому ACS дополнительно
+// сверяет одноразовую запись привязки с cookie браузера.
+func SignRelayState(requestID string, linkUserID uint) (string, error) {
+	payload := requestID
+	if linkUserID != 0 {
+		payload += ":" + strconv.FormatUint(uint64(linkUserID), 10)
+	}
+	mac, err := relayStateMAC(payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + mac, nil
+}
+
+// VerifyRelayState проверяет подпись RelayState и возвращает ID SAML-запроса
+// и пользователя, для которого начата привязка (0 для обычного входа)
+func VerifyRelayState(relayState string) (string, uint, error) {
+	payload, mac, ok := strings.Cut(relayState, ".")
+	if !ok {
+		return "", 0, errors.New("неверный формат RelayState")
+	}
+	expected, err := relayStateMAC(payload)
+	if err != nil {
+		return "", 0, err
+	}
+	if !hmac.Equal([]byte(mac), []byte(expected)) {
+		return "", 0, errors.New("неверная подпись RelayState")
+	}
+
+	requestID, user, linked := strings.Cut(payload, ":")
+	if !linked {
+		return requestID, 0, nil
+	}
+	linkUserID, err := strconv.ParseUint(user, 10, 32)
+	if err != nil {
+		return "", 0, errors.New("неверный формат RelayState")
+	}
+	return requestID, uint(linkUserID), nil
+}
+
+// SAMLLinkDomainAllowed сообщает, разрешил ли администратор автоматически привязывать
+// вход через IdP к существующим учетным записям с email в этом домене (SAML_LINK_DOMAINS)
+func SAMLLinkDomainAllowed(email string) bool {
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range strings.Split(os.Getenv("SAML_LINK_DOMAINS"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(allowed, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func relayStateMAC(requestID string) (string, error) {
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		return "", errors.New("JWT_SECRET не установлен")
+	}
+	h := hmac.New(sha256.New, []byte(jwtSecret))
+	h.Write([]byte("saml-relay-state:" + requestID))
+	// RelayState по спецификации ограничен 80 байтами, поэтому подпись укорачиваем
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// IdentityFromAssertion извлекает email и имя пользователя из проверенного утверждения
+func IdentityFromAssertion(assertion *saml.Assertion) (*SAMLIdentity, error) {
+	identity := &SAMLIdentity{}
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		identity.NameID = assertion.Subject.NameID.Value
+	}
+
+	identity.Email = samlAttribute(assertion, samlEmailAttributes)
+	if identity.Email == "" && strings.Contains(identity.NameID, "@") {
+		identity.Email = identity.NameID
+	}
+	if identity.Email == "" {
+		return nil, errors.New("утверждение IdP не содержит email пользователя")
+	}
+
+	identity.Username = samlAttribute(assertion, samlUsernameAttributes)
+	if identity.Username == "" {
+		identity.Username, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	return identity, nil
+}
+
+func samlAttribute(assertion *saml.Assertion, names []string) string {
+	for _, name := range names {
+		for _, statement := range assertion.AttributeStatements {
+			for _, attr := range statement.Attributes {
+				if !strings.EqualFold(attr.Name, name) && !strings.EqualFold(attr.FriendlyName, name) {
+					continue
+				}
+				for _, value := range attr.Values {
+					if v := strings.TrimSpace(value.Value); v != "" {
+						return v
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package burn
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+// KeySize — размер ключа AES-256 в байтах
+const KeySize = 32
+
+// ErrDecrypt возвращается для неверного ключа или поврежденного шифротекста
+var ErrDecrypt = errors.New("не удалось расшифровать заметку")
+
+// NewKey создает случайный ключ шифрования
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypt шифрует текст в режиме AES-GCM. Дополнительные данные (например, ID записи)
+// не шифруются, но привязывают шифротекст к записи: расшифровать его с другими нельзя.
+func Encrypt(key, plaintext, additional []byte) (nonce, ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, additional), nil
+}
+
+// Decrypt расшифровывает и проверяет текст, зашифрованный Encrypt
+func Decrypt(key, nonce, ciphertext, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// EncodeKey кодирует ключ для фрагмента ссылки
+func EncodeKey(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// DecodeKey разбирает ключ из фрагмента ссылки
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrDecrypt
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,519 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Параметры сессий совместного редактирования
+const (
+	// SaveDelay — задержка сохранения после правки: быстрые правки сохраняются одной записью
+	SaveDelay = 2 * time.Second
+	// MaxSaveRetryDelay — наибольшая пауза между повторами неудавшегося сохранения
+	MaxSaveRetryDelay = time.Minute
+	// MaxHistory — сколько последних операций хранит сессия; клиент, отставший сильнее,
+	// должен переподключиться
+	MaxHistory = 1000
+	// MaxMessageSize — максимальный размер сообщения клиента в байтах
+	MaxMessageSize = 1 << 20
+
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	sendBuffer = 64
+)
+
+// ErrStaleContent возвращает Store.Save, если содержимое заметки изменили в обход сессии
+// и оно больше не совпадает с тем, от которого сессия отсчитывает правки
+var ErrStaleContent = errors.New("содержимое заметки изменилось после последнего сохранения")
+
+// Store загружает и сохраняет содержимое заметок для сессий совместного редактирования.
+// Save записывает content, только если в хранилище по-прежнему base, иначе ничего
+// не меняет и возвращает ErrStaleContent вместе с текущим содержимым.
+type Store interface {
+	Load(noteID uint) (string, error)
+	Save(noteID uint, base, content string, authorID uint) (string, error)
+}
+
+// Hub управляет сессиями совместного редактирования: на каждую открытую заметку приходится
+// одна сессия, которая упорядочивает правки клиентов, преобразует одновременные операции
+// и сохраняет результат через Store
+type Hub struct {
+	store    Store
+	mu       sync.Mutex
+	sessions map[uint]*session
+}
+
+// NewHub создает Hub, сохраняющий заметки в store
+func NewHub(store Store) *Hub {
+	return &Hub{store: store, sessions: make(map[uint]*session)}
+}
+
+// session — состояние открытой заметки. Номер ревизии растет с каждой примененной
+// операцией; history[i] переводит документ из ревизии offset+i в offset+i+1.
+type session struct {
+	hub      *Hub
+	noteID   uint
+	mu       sync.Mutex
+	content  string
+	revision int
+	offset   int
+	history  []*Operation
+	clients  map[*client]struct{}
+	nextID   int
+	stop     chan struct{}
+
+	// Последнее сохраненное состояние нужно, чтобы слить правку, сделанную в обход сокета.
+	// savedContent всегда совпадает с содержимым в хранилище; savedRevision равна -1,
+	// если это содержимое не соответствует ни одной ревизии сессии.
+	savedRevision int
+	savedContent  string
+	author        uint
+	saveTimer     *time.Timer
+	saveFailures  int
+	saveMu        sync.Mutex
+}
+
+// client — подключение пользователя к сессии. presence меняется под s.mu.
+type client struct {
+	conn     *websocket.Conn
+	send     chan []byte
+	presence Presence
+	mu       sync.Mutex
+	closed   bool
+}
+
+// clientMessage — сообщение клиента
+type clientMessage struct {
+	Type     string     `json:"type"`
+	Revision int        `json:"revision"`
+	Op       *Operation `json:"op"`
+	Cursor   *Cursor    `json:"cursor"`
+}
+
+// Serve подключает пользователя к сессии заметки и обслуживает соединение до его закрытия.
+// Клиент получает {"type":"init","revision","content","presence"}, отправляет
+// {"type":"op","revision","op"} и получает подтверждения {"type":"ack","revision"}
+// и чужие операции {"type":"op",...}. Курсор передается как {"type":"cursor","revision","cursor"},
+// а о входе и выходе участников сообщают {"type":"join"} и {"type":"leave"}. Если права
+// пользователя понизились, клиент получает {"type":"access"} или соединение закрывается.
+func (h *Hub) Serve(conn *websocket.Conn, noteID, userID uint, username string, canEdit bool) {
+	now := time.Now()
+	c := &client{conn: conn, send: make(chan []byte, sendBuffer), presence: Presence{
+		UserID:   userID,
+		Username: username,
+		CanEdit:  canEdit,
+		JoinedAt: now,
+		LastSeen: now,
+	}}
+	s, err := h.join(noteID, c)
+	if err != nil {
+		log.Printf("Ошибка при открытии сессии заметки %d: %v", noteID, err)
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "ошибка при загрузке заметки"))
+		conn.Close()
+		return
+	}
+	go c.writePump()
+	defer h.leave(s, c)
+
+	conn.SetReadLimit(MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.emit(map[string]interface{}{"type": "error", "error": "неверный формат сообщения: " + err.Error()})
+			continue
+		}
+		s.receive(c, msg)
+	}
+}
+
+// ApplyExternal сливает в открытую сессию изменение содержимого, сохраненное в обход сокета,
+// например через PUT /api/notes/:id. Если изменение основано на последнем сохраненном
+// состоянии, оно преобразуется относительно правок, сделанных после сохранения,
+// иначе считается примененным к текущему документу сессии.
+func (h *Hub) ApplyExternal(noteID uint, before, after string, authorID uint) {
+	h.mu.Lock()
+	s := h.sessions[noteID]
+	h.mu.Unlock()
+	if s == nil || before == after {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Сессия уже слила это изменение, обнаружив его при сохранении
+	if after == s.savedContent {
+		return
+	}
+
+	s.merge(before, after, authorID)
+	// Изменение уже записано в хранилище: сохранять нужно только правки сессии поверх него
+	s.savedContent, s.savedRevision = after, -1
+	if s.content == after {
+		s.savedRevision = s.revision
+	}
+}
+
+// UserNotes возвращает заметки, к которым у пользователя открыты подключения
+func (h *Hub) UserNotes(userID uint) []uint {
+	h.mu.Lock()
+	sessions := make([]*session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.mu.Unlock()
+
+	var notes []uint
+	for _, s := range sessions {
+		s.mu.Lock()
+		for c := range s.clients {
+			if c.presence.UserID == userID {
+				notes = append(notes, s.noteID)
+				break
+			}
+		}
+		s.mu.Unlock()
+	}
+	return notes
+}
+
+// Restrict приводит подключения пользователя к заметке в соответствие с его правами после
+// их изменения: без права чтения подключения закрываются, а без права записи клиент получает
+// {"type":"access","can_edit":false} и больше не может отправлять правки. Права только
+// понижаются: расширенные права клиент получит, переподключившись.
+func (h *Hub) Restrict(noteID, userID uint, canView, canEdit bool) {
+	h.mu.Lock()
+	s := h.sessions[noteID]
+	h.mu.Unlock()
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		if c.presence.UserID != userID {
+			continue
+		}
+		switch {
+		case !canView:
+			// Соединение закроется, и клиент уйдет из сессии обычным путем
+			c.close()
+		case c.presence.CanEdit && !canEdit:
+			c.presence.CanEdit = false
+			c.emit(map[string]interface{}{"type": "access", "can_edit": false})
+		}
+	}
+}
+
+// merge применяет к документу изменение содержимого before → after, сделанное в обход
+// сессии. Если before — последнее сохраненное состояние, изменение преобразуется
+// относительно правок, сделанных после сохранения, иначе применяется к текущему документу.
+// Вызывается под s.mu.
+func (s *session) merge(before, after string, authorID uint) {
+	base, from := s.revision, s.content
+	if before == s.savedContent && s.savedRevision >= s.offset {
+		base, from = s.savedRevision, before
+	}
+	s.apply(nil, authorID, base, DiffWords(from, after))
+}
+
+func (h *Hub) join(noteID uint, c *client) (*session, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.sessions[noteID]
+	if s == nil {
+		content, err := h.store.Load(noteID)
+		if err != nil {
+			return nil, err
+		}
+		s = &session{
+			hub:          h,
+			noteID:       noteID,
+			content:      content,
+			savedContent: content,
+			clients:      make(map[*client]struct{}),
+			stop:         make(chan struct{}),
+		}
+		h.sessions[noteID] = s
+		go s.sweep(s.stop)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	c.presence.ClientID = s.nextID
+	s.clients[c] = struct{}{}
+	c.emit(map[string]interface{}{
+		"type":      "init",
+		"client_id": c.presence.ClientID,
+		"revision":  s.revision,
+		"content":   s.content,
+		"can_edit":  c.presence.CanEdit,
+		"presence":  s.presence(),
+	})
+	s.broadcast(c, map[string]interface{}{"type": "join", "presence": c.presence})
+	return s, nil
+}
+
+// leave отключает клиента. После ухода последнего клиента документ сохраняется, и сессия
+// закрывается, только если сохранение удалось. До этого сессия остается в Hub, поэтому
+// новое подключение получает ее содержимое, а не устаревшее из базы данных.
+func (h *Hub) leave(s *session, c *client) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	c.close()
+	s.broadcast(nil, map[string]interface{}{
+		"type":      "leave",
+		"client_id": c.presence.ClientID,
+		"user_id":   c.presence.UserID,
+	})
+	empty := len(s.clients) == 0
+	if empty && s.saveTimer != nil {
+		s.saveTimer.Stop()
+		s.saveTimer = nil
+	}
+	s.mu.Unlock()
+
+	if empty {
+		s.save()
+		h.release(s)
+	}
+}
+
+// release закрывает сессию без клиентов, если ее документ сохранен. Если сохранение
+// не удалось, оно повторяется с растущей паузой, пока не пройдет. Блокировка Hub берется
+// только здесь и ненадолго: сохранение в Store выполняется без нее.
+func (h *Hub) release(s *session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if h.sessions[s.noteID] != s || s.saveTimer != nil {
+		return
+	}
+	if s.revision != s.savedRevision {
+		delay := SaveDelay << uint(s.saveFailures)
+		if s.saveFailures > 5 || delay > MaxSaveRetryDelay {
+			delay = MaxSaveRetryDelay
+		}
+		s.saveTimer = time.AfterFunc(delay, s.flush)
+		return
+	}
+	if len(s.clients) > 0 {
+		return
+	}
+	delete(h.sessions, s.noteID)
+	close(s.stop)
+}
+
+// receive обрабатывает сообщение клиента; любое сообщение подтверждает его присутствие
+func (s *session) receive(c *client, msg clientMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.presence.LastSeen = time.Now()
+
+	switch msg.Type {
+	case "heartbeat":
+	case "cursor":
+		if msg.Cursor == nil {
+			c.emit(map[string]interface{}{"type": "error", "error": "не указан курсор"})
+			return
+		}
+		s.moveCursor(c, msg.Revision, *msg.Cursor)
+	case "op":
+		if !c.presence.CanEdit {
+			c.emit(map[string]interface{}{"type": "error", "error": "недостаточно прав для редактирования заметки"})
+			return
+		}
+		if msg.Op == nil {
+			c.emit(map[string]interface{}{"type": "error", "error": "не указана операция"})
+			return
+		}
+		s.apply(c, c.presence.UserID, msg.Revision, msg.Op)
+	default:
+		c.emit(map[string]interface{}{"type": "error", "error": "неизвестный тип сообщения"})
+	}
+}
+
+// apply преобразует операцию, построенную для ревизии base, относительно более поздних
+// операций, применяет ее и рассылает клиентам. Автор операции (если это клиент) получает
+// подтверждение. Вызывается под s.mu.
+func (s *session) apply(from *client, authorID uint, base int, op *Operation) {
+	if base < s.offset || base > s.revision {
+		if from != nil {
+			from.emit(map[string]interface{}{"type": "error", "error": "ревизия устарела, переподключитесь", "resync": true})
+		}
+		return
+	}
+
+	var err error
+	for _, concurrent := range s.history[base-s.offset:] {
+		if op, _, err = Transform(op, concurrent); err != nil {
+			break
+		}
+	}
+	var content string
+	if err == nil {
+		content, err = op.Apply(s.content)
+	}
+	if err != nil {
+		if from != nil {
+			from.emit(map[string]interface{}{"type": "error", "error": "операция не подходит к документу: " + err.Error(), "resync": true})
+		}
+		return
+	}
+
+	s.content = content
+	s.revision++
+	s.history = append(s.history, op)
+	if len(s.history) > MaxHistory {
+		s.history = s.history[1:]
+		s.offset++
+	}
+	s.author = authorID
+	s.shiftCursors(op)
+
+	for c := range s.clients {
+		if c == from {
+			c.emit(map[string]interface{}{"type": "ack", "revision": s.revision})
+		} else {
+			c.emit(map[string]interface{}{"type": "op", "revision": s.revision, "op": op, "user_id": authorID})
+		}
+	}
+
+	if s.saveTimer == nil {
+		s.saveTimer = time.AfterFunc(SaveDelay, s.flush)
+	}
+}
+
+// flush сохраняет документ по таймеру и закрывает сессию, если в ней не осталось клиентов
+func (s *session) flush() {
+	s.mu.Lock()
+	s.saveTimer = nil
+	s.mu.Unlock()
+	s.save()
+	s.hub.release(s)
+}
+
+// save сохраняет текущее содержимое, если оно изменилось с последнего сохранения.
+// Сохранения выполняются по очереди, поэтому последнее всегда записывает свежий документ.
+func (s *session) save() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	base, content, revision, author := s.savedContent, s.content, s.revision, s.author
+	dirty := revision != s.savedRevision
+	s.mu.Unlock()
+	if !dirty {
+		return
+	}
+
+	current, err := s.hub.store.Save(s.noteID, base, content, author)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if errors.Is(err, ErrStaleContent) {
+		// Заметку изменили в обход сессии: изменение сливается с правками сессии,
+		// и результат сохраняется следующей попыткой поверх нового содержимого
+		log.Printf("Заметка %d изменена в обход сессии редактирования, правки будут слиты", s.noteID)
+		if s.savedContent == base {
+			s.merge(base, current, author)
+			s.savedContent, s.savedRevision = current, -1
+		}
+		if s.saveTimer == nil {
+			s.saveTimer = time.AfterFunc(SaveDelay, s.flush)
+		}
+		return
+	}
+	if err != nil {
+		s.saveFailures++
+		log.Printf("Ошибка при сохранении заметки %d из сессии редактирования (попытка %d): %v", s.noteID, s.saveFailures, err)
+		return
+	}
+	s.saveFailures = 0
+	s.savedRevision, s.savedContent = revision, content
+}
+
+// broadcast отправляет сообщение всем клиентам сессии, кроме except. Вызывается под s.mu.
+func (s *session) broadcast(except *client, msg map[string]interface{}) {
+	for c := range s.clients {
+		if c != except {
+			c.emit(msg)
+		}
+	}
+}
+
+// emit ставит сообщение в очередь клиента. Клиент, не успевающий читать, отключается.
+func (c *client) emit(msg map[string]interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// close закрывает очередь клиента; writePump после этого закрывает соединение
+func (c *client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// writePump отправляет сообщения клиенту и поддерживает соединение пингами
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/omega/notes-app/internal/diff"
+)
+
+// Ошибки применения и преобразования операций
+var (
+	ErrBaseLength   = errors.New("длина документа не совпадает с исходной длиной операции")
+	ErrIncompatible = errors.New("операции построены для документов разной длины")
+)
+
+// componentKind — вид шага операции
+type componentKind int
+
+const (
+	retainComponent componentKind = iota
+	insertComponent
+	deleteComponent
+)
+
+// component — шаг операции: пропуск или удаление n единиц либо вставка текста
+type component struct {
+	kind componentKind
+	n    int
+	text string
+}
+
+// Operation — изменение текста в модели операционных преобразований (OT): последовательность
+// пропусков, вставок и удалений, покрывающая документ целиком. Длины считаются в единицах
+// UTF-16, как строки в браузере. В JSON операция записывается как в ot.js: положительное
+// число — пропуск, отрицательное — удаление, строка — вставка.
+type Operation struct {
+	components []component
+	// BaseLength — длина документа, к которому применяется операция
+	BaseLength int
+	// TargetLength — длина документа после применения операции
+	TargetLength int
+}
+
+// Retain добавляет пропуск n единиц без изменений
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLength += n
+	o.TargetLength += n
+	if last := o.last(); last != nil && last.kind == retainComponent {
+		last.n += n
+	} else {
+		o.components = append(o.components, component{kind: retainComponent, n: n})
+	}
+	return o
+}
+
+// Insert добавляет вставку текста. Вставка всегда ставится перед соседним удалением,
+// чтобы одинаковые изменения имели одинаковую запись.
+func (o *Operation) Insert(text string) *Operation {
+	if text == "" {
+		return o
+	}
+	o.TargetLength += utf16Length(text)
+	last := o.last()
+	switch {
+	case last != nil && last.kind == insertComponent:
+		last.text += text
+	case last != nil && last.kind == deleteComponent:
+		if n := len(o.components); n > 1 && o.components[n-2].kind == insertComponent {
+			o.components[n-2].text += text
+		} else {
+			o.components = append(o.components, *last)
+			o.components[n-1] = component{kind: insertComponent, text: text}
+		}
+	default:
+		o.components = append(o.components, component{kind: insertComponent, text: text})
+	}
+	return o
+}
+
+// Delete добавляет удаление n единиц
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLength += n
+	if last := o.last(); last != nil && last.kind == deleteComponent {
+		last.n += n
+	} else {
+		o.components = append(o.components, component{kind: deleteComponent, n: n})
+	}
+	return o
+}
+
+// IsNoop сообщает, что операция не меняет документ
+func (o *Operation) IsNoop() bool {
+	return len(o.components) == 0 || (len(o.components) == 1 && o.components[0].kind == retainComponent)
+}
+
+func (o *Operation) last() *component {
+	if len(o.components) == 0 {
+		return nil
+	}
+	return &o.components[len(o.components)-1]
+}
+
+// Apply применяет операцию к документу
+func (o *Operation) Apply(doc string) (string, error) {
+	units := utf16.Encode([]rune(doc))
+	if len(units) != o.BaseLength {
+		return "", ErrBaseLength
+	}
+
+	result := make([]uint16, 0, o.TargetLength)
+	pos := 0
+	for _, c := range o.components {
+		switch c.kind {
+		case retainComponent:
+			result = append(result, units[pos:pos+c.n]...)
+			pos += c.n
+		case insertComponent:
+			result = append(result, utf16.Encode([]rune(c.text))...)
+		case deleteComponent:
+			pos += c.n
+		}
+	}
+	return string(utf16.Decode(result)), nil
+}
+
+// Transform преобразует две операции, примененные к одному документу одновременно, так что
+// apply(apply(doc, a), b') == apply(apply(doc, b), a'). При вставке в одну позицию текст
+// операции a оказывается первым.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.BaseLength != b.BaseLength {
+		return nil, nil, ErrIncompatible
+	}
+
+	aPrime, bPrime := &Operation{}, &Operation{}
+	ai, bi := newCursor(a), newCursor(b)
+	for {
+		ca, cb := ai.peek(), bi.peek()
+		if ca == nil && cb == nil {
+			return aPrime, bPrime, nil
+		}
+
+		// Вставки не зависят от другой операции: вторая их просто пропускает
+		if ca != nil && ca.kind == insertComponent {
+			aPrime.Insert(ca.text)
+			bPrime.Retain(utf16Length(ca.text))
+			ai.next()
+			continue
+		}
+		if cb != nil && cb.kind == insertComponent {
+			aPrime.Retain(utf16Length(cb.text))
+			bPrime.Insert(cb.text)
+			bi.next()
+			continue
+		}
+		if ca == nil || cb == nil {
+			return nil, nil, ErrIncompatible
+		}
+
+		n := ca.n
+		if cb.n < n {
+			n = cb.n
+		}
+		switch {
+		case ca.kind == retainComponent && cb.kind == retainComponent:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case ca.kind == deleteComponent && cb.kind == retainComponent:
+			aPrime.Delete(n)
+		case ca.kind == retainComponent && cb.kind == deleteComponent:
+			bPrime.Delete(n)
+		}
+		// Текст, удаленный обеими операциями, не нужно удалять повторно
+		ai.consume(n)
+		bi.consume(n)
+	}
+}
+
+// Diff строит операцию, превращающую before в after: общие начало и конец сохраняются,
+// отличающаяся середина заменяется. Суррогатные пары UTF-16 не разрезаются.
+func Diff(before, after string) *Operation {
+	from := utf16.Encode([]rune(before))
+	to := utf16.Encode([]rune(after))
+
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	if prefix > 0 && isHighSurrogate(from[prefix-1]) {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix &&
+		from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+	if suffix > 0 && isLowSurrogate(from[len(from)-suffix]) {
+		suffix--
+	}
+
+	op := &Operation{}
+	op.Retain(prefix)
+	op.Delete(len(from) - prefix - suffix)
+	op.Insert(string(utf16.Decode(to[prefix : len(to)-suffix])))
+	op.Retain(suffix)
+	return op
+}
+
+// DiffWords строит операцию, превращающую before в after, по пословному сравнению
+// алгоритмом Майерса. В отличие от Diff, несколько удаленных друг от друга правок остаются
+// отдельными шагами, и текст между ними сохраняется.
+func DiffWords(before, after string) *Operation {
+	op := &Operation{}
+	for _, e := range diff.Words(before, after) {
+		switch e.Op {
+		case diff.OpEqual:
+			op.Retain(utf16Length(e.Text))
+		case diff.OpDelete:
+			op.Delete(utf16Length(e.Text))
+		case diff.OpInsert:
+			op.Insert(e.Text)
+		}
+	}
+	return op
+}
+
+// MarshalJSON записывает операцию в формате ot.js
+func (o Operation) MarshalJSON() ([]byte, error) {
+	items := make([]interface{}, len(o.components))
+	for i, c := range o.components {
+		switch c.kind {
+		case retainComponent:
+			items[i] = c.n
+		case insertComponent:
+			items[i] = c.text
+		case deleteComponent:
+			items[i] = -c.n
+		}
+	}
+	return json.Marshal(items)
+}
+
+// UnmarshalJSON читает операцию в формате ot.js
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var items []interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+
+	*o = Operation{}
+	for _, item := range items {
+		switch v := item.(type) {
+		case float64:
+			if v != float64(int(v)) || v == 0 {
+				return fmt.Errorf("недопустимый шаг операции %v", v)
+			}
+			if v > 0 {
+				o.Retain(int(v))
+			} else {
+				o.Delete(int(-v))
+			}
+		case string:
+			if v == "" {
+				return errors.New("пустая вставка в операции")
+			}
+			o.Insert(v)
+		default:
+			return fmt.Errorf("недопустимый шаг операции %v", item)
+		}
+	}
+	return nil
+}
+
+// cursor перебирает шаги операции, позволяя потреблять пропуски и удаления частями
+type cursor struct {
+	components []component
+	index      int
+	current    component
+}
+
+func newCursor(o *Operation) *cursor {
+	c := &cursor{components: o.components, index: -1}
+	c.next()
+	return c
+}
+
+func (c *cursor) peek() *component {
+	if c.index >= len(c.components) {
+		return nil
+	}
+	return &c.current
+}
+
+func (c *cursor) next() {
+	c.index++
+	if c.index < len(c.components) {
+		c.current = c.components[c.index]
+	}
+}
+
+func (c *cursor) consume(n int) {
+	c.current.n -= n
+	if c.current.n == 0 {
+		c.next()
+	}
+}
+
+func utf16Length(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+func isHighSurrogate(u uint16) bool {
+	return u >= 0xD800 && u < 0xDC00
+}
+
+func isLowSurrogate(u uint16) bool {
+	return u >= 0xDC00 && u < 0xE000
+}
+
+// TransformIndex сдвигает позицию в документе с учетом операции: вставки до позиции
+// и в ней самой сдвигают ее вправо, удаления до позиции — влево
+func TransformIndex(op *Operation, index int) int {
+	newIndex := index
+	for _, c := range op.components {
+		switch c.kind {
+		case retainComponent:
+			index -= c.n
+		case insertComponent:
+			newIndex += utf16Length(c.text)
+		case deleteComponent:
+			if index < c.n {
+				newIndex -= index
+			} else {
+				newIndex -= c.n
+			}
+			index -= c.n
+		}
+		if index < 0 {
+			break
+		}
+	}
+	return newIndex
+}
@@ -0,0 +1,134 @@
+package collab
+
+import (
+	"sort"
+	"time"
+	"unicode/utf16"
+)
+
+// Параметры присутствия
+const (
+	// PresenceTimeout — через сколько после последнего сообщения клиент считается ушедшим
+	// и отключается. Клиенты без правок присылают {"type":"heartbeat"} чаще этого интервала.
+	PresenceTimeout = 45 * time.Second
+
+	sweepInterval = PresenceTimeout / 3
+)
+
+// Cursor — положение курсора или выделения в единицах UTF-16; при пустом выделении
+// Anchor и Head совпадают
+type Cursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// Presence описывает подключение к заметке. У одного пользователя может быть несколько
+// подключений, например в разных вкладках, поэтому они различаются по ClientID.
+type Presence struct {
+	ClientID int       `json:"client_id"`
+	UserID   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	CanEdit  bool      `json:"can_edit"`
+	Cursor   *Cursor   `json:"cursor"`
+	JoinedAt time.Time `json:"joined_at"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// Presence возвращает подключения к заметке в порядке подключения
+func (h *Hub) Presence(noteID uint) []Presence {
+	h.mu.Lock()
+	s := h.sessions[noteID]
+	h.mu.Unlock()
+	if s == nil {
+		return []Presence{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.presence()
+}
+
+// presence собирает копии описаний подключений. Вызывается под s.mu.
+func (s *session) presence() []Presence {
+	result := make([]Presence, 0, len(s.clients))
+	for c := range s.clients {
+		p := c.presence
+		if p.Cursor != nil {
+			cursor := *p.Cursor
+			p.Cursor = &cursor
+		}
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ClientID < result[j].ClientID })
+	return result
+}
+
+// moveCursor принимает положение курсора клиента для ревизии base, переносит его в текущую
+// ревизию и сообщает остальным участникам. Вызывается под s.mu.
+func (s *session) moveCursor(c *client, base int, cursor Cursor) {
+	if base < s.offset || base > s.revision {
+		// Курсор для устаревшей ревизии не переносится: клиент пришлет новый после синхронизации
+		return
+	}
+	for _, op := range s.history[base-s.offset:] {
+		cursor = transformCursor(op, cursor)
+	}
+	length := len(utf16.Encode([]rune(s.content)))
+	cursor.Anchor = clamp(cursor.Anchor, 0, length)
+	cursor.Head = clamp(cursor.Head, 0, length)
+
+	c.presence.Cursor = &cursor
+	s.broadcast(c, map[string]interface{}{
+		"type":      "cursor",
+		"client_id": c.presence.ClientID,
+		"user_id":   c.presence.UserID,
+		"cursor":    cursor,
+	})
+}
+
+// shiftCursors переносит курсоры всех клиентов через примененную операцию. Клиенты
+// сдвигают чужие курсоры сами, поэтому сервер лишь поддерживает актуальный снимок.
+func (s *session) shiftCursors(op *Operation) {
+	for c := range s.clients {
+		if c.presence.Cursor != nil {
+			cursor := transformCursor(op, *c.presence.Cursor)
+			c.presence.Cursor = &cursor
+		}
+	}
+}
+
+// sweep отключает клиентов, от которых давно нет сообщений, пока сессия не закрыта
+func (s *session) sweep(stop <-chan struct{}) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for c := range s.clients {
+				if now.Sub(c.presence.LastSeen) > PresenceTimeout {
+					// Соединение закроется, и клиент уйдет из сессии обычным путем
+					c.close()
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func transformCursor(op *Operation, cursor Cursor) Cursor {
+	return Cursor{Anchor: TransformIndex(op, cursor.Anchor), Head: TransformIndex(op, cursor.Head)}
+}
+
+func clamp(value, lo, hi int) int {
+	if value < lo {
+		return lo
+	}
+	if value > hi {
+		return hi
+	}
+	return value
+}
@@ -36,16 +36,92 @@ func InitDB() (*gorm.DB, error) {
 	}
 
 	// Миграция моделей
-	err = DB.AutoMigrate(&models.User{}, &models.Note{})
+	err = DB.AutoMigrate(
+		&models.User{},
+		&models.Workspace{},
+		&models.WorkspaceMember{},
+		&models.WorkspaceInvitation{},
+		&models.Notebook{},
+		&models.Tag{},
+		&models.Note{},
+		&models.NoteRevision{},
+		&models.NoteShare{},
+		&models.PublicLink{},
+		&models.NoteSuggestion{},
+		&models.BurnNote{},
+		&models.SavedSearch{},
+		&models.OAuthClient{},
+		&models.OAuthCode{},
+		&models.OAuthToken{},
+		&models.SAMLLinkRequest{},
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	// Блокноты по умолчанию теперь уникальны в пределах пространства, а не пользователя
+	if DB.Migrator().HasIndex(&models.Notebook{}, "idx_notebooks_user_default") {
+		if err := DB.Migrator().DropIndex(&models.Notebook{}, "idx_notebooks_user_default"); err != nil {
+			return nil, err
+		}
+	}
+
+	// Теги теперь уникальны в пределах пространства, а заметки рабочих пространств
+	// переходят с личных тегов авторов на теги пространства
+	if DB.Migrator().HasIndex(&models.Tag{}, "idx_tags_user_name") {
+		if err := DB.Migrator().DropIndex(&models.Tag{}, "idx_tags_user_name"); err != nil {
+			return nil, err
+		}
+	}
+	if err := migrateWorkspaceTags(DB); err != nil {
+		return nil, err
+	}
+
+	if err := migrateSearch(DB); err != nil {
+		return nil, err
+	}
+
 	log.Println("База данных успешно подключена и мигрирована")
 	return DB, nil
 }
 
+// migrateWorkspaceTags заменяет личные теги на заметках рабочих пространств тегами
+// этих пространств с теми же именами. Повторный запуск ничего не меняет.
+func migrateWorkspaceTags(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			INSERT INTO tags (name, user_id, workspace_id, created_at, updated_at)
+			SELECT DISTINCT ON (notes.workspace_id, LOWER(tags.name)) tags.name, tags.user_id, notes.workspace_id, NOW(), NOW()
+			FROM note_tags
+			JOIN notes ON notes.id = note_tags.note_id
+			JOIN tags ON tags.id = note_tags.tag_id
+			WHERE notes.workspace_id IS NOT NULL AND tags.workspace_id IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM tags existing
+				WHERE existing.workspace_id = notes.workspace_id AND LOWER(existing.name) = LOWER(tags.name)
+			)
+			ORDER BY notes.workspace_id, LOWER(tags.name), tags.id`).Error; err != nil {
+			return err
+		}
+		// Заметка может быть уже помечена тегом пространства с тем же именем
+		return tx.Exec(`
+			WITH moved AS (
+				DELETE FROM note_tags
+				USING notes, tags
+				WHERE notes.id = note_tags.note_id AND tags.id = note_tags.tag_id
+				AND notes.workspace_id IS NOT NULL AND tags.workspace_id IS NULL
+				RETURNING note_tags.note_id, notes.workspace_id, LOWER(tags.name) AS name
+			)
+			INSERT INTO note_tags (note_id, tag_id)
+			SELECT DISTINCT moved.note_id, workspace_tags.id
+			FROM moved
+			JOIN tags workspace_tags
+				ON workspace_tags.workspace_id = moved.workspace_id AND LOWER(workspace_tags.name) = moved.name
+			ON CONFLICT DO NOTHING`).Error
+	})
+}
+
 // GetDB возвращает экземпляр соединения с базой данных
 func GetDB() *gorm.DB {
 	return DB
-} 
\ No newline at end of file
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"log"
+
+	"github.com/omega/notes-app/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// searchSchemaVersion помечает текущее определение поискового столбца. При изменении
+// определения версия увеличивается, и столбец с индексом пересоздаются при запуске.
+const searchSchemaVersion = "search:v2"
+
+// searchMigrations создают вычисляемый tsvector заметки: заголовок с весом A,
+// содержимое с весом B, и GIN-индекс по нему.
+//
+// Конфигурация russian приводит кириллические слова к основе русским стеммером Snowball,
+// а латинские — английским (с английскими стоп-словами), поэтому один вектор покрывает
+// русские, английские и смешанные заметки. Буква «ё» заменяется на «е», как и в запросах.
+var searchMigrations = []string{
+	`ALTER TABLE notes DROP COLUMN IF EXISTS search_vector`,
+	`ALTER TABLE notes ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', translate(coalesce(title, ''), 'ёЁ', 'еЕ')), 'A') ||
+		setweight(to_tsvector('russian', translate(coalesce(content, ''), 'ёЁ', 'еЕ')), 'B')
+	) STORED`,
+	`CREATE INDEX idx_notes_search_vector ON notes USING GIN (search_vector)`,
+	`COMMENT ON COLUMN notes.search_vector IS '` + searchSchemaVersion + `'`,
+}
+
+// trigramMigrations подключают pg_trgm и индекс триграмм по заголовкам для нечеткого
+// поиска и автодополнения. Они идемпотентны и выполняются при каждом запуске.
+// Создание расширения требует прав владельца базы данных.
+var trigramMigrations = []string{
+	`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+	`CREATE INDEX IF NOT EXISTS idx_notes_title_trgm ON notes USING GIN (LOWER(title) gin_trgm_ops)`,
+}
+
+// migrateSearch создает или обновляет поисковый столбец заметок. GORM не знает об этом
+// столбце, поэтому он поддерживается отдельно от AutoMigrate.
+func migrateSearch(db *gorm.DB) error {
+	var version string
+	err := db.Raw(`
+		SELECT coalesce(col_description(attrelid, attnum), '')
+		FROM pg_attribute
+		WHERE attrelid = 'notes'::regclass AND attname = 'search_vector' AND NOT attisdropped`).
+		Scan(&version).Error
+	if err != nil {
+		return err
+	}
+	if version != searchSchemaVersion {
+		log.Printf("Обновление поискового индекса заметок до версии %s", searchSchemaVersion)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, statement := range searchMigrations {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range trigramMigrations {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return backfillNoteLanguages(db)
+}
+
+// backfillNoteLanguages определяет язык заметок, созданных до появления столбца language
+func backfillNoteLanguages(db *gorm.DB) error {
+	const batchSize = 500
+	for {
+		var notes []models.Note
+		err := db.Unscoped().Select("id, title, content").
+			Where("language IS NULL").
+			Limit(batchSize).
+			Find(&notes).Error
+		if err != nil {
+			return err
+		}
+		if len(notes) == 0 {
+			return nil
+		}
+
+		for _, note := range notes {
+			// UpdateColumn не меняет updated_at: содержимое заметки не изменилось
+			err := db.Unscoped().Model(&models.Note{}).Where("id = ?", note.ID).
+				UpdateColumn("language", models.DetectNoteLanguage(note.Title, note.Content)).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package diff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Op — тип изменения во фрагменте сравнения
+type Op string
+
+// Типы изменений
+const (
+	OpEqual  Op = "equal"
+	OpInsert Op = "insert"
+	OpDelete Op = "delete"
+)
+
+// Edit представляет фрагмент текста, который совпадает, добавлен или удален
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines сравнивает тексты построчно
+func Lines(a, b string) []Edit {
+	return compute(splitLines(a), splitLines(b))
+}
+
+// Words сравнивает тексты по словам. Пробельные символы сравниваются как отдельные токены,
+// поэтому склейка фрагментов восстанавливает исходные тексты без потерь.
+func Words(a, b string) []Edit {
+	return compute(splitWords(a), splitWords(b))
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	// После завершающего перевода строки SplitAfter возвращает пустую строку
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func splitWords(s string) []string {
+	var tokens []string
+	start := 0
+	var prevSpace bool
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > start && space != prevSpace {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+// maxEditCost ограничивает число правок, которое ищется на одном участке сравнения. Если
+// участки различаются сильнее, участок показывается целиком удаленным и вставленным:
+// иначе сравнение двух больших несхожих текстов заняло бы слишком много времени.
+const maxEditCost = 2000
+
+// compute строит кратчайший сценарий правки алгоритмом Майерса в линейной памяти
+// и склеивает соседние токены с одинаковым типом изменения. Удаления идут раньше
+// вставок в пределах одного измененного участка.
+func compute(a, b []string) []Edit {
+	var tokens []Edit
+	diffRange(a, b, &tokens)
+
+	// Фрагменты собираются через strings.Builder: склейка строк по одному токену
+	// была бы квадратичной на больших текстах
+	var edits []Edit
+	var equal, deleted, inserted strings.Builder
+	flush := func(b *strings.Builder, op Op) {
+		if b.Len() > 0 {
+			edits = append(edits, Edit{Op: op, Text: b.String()})
+			b.Reset()
+		}
+	}
+	for _, t := range tokens {
+		switch t.Op {
+		case OpDelete:
+			flush(&equal, OpEqual)
+			deleted.WriteString(t.Text)
+		case OpInsert:
+			flush(&equal, OpEqual)
+			inserted.WriteString(t.Text)
+		default:
+			flush(&deleted, OpDelete)
+			flush(&inserted, OpInsert)
+			equal.WriteString(t.Text)
+		}
+	}
+	flush(&equal, OpEqual)
+	flush(&deleted, OpDelete)
+	flush(&inserted, OpInsert)
+	return edits
+}
+
+// diffRange дописывает в edits потокенный сценарий правки a в b. Участок делится средней
+// змейкой на две части, которые сравниваются рекурсивно, поэтому память линейна по длине.
+func diffRange(a, b []string, edits *[]Edit) {
+	// Общие начало и конец не влияют на результат, а их отсечение сильно ускоряет поиск
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, t := range a[:prefix] {
+		*edits = append(*edits, Edit{Op: OpEqual, Text: t})
+	}
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// После отсечения совпадений пустая сторона означает чистую вставку или удаление;
+	// иначе правок не меньше двух, и обе части после деления строго проще исходного участка
+	x, y, u, v, ok := 0, 0, 0, 0, false
+	if len(middleA) > 0 && len(middleB) > 0 {
+		x, y, u, v, ok = middleSnake(middleA, middleB)
+	}
+	if ok {
+		diffRange(middleA[:x], middleB[:y], edits)
+		for _, t := range middleA[x:u] {
+			*edits = append(*edits, Edit{Op: OpEqual, Text: t})
+		}
+		diffRange(middleA[u:], middleB[v:], edits)
+	} else {
+		for _, t := range middleA {
+			*edits = append(*edits, Edit{Op: OpDelete, Text: t})
+		}
+		for _, t := range middleB {
+			*edits = append(*edits, Edit{Op: OpInsert, Text: t})
+		}
+	}
+
+	for _, t := range a[len(a)-suffix:] {
+		*edits = append(*edits, Edit{Op: OpEqual, Text: t})
+	}
+}
+
+// middleSnake ищет одновременно с начала и с конца среднюю змейку кратчайшего сценария:
+// совпадающий участок a[x:u] == b[y:v], через который проходит сценарий. Возвращает false,
+// если сценарий длиннее maxEditCost правок.
+func middleSnake(a, b []string) (int, int, int, int, bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+
+	limit := (n + m + 1) / 2
+	if limit > maxEditCost {
+		limit = maxEditCost
+	}
+	// forward[k] — самый дальний x на диагонали k = x - y при поиске с начала,
+	// backward[k] — то же для перевернутых последовательностей при поиске с конца
+	offset := limit + 1
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x0 int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x0 = forward[offset+k+1]
+			} else {
+				x0 = forward[offset+k-1] + 1
+			}
+			y0 := x0 - k
+			x, y := x0, y0
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if odd {
+				if rk := delta - k; rk >= -(d-1) && rk <= d-1 && x+backward[offset+rk] >= n {
+					return x0, y0, x, y, true
+				}
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x0 int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x0 = backward[offset+k+1]
+			} else {
+				x0 = backward[offset+k-1] + 1
+			}
+			y0 := x0 - k
+			x, y := x0, y0
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if !odd {
+				if fk := delta - k; fk >= -d && fk <= d && x+forward[offset+fk] >= n {
+					return n - x, m - y, n - x0, m - y0, true
+				}
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/burn"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BurnNoteRequest представляет данные для создания одноразовой заметки
+type BurnNoteRequest struct {
+	Content    string `json:"content" binding:"required,max=65536"`
+	TTLSeconds int    `json:"ttl_seconds" binding:"min=0"`
+}
+
+// RevealBurnNoteRequest представляет ключ из фрагмента ссылки
+type RevealBurnNoteRequest struct {
+	Key string `json:"key" binding:"required"`
+}
+
+// errBurnNoteGone означает, что одноразовая заметка уже прочитана, отменена или истекла
+var errBurnNoteGone = errors.New("заметка уже прочитана или срок ее действия истек")
+
+// burnNotePage — страница одноразовой заметки. Ключ читается из фрагмента ссылки, который
+// браузер не отправляет на сервер, и передается только по нажатию кнопки, поэтому
+// предпросмотр ссылки в мессенджере не уничтожает заметку.
+const burnNotePage = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Одноразовая заметка</title>
+<style>
+body { font-family: sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; }
+pre { white-space: pre-wrap; background: #f4f4f4; padding: 1rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Одноразовая заметка</h1>
+<p id="status">Заметку можно прочитать только один раз: после показа она будет удалена.</p>
+<button id="reveal">Показать</button>
+<pre id="content" hidden></pre>
+<script>
+document.getElementById("reveal").addEventListener("click", function () {
+  var button = this, status = document.getElementById("status");
+  button.disabled = true;
+  fetch(location.pathname, {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify({key: location.hash.slice(1)})
+  }).then(function (response) {
+    return response.json().then(function (body) { return {ok: response.ok, body: body}; });
+  }).then(function (result) {
+    if (!result.ok) {
+      status.textContent = result.body.error;
+      status.className = "error";
+      return;
+    }
+    var content = document.getElementById("content");
+    content.textContent = result.body.content;
+    content.hidden = false;
+    button.hidden = true;
+    status.textContent = "Заметка удалена с сервера. Сохраните текст, если он нужен.";
+    history.replaceState(null, "", location.pathname);
+  });
+});
+</script>
+</body>
+</html>
+`
+
+// CreateBurnNote шифрует текст случайным ключом и возвращает ссылку с ключом во фрагменте.
+// Сервер не хранит ключ, поэтому ссылка показывается только в этом ответе.
+func CreateBurnNote(c *gin.Context) {
+	var req BurnNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	// Срок проверяется до умножения, чтобы большое значение не переполнило time.Duration
+	if req.TTLSeconds > int(models.MaxBurnNoteTTL/time.Second) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl_seconds не может превышать 7 дней"})
+		return
+	}
+	ttl := models.DefaultBurnNoteTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	publicID, err := auth.GenerateRandomString(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании заметки"})
+		return
+	}
+	key, err := burn.NewKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании заметки"})
+		return
+	}
+	nonce, ciphertext, err := burn.Encrypt(key, []byte(req.Content), []byte(publicID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании заметки"})
+		return
+	}
+
+	note := models.BurnNote{
+		PublicID:    publicID,
+		UserID:      userID.(uint),
+		WorkspaceID: currentSpace(c).WorkspaceID,
+		Nonce:       nonce,
+		Ciphertext:  ciphertext,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := database.GetDB().Create(&note).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании заметки"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "одноразовая заметка создана",
+		"burn_note": note,
+		"url":       publicURL("/s/"+publicID) + "#" + burn.EncodeKey(key),
+	})
+}
+
+// GetBurnNotes возвращает непрочитанные одноразовые заметки активного пространства без содержимого
+func GetBurnNotes(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var notes []models.BurnNote
+	err := database.GetDB().
+		Scopes(currentSpace(c).BurnNotes).
+		Where("expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&notes).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"burn_notes": notes,
+	})
+}
+
+// DeleteBurnNote отменяет непрочитанную одноразовую заметку. В рабочем пространстве
+// чужие заметки могут отменять только администраторы.
+func DeleteBurnNote(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	query := database.GetDB().Scopes(currentSpace(c).BurnNotes).Where("public_id = ?", c.Param("id"))
+	if !managesSpace(c) {
+		query = query.Where("user_id = ?", userID)
+	}
+	result := query.Delete(&models.BurnNote{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении заметки"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "одноразовая заметка удалена",
+	})
+}
+
+// ViewBurnNote отдает страницу одноразовой заметки. Сама страница заметку не раскрывает.
+func ViewBurnNote(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Robots-Tag", "noindex")
+	c.Header("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(burnNotePage))
+}
+
+// RevealBurnNote расшифровывает одноразовую заметку ключом из ссылки и сразу удаляет ее.
+// Строка блокируется на время расшифровки, поэтому заметку получает только один запрос;
+// запрос с неверным ключом заметку не удаляет.
+func RevealBurnNote(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	var req RevealBurnNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key, err := burn.DecodeKey(req.Key)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ключ заметки"})
+		return
+	}
+
+	var content []byte
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var note models.BurnNote
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("public_id = ? AND expires_at > ?", c.Param("id"), time.Now()).
+			Limit(1).Find(&note)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errBurnNoteGone
+		}
+
+		content, err = burn.Decrypt(key, note.Nonce, note.Ciphertext, []byte(note.PublicID))
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&note).Error
+	})
+	if errors.Is(err, errBurnNoteGone) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, burn.ErrDecrypt) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "неверный ключ заметки"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"content": string(content),
+	})
+}
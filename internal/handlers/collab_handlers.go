@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/collab"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/middleware"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// collabHub объединяет подключения к одной заметке в общую сессию редактирования
+var collabHub = collab.NewHub(noteContentStore{})
+
+// socketUpgrader переводит HTTP-запрос в WebSocket. Токен передается явно, а не cookie,
+// поэтому чужой сайт не может подключиться от имени пользователя, и источник не проверяется,
+// как и в CORS для остального API.
+var socketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// NoteSocket открывает WebSocket для совместного редактирования заметки. Правки участников
+// сливаются операционными преобразованиями и сохраняются в заметку; читатели получают
+// изменения, но не могут их отправлять; так же подключаются приложения без области notes:write.
+// Браузер передает JWT параметром access_token.
+func NoteSocket(c *gin.Context) {
+	note, access, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ожидается запрос на подключение WebSocket"})
+		return
+	}
+
+	// При ошибке Upgrade сам отвечает клиенту
+	conn, err := socketUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	var username string
+	if user, exists := c.Get("user"); exists {
+		username = user.(models.User).Username
+	}
+	// Сокет открывается GET-запросом, поэтому право записи токена проверяется здесь
+	canEdit := access >= models.NoteAccessEdit && middleware.TokenHasScope(c, auth.ScopeNotesWrite)
+	collabHub.Serve(conn, note.ID, c.GetUint("user_id"), username, canEdit)
+}
+
+// GetNotePresence возвращает участников, открывших заметку, с их курсорами,
+// для клиентов без WebSocket
+func GetNotePresence(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"presence": collabHub.Presence(note.ID)})
+}
+
+// restrictNoteSockets пересматривает права открытых подключений пользователя к заметкам
+// после того, как его доступ изменился или был отозван
+func restrictNoteSockets(userID uint, noteIDs ...uint) {
+	for _, noteID := range noteIDs {
+		access := models.NoteAccessNone
+		var note models.Note
+		err := database.GetDB().First(&note, noteID).Error
+		if err == nil {
+			access, err = models.NoteAccessFor(database.GetDB(), &note, userID)
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+		if err != nil {
+			log.Printf("Ошибка при проверке доступа к заметке %d: %v", noteID, err)
+			continue
+		}
+		collabHub.Restrict(noteID, userID, access >= models.NoteAccessView, access >= models.NoteAccessEdit)
+	}
+}
+
+// noteContentStore читает и сохраняет содержимое заметок для сессий редактирования
+type noteContentStore struct{}
+
+// Load возвращает текущее содержимое заметки
+func (noteContentStore) Load(noteID uint) (string, error) {
+	var note models.Note
+	if err := database.GetDB().Select("id, content").First(&note, noteID).Error; err != nil {
+		return "", err
+	}
+	return note.Content, nil
+}
+
+// Save записывает содержимое заметки с новой версией и записью в историю и переносит
+// открытые предложенные правки. Строка заметки блокируется, поэтому сохранение
+// не конфликтует с обычными запросами на изменение; если содержимое уже не совпадает
+// с base, сессия получает его для слияния.
+func (noteContentStore) Save(noteID uint, base, content string, authorID uint) (string, error) {
+	var current string
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var note models.Note
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&note, noteID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && note.DeletedAt.Valid) {
+			// Заметку удалили, пока ее редактировали: сохранять правки некуда, а повторы бесполезны
+			log.Printf("Заметка %d удалена, правки сессии редактирования не сохранены", noteID)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		current = note.Content
+		if note.Content == content {
+			return nil
+		}
+		if note.Content != base {
+			return collab.ErrStaleContent
+		}
+
+		previous := note
+		note.Content = content
+		if err := models.SaveNoteVersion(tx, &note); err != nil {
+			return err
+		}
+		if err := models.EnsureBaselineRevision(tx, &previous); err != nil {
+			return err
+		}
+		if err := models.RecordRevision(tx, &note, authorID, models.RevisionCoalesceWindow()); err != nil {
+			return err
+		}
+		return models.RebaseSuggestions(tx, note.ID, previous.Content, note.Content)
+	})
+	return current, err
+}
@@ -1,18 +1,36 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/gin-gonic/gin"
 	"github.com/omega/notes-app/internal/database"
 	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // NoteRequest представляет данные для создания или обновления заметки
 type NoteRequest struct {
 	Title   string `json:"title" binding:"required"`
 	Content string `json:"content"`
+	// Tags — имена тегов заметки; при обновлении отсутствие поля оставляет теги без изменений
+	Tags []string `json:"tags"`
+	// NotebookID — блокнот заметки; при создании без него используется блокнот по умолчанию,
+	// при обновлении отсутствие поля оставляет блокнот без изменений
+	NotebookID *uint `json:"notebook_id"`
+	// ParentID — родительская заметка; учитывается только при создании,
+	// для перемещения существующей заметки используется POST /api/notes/:id/move
+	ParentID *uint `json:"parent_id"`
 }
 
 // CreateNote обрабатывает запрос на создание новой заметки
@@ -22,6 +40,10 @@ func CreateNote(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateTagNames(req.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Получаем ID пользователя из контекста
 	userID, exists := c.Get("user_id")
@@ -30,150 +52,588 @@ func CreateNote(c *gin.Context) {
 		return
 	}
 
-	// Создаем новую заметку
+	// Создаем новую заметку в активном пространстве
+	space := currentSpace(c)
 	note := models.Note{
-		Title:   req.Title,
-		Content: req.Content,
-		UserID:  userID.(uint),
+		Title:       req.Title,
+		Content:     req.Content,
+		UserID:      userID.(uint),
+		WorkspaceID: space.WorkspaceID,
 	}
 
-	// Сохраняем заметку в базе данных
-	if err := database.GetDB().Create(&note).Error; err != nil {
+	// Сохраняем заметку вместе с тегами в базе данных
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		notebookID := req.NotebookID
+		if req.ParentID != nil {
+			var parent models.Note
+			result := tx.Scopes(space.Notes).Where("notes.id = ?", *req.ParentID).Limit(1).Find(&parent)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errParentNotFound
+			}
+			note.ParentID = &parent.ID
+			// Дочерняя заметка по умолчанию попадает в блокнот родителя
+			if notebookID == nil {
+				notebookID = parent.NotebookID
+			}
+		}
+
+		notebook, err := resolveNotebook(tx, space, notebookID)
+		if err != nil {
+			return err
+		}
+		note.NotebookID = &notebook.ID
+
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		if err := models.RecordRevision(tx, &note, note.UserID, 0); err != nil {
+			return err
+		}
+		return replaceNoteTags(tx, &note, req.Tags)
+	})
+	if errors.Is(err, errNotebookNotFound) || errors.Is(err, errParentNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании заметки"})
 		return
 	}
 
+	c.Header("ETag", noteETag(&note))
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "заметка успешно создана",
 		"note":    note,
 	})
 }
 
-// GetNotes возвращает все заметки пользователя
+// GetNotes возвращает заметки активного пространства постранично с сортировкой и фильтрами
 func GetNotes(c *gin.Context) {
-	// Получаем ID пользователя из контекста
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+	notes, meta, ok := listNotes(c, database.GetDB().Scopes(currentSpace(c).Notes), false)
+	if !ok {
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"notes": notes,
+		"meta":  meta,
+	})
+}
+
+// noteSortColumns — поля, по которым можно сортировать список заметок
+var noteSortColumns = map[string]string{
+	"created":  "notes.created_at",
+	"updated":  "notes.updated_at",
+	"title":    "notes.title",
+	"position": "notes.position",
+}
+
+// ListMeta представляет метаданные страницы списка
+type ListMeta struct {
+	NextCursor *string `json:"next_cursor"`
+	Total      int64   `json:"total"`
+	Limit      int     `json:"limit"`
+}
+
+// listNotes применяет к выборке заметок общие параметры запроса и возвращает одну страницу:
+//   - tag, tag_mode — фильтр по тегам;
+//   - created_after, created_before, updated_after, updated_before — диапазоны дат
+//     (RFC 3339 или ГГГГ-ММ-ДД, нижняя граница включается, верхняя нет);
+//   - title_prefix — начало заголовка без учета регистра;
+//   - pinned, favorite (true, false) и archived (true, false, all) — фильтры по состояниям;
+//   - sort (created, updated, title, position), order (asc, desc), limit, cursor — сортировка
+//     и курсор. Ручной порядок (position) по умолчанию идет по возрастанию, остальные — по убыванию.
+//
+// Архивные заметки скрыты, если параметр archived не указан и showArchived равен false.
+// Закрепленные заметки всегда идут перед остальными, внутри групп действует выбранная
+// сортировка. Порядок однозначен благодаря сортировке по ID при равных значениях поля.
+// При ошибке ответ уже отправлен клиенту, и ok равен false.
+func listNotes(c *gin.Context, query *gorm.DB, showArchived bool) ([]models.Note, ListMeta, bool) {
+	var meta ListMeta
+
+	query, err := models.FilterNotesByTags(query, c.QueryArray("tag"), c.Query("tag_mode"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, meta, false
+	}
+
+	for _, filter := range []struct{ param, column string }{
+		{"pinned", "notes.pinned"},
+		{"favorite", "notes.favorite"},
+		{"archived", "notes.archived"},
+	} {
+		raw := c.Query(filter.param)
+		if raw == "" || (filter.param == "archived" && raw == "all") {
+			continue
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: ожидается true или false", filter.param)})
+			return nil, meta, false
+		}
+		query = query.Where(filter.column+" = ?", value)
+	}
+	if c.Query("archived") == "" && !showArchived {
+		query = query.Where("notes.archived = ?", false)
+	}
+
+	for _, filter := range []struct{ param, condition string }{
+		{"created_after", "notes.created_at >= ?"},
+		{"created_before", "notes.created_at < ?"},
+		{"updated_after", "notes.updated_at >= ?"},
+		{"updated_before", "notes.updated_at < ?"},
+	} {
+		raw := c.Query(filter.param)
+		if raw == "" {
+			continue
+		}
+		value, err := parseDateParam(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: ожидается дата в формате RFC 3339 или ГГГГ-ММ-ДД", filter.param)})
+			return nil, meta, false
+		}
+		query = query.Where(filter.condition, value)
+	}
+
+	if prefix := c.Query("title_prefix"); prefix != "" {
+		query = query.Where("LOWER(notes.title) LIKE LOWER(?)", escapeLikePattern(prefix)+"%")
+	}
+
+	sort := c.DefaultQuery("sort", "created")
+	column, ok := noteSortColumns[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort должен быть created, updated, title или position"})
+		return nil, meta, false
+	}
+	defaultOrder := "desc"
+	if sort == "position" {
+		defaultOrder = "asc"
+	}
+	order := c.DefaultQuery("order", defaultOrder)
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order должен быть asc или desc"})
+		return nil, meta, false
+	}
+	sortKey := sort + ":" + order
+
+	meta.Limit, err = pagination.ParseLimit(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, meta, false
+	}
+
+	// Общее число подходящих заметок не зависит от курсора
+	if err := query.Session(&gorm.Session{}).Model(&models.Note{}).Count(&meta.Total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметок"})
+		return nil, meta, false
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := pagination.Decode(raw, sortKey)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, meta, false
+		}
+		var value interface{} = cursor.Value
+		if sort == "created" || sort == "updated" {
+			if value, err = time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": pagination.ErrInvalidCursor.Error()})
+				return nil, meta, false
+			}
+		}
+		comparison := "<"
+		if order == "asc" {
+			comparison = ">"
+		}
+		after := fmt.Sprintf("(%s, notes.id) %s (?, ?)", column, comparison)
+		// После закрепленной заметки идут оставшиеся закрепленные и все незакрепленные,
+		// после незакрепленной — только незакрепленные
+		if cursor.Pinned {
+			query = query.Where("(NOT notes.pinned OR "+after+")", value, cursor.ID)
+		} else {
+			query = query.Where("NOT notes.pinned AND "+after, value, cursor.ID)
+		}
+	}
+
+	// Запрашиваем на одну заметку больше, чтобы узнать, есть ли следующая страница
 	var notes []models.Note
-	if err := database.GetDB().Where("user_id = ?", userID).Find(&notes).Error; err != nil {
+	err = query.Preload("Tags").
+		Order(fmt.Sprintf("notes.pinned DESC, %s %s, notes.id %s", column, order, order)).
+		Limit(meta.Limit + 1).
+		Find(&notes).Error
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметок"})
-		return
+		return nil, meta, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"notes": notes,
-	})
+	if len(notes) > meta.Limit {
+		notes = notes[:meta.Limit]
+		last := notes[len(notes)-1]
+		cursor := pagination.Cursor{Sort: sortKey, ID: last.ID, Pinned: last.Pinned}
+		switch sort {
+		case "created":
+			cursor.Value = last.CreatedAt.Format(time.RFC3339Nano)
+		case "updated":
+			cursor.Value = last.UpdatedAt.Format(time.RFC3339Nano)
+		case "title":
+			cursor.Value = last.Title
+		case "position":
+			cursor.Value = last.Position
+		}
+		next := pagination.Encode(cursor)
+		meta.NextCursor = &next
+	}
+
+	return notes, meta, true
+}
+
+// parseDateParam разбирает дату в формате RFC 3339 или ГГГГ-ММ-ДД (UTC)
+func parseDateParam(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
 }
 
-// GetNote возвращает заметку по ID
+// escapeLikePattern экранирует спецсимволы шаблона LIKE
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// GetNote возвращает заметку по ID владельцу или пользователю, которому открыт доступ
 func GetNote(c *gin.Context) {
-	// Получаем ID пользователя из контекста
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+	note, access, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
 		return
 	}
 
-	// Получаем ID заметки из URL
-	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID заметки"})
+	// Клиент с актуальной версией получает ответ без тела
+	etag := noteETag(note)
+	c.Header("ETag", etag)
+	if etagListContains(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 
-	var note models.Note
-	result := database.GetDB().Where("id = ? AND user_id = ?", noteID, userID).First(&note)
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
+	if err := database.GetDB().Model(note).Association("Tags").Find(&note.Tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметки"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"note": note,
+		"role": access.Role(),
 	})
 }
 
-// UpdateNote обновляет заметку по ID
+// UpdateNote обновляет заметку по ID; доступно владельцу и редакторам
 func UpdateNote(c *gin.Context) {
-	// Получаем ID пользователя из контекста
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+	note, access, ok := findAccessibleNote(c, models.NoteAccessEdit)
+	if !ok {
+		return
+	}
+	if !ifMatchSatisfied(c, note) {
+		respondNoteConflict(c, note.ID)
+		return
+	}
+
+	// Получаем данные для обновления
+	var req NoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateTagNames(req.Tags); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveNoteChanges(c, note, access, req)
+}
+
+// Типы содержимого, которые принимает PATCH /api/notes/:id
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// notePatchDocument — изменяемые поля заметки, к которым применяется патч
+type notePatchDocument struct {
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Tags       []string `json:"tags"`
+	NotebookID *uint    `json:"notebook_id"`
+}
+
+// PatchNote частично обновляет заметку по ID. Тело запроса — JSON Merge Patch (RFC 7396,
+// application/merge-patch+json или application/json) либо JSON Patch (RFC 6902,
+// application/json-patch+json), применяемые к документу с полями title, content, tags и notebook_id.
+func PatchNote(c *gin.Context) {
+	note, access, ok := findAccessibleNote(c, models.NoteAccessEdit)
+	if !ok {
+		return
+	}
+	if !ifMatchSatisfied(c, note) {
+		respondNoteConflict(c, note.ID)
 		return
 	}
 
-	// Получаем ID заметки из URL
-	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	contentType := c.ContentType()
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType && contentType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "поддерживаются только " + mergePatchContentType + " и " + jsonPatchContentType})
+		return
+	}
+
+	patch, err := c.GetRawData()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID заметки"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не удалось прочитать тело запроса"})
 		return
 	}
 
-	// Проверяем, существует ли заметка и принадлежит ли она пользователю
-	var note models.Note
-	result := database.GetDB().Where("id = ? AND user_id = ?", noteID, userID).First(&note)
-	if result.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
+	if err := database.GetDB().Model(note).Association("Tags").Find(&note.Tags); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при обновлении заметки"})
+		return
+	}
+	current := notePatchDocument{
+		Title:      note.Title,
+		Content:    note.Content,
+		Tags:       make([]string, 0, len(note.Tags)),
+		NotebookID: note.NotebookID,
+	}
+	for _, tag := range note.Tags {
+		current.Tags = append(current.Tags, tag.Name)
+	}
+	doc, err := json.Marshal(current)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при обновлении заметки"})
 		return
 	}
 
-	// Получаем данные для обновления
-	var req NoteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var patched []byte
+	if contentType == jsonPatchContentType {
+		operations, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный JSON Patch: " + err.Error()})
+			return
+		}
+		patched, err = operations.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "проверка test в JSON Patch не пройдена"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "не удалось применить JSON Patch: " + err.Error()})
+			return
+		}
+	} else {
+		patched, err = jsonpatch.MergePatch(doc, patch)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "некорректный JSON Merge Patch: " + err.Error()})
+			return
+		}
+	}
+
+	// Патч не может добавлять поля, которых нет в документе заметки
+	var result notePatchDocument
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&result); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "недопустимый результат патча: " + err.Error()})
+		return
+	}
+
+	if strings.TrimSpace(result.Title) == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "заголовок заметки не может быть пустым"})
+		return
+	}
+	if err := validateTagNames(result.Tags); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Удаление notebook_id возвращает заметку в блокнот по умолчанию,
+	// удаление tags снимает все теги
+	if result.NotebookID == nil {
+		notebook, err := models.DefaultNotebook(database.GetDB(), models.NoteSpace(note))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при обновлении заметки"})
+			return
+		}
+		result.NotebookID = &notebook.ID
+	}
+	if result.Tags == nil {
+		result.Tags = []string{}
+	}
+
+	saveNoteChanges(c, note, access, NoteRequest{
+		Title:      result.Title,
+		Content:    result.Content,
+		Tags:       result.Tags,
+		NotebookID: result.NotebookID,
+	})
+}
+
+// DeleteNote перемещает заметку по ID в корзину; удалить заметку может только владелец
+func DeleteNote(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+	if !ifMatchSatisfied(c, note) {
+		respondNoteConflict(c, note.ID)
 		return
 	}
 
-	// Обновляем заметку
+	// Перемещаем заметку в корзину; дочерние заметки переходят к ее родителю
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := models.LockSpace(tx, models.NoteSpace(note)); err != nil {
+			return err
+		}
+		// При условном удалении версия перепроверяется под блокировкой строки
+		if c.GetHeader("If-Match") != "" {
+			var current models.Note
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, note.ID).Error; err != nil {
+				return err
+			}
+			if current.Version != note.Version {
+				return models.ErrNoteVersionConflict
+			}
+		}
+		if err := tx.Model(&models.Note{}).Where("parent_id = ?", note.ID).
+			Updates(map[string]interface{}{"parent_id": note.ParentID, "version": models.NoteVersionIncrement()}).Error; err != nil {
+			return err
+		}
+		return models.TrashNotes(tx, []uint{note.ID})
+	})
+	if errors.Is(err, models.ErrNoteVersionConflict) {
+		respondNoteConflict(c, note.ID)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении заметки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "заметка перемещена в корзину",
+	})
+}
+
+// saveNoteChanges применяет к заметке заголовок, содержимое, блокнот и теги из запроса
+// с проверкой версии и записью в историю, после чего отвечает клиенту.
+// Блокнот и теги принадлежат владельцу, поэтому редакторы меняют только заголовок и содержимое.
+func saveNoteChanges(c *gin.Context, note *models.Note, access models.NoteAccess, req NoteRequest) {
+	userID := c.GetUint("user_id")
+	if access < models.NoteAccessOwner {
+		req.NotebookID = nil
+		req.Tags = nil
+	}
+
+	// Сохраняем прежнее состояние для истории версий
+	previous := *note
 	note.Title = req.Title
 	note.Content = req.Content
 
-	if err := database.GetDB().Save(&note).Error; err != nil {
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if req.NotebookID != nil {
+			notebook, err := resolveNotebook(tx, models.NoteSpace(note), req.NotebookID)
+			if err != nil {
+				return err
+			}
+			note.NotebookID = &notebook.ID
+		}
+
+		if err := models.SaveNoteVersion(tx, note); err != nil {
+			return err
+		}
+		if err := models.EnsureBaselineRevision(tx, &previous); err != nil {
+			return err
+		}
+		if err := models.RecordRevision(tx, note, userID, models.RevisionCoalesceWindow()); err != nil {
+			return err
+		}
+		if err := models.RebaseSuggestions(tx, note.ID, previous.Content, note.Content); err != nil {
+			return err
+		}
+		if req.Tags != nil {
+			return replaceNoteTags(tx, note, req.Tags)
+		}
+		return tx.Model(note).Association("Tags").Find(&note.Tags)
+	})
+	if errors.Is(err, errNotebookNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, models.ErrNoteVersionConflict) {
+		respondNoteConflict(c, note.ID)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при обновлении заметки"})
 		return
 	}
+	// Открытая сессия совместного редактирования сливает изменение со своими правками
+	collabHub.ApplyExternal(note.ID, previous.Content, note.Content, userID)
 
+	c.Header("ETag", noteETag(note))
 	c.JSON(http.StatusOK, gin.H{
 		"message": "заметка успешно обновлена",
 		"note":    note,
 	})
 }
 
-// DeleteNote удаляет заметку по ID
-func DeleteNote(c *gin.Context) {
-	// Получаем ID пользователя из контекста
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
-		return
+// replaceNoteTags заменяет теги заметки на перечисленные по именам
+func replaceNoteTags(tx *gorm.DB, note *models.Note, names []string) error {
+	tags, err := resolveTags(tx, models.NoteSpace(note), names)
+	if err != nil {
+		return err
 	}
+	note.Tags = tags
+	return tx.Model(note).Association("Tags").Replace(tags)
+}
 
-	// Получаем ID заметки из URL
-	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID заметки"})
-		return
+// noteETag возвращает ETag, соответствующий версии заметки
+func noteETag(note *models.Note) string {
+	return fmt.Sprintf(`"%d"`, note.Version)
+}
+
+// etagListContains проверяет, перечислен ли etag в заголовке If-Match или If-None-Match
+func etagListContains(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
 	}
+	return false
+}
+
+// ifMatchSatisfied проверяет заголовок If-Match; запрос без заголовка считается безусловным
+func ifMatchSatisfied(c *gin.Context, note *models.Note) bool {
+	header := c.GetHeader("If-Match")
+	return header == "" || etagListContains(header, noteETag(note))
+}
 
-	// Проверяем, существует ли заметка и принадлежит ли она пользователю
-	var note models.Note
-	result := database.GetDB().Where("id = ? AND user_id = ?", noteID, userID).First(&note)
-	if result.Error != nil {
+// respondNoteConflict сообщает клиенту об устаревшей версии и возвращает текущую заметку:
+// 412 для условного запроса с If-Match, 409 для гонки безусловных запросов
+func respondNoteConflict(c *gin.Context, noteID uint) {
+	var current models.Note
+	if err := database.GetDB().Preload("Tags").First(&current, noteID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
 		return
 	}
 
-	// Удаляем заметку
-	if err := database.GetDB().Delete(&note).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении заметки"})
-		return
+	status, message := http.StatusPreconditionFailed, "версия заметки устарела"
+	if c.GetHeader("If-Match") == "" {
+		status, message = http.StatusConflict, "заметка была изменена другим запросом, повторите попытку"
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "заметка успешно удалена",
+	c.Header("ETag", noteETag(&current))
+	c.JSON(status, gin.H{
+		"error": message,
+		"note":  current,
 	})
-} 
\ No newline at end of file
+}
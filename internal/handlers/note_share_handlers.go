@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// ShareNoteRequest представляет данные для открытия доступа к заметке
+type ShareNoteRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// UpdateShareRequest представляет данные для смены роли
+type UpdateShareRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SharedNote представляет заметку, доступную текущему пользователю, вместе с его ролью
+type SharedNote struct {
+	models.Note
+	Role string `json:"role"`
+}
+
+// ShareNote открывает доступ к заметке зарегистрированному пользователю с указанной ролью.
+// Повторный вызов для того же пользователя меняет его роль.
+func ShareNote(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+
+	var req ShareNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidShareRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role должен быть viewer, commenter или editor"})
+		return
+	}
+
+	var recipient models.User
+	result := database.GetDB().Where("LOWER(email) = LOWER(?)", strings.TrimSpace(req.Email)).Limit(1).Find(&recipient)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при открытии доступа"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "пользователь не найден"})
+		return
+	}
+	if recipient.ID == note.UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "нельзя открыть доступ владельцу заметки"})
+		return
+	}
+
+	share := models.NoteShare{NoteID: note.ID, UserID: recipient.ID}
+	status := http.StatusCreated
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Where(&share).Limit(1).Find(&share)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			status = http.StatusOK
+		}
+		share.Role = req.Role
+		share.SharedByID = c.GetUint("user_id")
+		return tx.Save(&share).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при открытии доступа"})
+		return
+	}
+	share.User = &recipient
+
+	c.JSON(status, gin.H{
+		"message": "доступ к заметке открыт",
+		"share":   share,
+	})
+}
+
+// GetNoteShares возвращает пользователей, которым открыт доступ к заметке
+func GetNoteShares(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+
+	var shares []models.NoteShare
+	if err := database.GetDB().Preload("User").Where("note_id = ?", note.ID).Order("id").Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении доступов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shares": shares,
+	})
+}
+
+// UpdateNoteShare меняет роль пользователя, которому открыт доступ к заметке
+func UpdateNoteShare(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+	share, ok := findNoteShare(c, note)
+	if !ok {
+		return
+	}
+
+	var req UpdateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidShareRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role должен быть viewer, commenter или editor"})
+		return
+	}
+
+	share.Role = req.Role
+	if err := database.GetDB().Omit("User").Save(share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при изменении доступа"})
+		return
+	}
+	restrictNoteSockets(share.UserID, note.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "доступ успешно изменен",
+		"share":   share,
+	})
+}
+
+// DeleteNoteShare закрывает доступ к заметке. Владелец может отозвать любой доступ,
+// получатель — отказаться от своего.
+func DeleteNoteShare(c *gin.Context) {
+	note, access, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+	share, ok := findNoteShare(c, note)
+	if !ok {
+		return
+	}
+	if access != models.NoteAccessOwner && share.UserID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав для этого действия с заметкой"})
+		return
+	}
+
+	if err := database.GetDB().Delete(share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при закрытии доступа"})
+		return
+	}
+	restrictNoteSockets(share.UserID, note.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "доступ к заметке закрыт",
+	})
+}
+
+// GetSharedNotes возвращает постранично заметки других пользователей, доступные текущему
+func GetSharedNotes(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	query := database.GetDB().Where("notes.id IN (SELECT note_id FROM note_shares WHERE user_id = ?)", userID)
+	// Архив — состояние, которое выбирает владелец, поэтому получатель видит все открытые ему заметки
+	notes, meta, ok := listNotes(c, query, true)
+	if !ok {
+		return
+	}
+
+	ids := make([]uint, len(notes))
+	for i, note := range notes {
+		ids[i] = note.ID
+	}
+	var shares []models.NoteShare
+	if err := database.GetDB().Where("user_id = ? AND note_id IN ?", userID, ids).Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметок"})
+		return
+	}
+	roles := make(map[uint]string, len(shares))
+	for _, share := range shares {
+		roles[share.NoteID] = share.Role
+	}
+
+	result := make([]SharedNote, len(notes))
+	for i, note := range notes {
+		result[i] = SharedNote{Note: note, Role: roles[note.ID]}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notes": result,
+		"meta":  meta,
+	})
+}
+
+// findAccessibleNote загружает заметку по ID из URL и проверяет, что у текущего пользователя
+// есть доступ не ниже need. Доступ к заметке активного пространства определяется ролью,
+// к заметкам остальных пространств — только явно открытым доступом. Заметка без доступа
+// выглядит как несуществующая (404), при недостаточном доступе возвращается 403.
+// Вторым значением возвращается уровень доступа.
+func findAccessibleNote(c *gin.Context, need models.NoteAccess) (*models.Note, models.NoteAccess, bool) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return nil, models.NoteAccessNone, false
+	}
+
+	// Получаем ID заметки из URL
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID заметки"})
+		return nil, models.NoteAccessNone, false
+	}
+
+	var note models.Note
+	result := database.GetDB().First(&note, noteID)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
+		return nil, models.NoteAccessNone, false
+	}
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметки"})
+		return nil, models.NoteAccessNone, false
+	}
+
+	// Заметки других пространств доступны только по явно открытому доступу
+	var access models.NoteAccess
+	if models.NoteSpace(&note).Equal(currentSpace(c)) {
+		access, err = models.NoteAccessFor(database.GetDB(), &note, userID.(uint))
+	} else {
+		access, err = models.NoteShareAccess(database.GetDB(), note.ID, userID.(uint))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении заметки"})
+		return nil, models.NoteAccessNone, false
+	}
+	if access == models.NoteAccessNone {
+		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
+		return nil, access, false
+	}
+	if access < need {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав для этого действия с заметкой", "role": access.Role()})
+		return nil, access, false
+	}
+
+	return &note, access, true
+}
+
+// findNoteShare загружает доступ к заметке по ID из URL
+func findNoteShare(c *gin.Context, note *models.Note) (*models.NoteShare, bool) {
+	shareID, err := strconv.ParseUint(c.Param("share_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID доступа"})
+		return nil, false
+	}
+
+	var share models.NoteShare
+	result := database.GetDB().Where("id = ? AND note_id = ?", shareID, note.ID).First(&share)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "доступ не найден"})
+		return nil, false
+	}
+
+	return &share, true
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+)
+
+// NoteStateRequest представляет массовое изменение состояний заметок.
+// Неуказанные состояния не меняются.
+type NoteStateRequest struct {
+	NoteIDs  []uint `json:"note_ids" binding:"required,min=1"`
+	Pinned   *bool  `json:"pinned"`
+	Archived *bool  `json:"archived"`
+	Favorite *bool  `json:"favorite"`
+}
+
+// SetNoteStates закрепляет, архивирует или добавляет в избранное сразу несколько заметок.
+// Состояния не считаются изменением содержимого: ревизии и время изменения заметок остаются
+// прежними, а версия увеличивается, чтобы сменился ETag.
+func SetNoteStates(c *gin.Context) {
+	var req NoteStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Pinned != nil {
+		updates["pinned"] = *req.Pinned
+	}
+	if req.Archived != nil {
+		updates["archived"] = *req.Archived
+	}
+	if req.Favorite != nil {
+		updates["favorite"] = *req.Favorite
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "укажите хотя бы одно из состояний pinned, archived, favorite"})
+		return
+	}
+	updates["version"] = models.NoteVersionIncrement()
+
+	// Меняем только заметки активного пространства; остальные ID считаются отсутствующими
+	result := database.GetDB().Model(&models.Note{}).
+		Scopes(currentSpace(c).Notes).
+		Where("notes.id IN ?", req.NoteIDs).
+		UpdateColumns(updates)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при изменении состояния заметок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "состояние заметок успешно изменено",
+		"updated": result.RowsAffected,
+	})
+}
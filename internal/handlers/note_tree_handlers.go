@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/ordering"
+	"gorm.io/gorm"
+)
+
+// Ошибки операций с иерархией заметок
+var (
+	errParentNotFound    = errors.New("родительская заметка не найдена")
+	errNeighbourNotFound = errors.New("соседняя заметка не найдена в том же блокноте")
+	errNeighbourOrder    = errors.New("заметка after_id должна идти перед заметкой before_id")
+	errNoteCycle         = errors.New("нельзя переместить заметку внутрь самой себя или своего потомка")
+	errSubtreeAccess     = errors.New("недостаточно прав для удаления всех вложенных заметок")
+)
+
+// MoveNoteRequest представляет данные для перемещения заметки в иерархии и ручном порядке.
+// Пустой parent_id делает заметку корневой. Если указаны after_id или before_id, заметка
+// встает после after_id и перед before_id в своем блокноте; родитель при этом меняется,
+// только если parent_id передан явно.
+type MoveNoteRequest struct {
+	ParentID *uint `json:"parent_id"`
+	AfterID  *uint `json:"after_id"`
+	BeforeID *uint `json:"before_id"`
+}
+
+// ExportedNote представляет заметку с потомками при экспорте поддерева
+type ExportedNote struct {
+	ID        uint            `json:"id"`
+	Title     string          `json:"title"`
+	Content   string          `json:"content"`
+	Tags      []string        `json:"tags"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Children  []*ExportedNote `json:"children"`
+}
+
+// GetNoteTree возвращает иерархию заметок активного пространства. Параметр root ограничивает
+// дерево поддеревом указанной заметки.
+func GetNoteTree(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	space := currentSpace(c)
+	query := database.GetDB().Select("id, title, parent_id").Scopes(space.Notes)
+	if root := c.Query("root"); root != "" {
+		rootID, err := strconv.ParseUint(root, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID заметки"})
+			return
+		}
+		ids, err := models.SubtreeNoteIDs(database.GetDB(), space, uint(rootID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении дерева заметок"})
+			return
+		}
+		if len(ids) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
+			return
+		}
+		query = query.Where("id IN ?", ids)
+	}
+
+	var notes []models.Note
+	if err := query.Order("id").Find(&notes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении дерева заметок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tree": models.BuildNoteTree(notes),
+	})
+}
+
+// MoveNote перемещает заметку под другого родителя, не допуская циклов, и/или между
+// соседними заметками блокнота
+func MoveNote(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Отдельный разбор в словарь отличает отсутствующий parent_id от явного null
+	var req MoveNoteRequest
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reorder := req.AfterID != nil || req.BeforeID != nil
+	_, hasParent := fields["parent_id"]
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := models.LockSpace(tx, models.NoteSpace(note)); err != nil {
+			return err
+		}
+		if hasParent || !reorder {
+			if req.ParentID != nil {
+				if err := checkNoteParent(tx, note, *req.ParentID); err != nil {
+					return err
+				}
+			}
+			note.ParentID = req.ParentID
+			if err := updateNoteColumn(tx, note, "parent_id", req.ParentID); err != nil {
+				return err
+			}
+		}
+		if reorder {
+			return moveNotePosition(tx, note, req.AfterID, req.BeforeID)
+		}
+		return nil
+	})
+	if errors.Is(err, errNeighbourNotFound) || errors.Is(err, errNeighbourOrder) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errParentNotFound) || errors.Is(err, errNoteCycle) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при перемещении заметки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "заметка успешно перемещена",
+		"note":    note,
+	})
+}
+
+// DeleteNoteSubtree перемещает заметку вместе со всеми потомками в корзину. Удалить
+// поддерево можно, только если пользователь может удалить каждую его заметку.
+func DeleteNoteSubtree(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+
+	var deleted int
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := models.LockSpace(tx, models.NoteSpace(note)); err != nil {
+			return err
+		}
+		ids, err := models.SubtreeNoteIDs(tx, models.NoteSpace(note), note.ID)
+		if err != nil {
+			return err
+		}
+		var notes []models.Note
+		if err := tx.Where("id IN ?", ids).Find(&notes).Error; err != nil {
+			return err
+		}
+		access, err := models.NotesAccessFor(tx, notes, c.GetUint("user_id"))
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if access[id] < models.NoteAccessOwner {
+				return errSubtreeAccess
+			}
+		}
+		deleted = len(ids)
+		return models.TrashNotes(tx, ids)
+	})
+	if errors.Is(err, errSubtreeAccess) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении заметок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "заметки перемещены в корзину",
+		"deleted": deleted,
+	})
+}
+
+// ExportNoteSubtree выгружает заметку со всеми потомками в формате json или markdown.
+// Потомки, недоступные пользователю, пропускаются вместе со своими поддеревьями.
+func ExportNoteSubtree(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "markdown" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format должен быть json или markdown"})
+		return
+	}
+
+	notes, err := loadNoteSubtree(database.GetDB(), note)
+	if err == nil {
+		notes, err = visibleSubtree(database.GetDB(), notes, c.GetUint("user_id"))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при экспорте заметок"})
+		return
+	}
+	if len(notes) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена"})
+		return
+	}
+
+	byID := make(map[uint]*models.Note, len(notes))
+	for i := range notes {
+		byID[notes[i].ID] = &notes[i]
+	}
+	// Корень поддерева всегда первый: его родитель не входит в выборку
+	root := exportNoteNode(models.BuildNoteTree(notes)[0], byID)
+
+	if format == "markdown" {
+		var b strings.Builder
+		writeNoteMarkdown(&b, root, 1)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="note-%d.md"`, note.ID))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(b.String()))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="note-%d.json"`, note.ID))
+	c.JSON(http.StatusOK, gin.H{
+		"note": root,
+	})
+}
+
+// DuplicateNoteSubtree создает копию заметки со всеми доступными потомками и тегами.
+// Копии принадлежат текущему пользователю и создаются в активном пространстве: копия
+// заметки этого пространства помещается рядом с оригиналом, копия открытой пользователю
+// чужой заметки становится корневой в блокноте по умолчанию.
+func DuplicateNoteSubtree(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	space := currentSpace(c)
+	sameSpace := models.NoteSpace(note).Equal(space)
+
+	var rootCopy models.Note
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := models.LockSpace(tx, space); err != nil {
+			return err
+		}
+		notes, err := loadNoteSubtree(tx, note)
+		if err == nil {
+			notes, err = visibleSubtree(tx, notes, userID)
+		}
+		if err != nil {
+			return err
+		}
+		var notebookID *uint
+		if !sameSpace {
+			notebook, err := models.DefaultNotebook(tx, space)
+			if err != nil {
+				return err
+			}
+			notebookID = &notebook.ID
+		}
+
+		// Заметки упорядочены по глубине, поэтому родитель копируется раньше потомков
+		copies := make(map[uint]uint, len(notes))
+		for _, original := range notes {
+			duplicate := models.Note{
+				Title:       original.Title,
+				Content:     original.Content,
+				UserID:      userID,
+				WorkspaceID: space.WorkspaceID,
+				NotebookID:  original.NotebookID,
+				ParentID:    original.ParentID,
+			}
+			if !sameSpace {
+				duplicate.NotebookID = notebookID
+			}
+			if original.ID == note.ID {
+				duplicate.Title = duplicateTitle(original.Title)
+				if !sameSpace {
+					duplicate.ParentID = nil
+				}
+			} else if original.ParentID != nil {
+				parentCopy := copies[*original.ParentID]
+				duplicate.ParentID = &parentCopy
+			}
+			if err := tx.Create(&duplicate).Error; err != nil {
+				return err
+			}
+			// Теги чужого пространства заменяются одноименными тегами активного
+			names := make([]string, 0, len(original.Tags))
+			for _, tag := range original.Tags {
+				names = append(names, tag.Name)
+			}
+			if err := replaceNoteTags(tx, &duplicate, names); err != nil {
+				return err
+			}
+			copies[original.ID] = duplicate.ID
+			if original.ID == note.ID {
+				rootCopy = duplicate
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при копировании заметок"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "заметки успешно скопированы",
+		"note":    rootCopy,
+	})
+}
+
+// moveNotePosition ставит заметку между соседями одним обновлением ее ключа порядка.
+// Если указан только один сосед, второй определяется по текущему порядку блокнота.
+func moveNotePosition(tx *gorm.DB, note *models.Note, afterID, beforeID *uint) error {
+	neighbourPosition := func(id *uint) (string, error) {
+		if id == nil {
+			return "", nil
+		}
+		var neighbour models.Note
+		result := tx.Scopes(models.NoteSpace(note).Notes).
+			Where("notes.id = ? AND notes.id <> ? AND notes.notebook_id IS NOT DISTINCT FROM ?", *id, note.ID, note.NotebookID).
+			Limit(1).Find(&neighbour)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected == 0 {
+			return "", errNeighbourNotFound
+		}
+		return neighbour.Position, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		after, err := neighbourPosition(afterID)
+		if err != nil {
+			return err
+		}
+		before, err := neighbourPosition(beforeID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case afterID != nil && beforeID == nil:
+			before, err = models.NoteNeighbourPosition(tx, note, after, true)
+		case beforeID != nil && afterID == nil:
+			after, err = models.NoteNeighbourPosition(tx, note, before, false)
+		}
+		if err != nil {
+			return err
+		}
+
+		position, err := ordering.Between(after, before)
+		if err == nil {
+			note.Position = position
+			return updateNoteColumn(tx, note, "position", position)
+		}
+		if afterID != nil && beforeID != nil && after > before {
+			return errNeighbourOrder
+		}
+		// Совпадающие или поврежденные ключи исправляются перестройкой порядка блокнота
+		if attempt > 0 {
+			return err
+		}
+		group := models.NotePositionGroup{UserID: note.UserID, WorkspaceID: note.WorkspaceID, NotebookID: note.NotebookID}
+		if err := models.RebalanceNotePositions(tx, group); err != nil {
+			return err
+		}
+	}
+}
+
+// updateNoteColumn меняет колонку заметки без изменения времени правки и увеличивает версию
+func updateNoteColumn(tx *gorm.DB, note *models.Note, column string, value interface{}) error {
+	err := tx.Model(&models.Note{}).Where("id = ?", note.ID).
+		UpdateColumns(map[string]interface{}{column: value, "version": models.NoteVersionIncrement()}).Error
+	if err != nil {
+		return err
+	}
+	note.Version++
+	return nil
+}
+
+// checkNoteParent проверяет, что родитель находится в пространстве заметки и не является
+// самой заметкой или ее потомком
+func checkNoteParent(tx *gorm.DB, note *models.Note, parentID uint) error {
+	var count int64
+	if err := tx.Model(&models.Note{}).Scopes(models.NoteSpace(note).Notes).Where("notes.id = ?", parentID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errParentNotFound
+	}
+
+	ids, err := models.SubtreeNoteIDs(tx, models.NoteSpace(note), note.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == parentID {
+			return errNoteCycle
+		}
+	}
+	return nil
+}
+
+// visibleSubtree оставляет из поддерева, упорядоченного от корня, заметки, которые
+// пользователь может читать и родители которых тоже остались в выборке
+func visibleSubtree(tx *gorm.DB, notes []models.Note, userID uint) ([]models.Note, error) {
+	access, err := models.NotesAccessFor(tx, notes, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]models.Note, 0, len(notes))
+	kept := make(map[uint]bool, len(notes))
+	for i, note := range notes {
+		if access[note.ID] < models.NoteAccessView {
+			continue
+		}
+		if i > 0 && (note.ParentID == nil || !kept[*note.ParentID]) {
+			continue
+		}
+		kept[note.ID] = true
+		visible = append(visible, note)
+	}
+	return visible, nil
+}
+
+// loadNoteSubtree загружает заметку и всех ее потомков с тегами в порядке обхода в ширину
+func loadNoteSubtree(tx *gorm.DB, note *models.Note) ([]models.Note, error) {
+	ids, err := models.SubtreeNoteIDs(tx, models.NoteSpace(note), note.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []models.Note
+	if err := tx.Preload("Tags").Where("id IN ?", ids).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+
+	order := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		order[id] = i
+	}
+	sorted := make([]models.Note, len(notes))
+	for _, n := range notes {
+		sorted[order[n.ID]] = n
+	}
+	return sorted, nil
+}
+
+// exportNoteNode дополняет узел дерева содержимым заметок
+func exportNoteNode(node *models.NoteNode, notes map[uint]*models.Note) *ExportedNote {
+	note := notes[node.ID]
+	exported := &ExportedNote{
+		ID:        note.ID,
+		Title:     note.Title,
+		Content:   note.Content,
+		Tags:      []string{},
+		CreatedAt: note.CreatedAt,
+		UpdatedAt: note.UpdatedAt,
+		Children:  make([]*ExportedNote, 0, len(node.Children)),
+	}
+	for _, tag := range note.Tags {
+		exported.Tags = append(exported.Tags, tag.Name)
+	}
+	for _, child := range node.Children {
+		exported.Children = append(exported.Children, exportNoteNode(child, notes))
+	}
+	return exported
+}
+
+// writeNoteMarkdown выводит заметку заголовком уровня level, а потомков — уровнем ниже
+func writeNoteMarkdown(b *strings.Builder, note *ExportedNote, level int) {
+	// В Markdown всего шесть уровней заголовков
+	if level > 6 {
+		level = 6
+	}
+	b.WriteString(strings.Repeat("#", level))
+	b.WriteString(" ")
+	b.WriteString(note.Title)
+	b.WriteString("\n\n")
+	if content := strings.TrimSpace(note.Content); content != "" {
+		b.WriteString(content)
+		b.WriteString("\n\n")
+	}
+	for _, child := range note.Children {
+		writeNoteMarkdown(b, child, level+1)
+	}
+}
+
+// duplicateTitle возвращает заголовок копии, укладываясь в ограничение длины колонки
+func duplicateTitle(title string) string {
+	const suffix = " (копия)"
+	runes := []rune(title)
+	if limit := 255 - len([]rune(suffix)); len(runes) > limit {
+		runes = runes[:limit]
+	}
+	return string(runes) + suffix
+}
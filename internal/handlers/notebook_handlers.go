@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// Ошибки операций с блокнотами
+var (
+	// errNotebookNotFound возвращается, если блокнот не существует или принадлежит другому пространству
+	errNotebookNotFound = errors.New("блокнот не найден")
+	// errNotebookNotesAccess возвращается, если в корзину пришлось бы переместить чужие заметки
+	errNotebookNotesAccess = errors.New("переместить в корзину заметки коллег могут только администраторы")
+)
+
+// NotebookRequest представляет данные для создания или переименования блокнота
+type NotebookRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// MoveNotesRequest представляет данные для переноса заметок в блокнот
+type MoveNotesRequest struct {
+	NoteIDs []uint `json:"note_ids" binding:"required,min=1"`
+}
+
+// NotebookWithCount представляет блокнот с количеством заметок в нем
+type NotebookWithCount struct {
+	models.Notebook
+	NoteCount int64 `json:"note_count"`
+}
+
+// CreateNotebook создает новый блокнот
+func CreateNotebook(c *gin.Context) {
+	var req NotebookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "имя блокнота не может быть пустым"})
+		return
+	}
+
+	notebook := models.Notebook{
+		Name:        name,
+		UserID:      userID.(uint),
+		WorkspaceID: currentSpace(c).WorkspaceID,
+	}
+	if err := database.GetDB().Create(&notebook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании блокнота"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "блокнот успешно создан",
+		"notebook": notebook,
+	})
+}
+
+// GetNotebooks возвращает блокноты активного пространства с количеством заметок
+func GetNotebooks(c *gin.Context) {
+	space := currentSpace(c)
+
+	// Блокнот по умолчанию создается при первом обращении, чтобы он всегда был в списке
+	defaultNotebook, err := models.DefaultNotebook(database.GetDB(), space)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении блокнотов"})
+		return
+	}
+
+	var notebooks []NotebookWithCount
+	err = database.GetDB().
+		Table("notebooks").
+		Select("notebooks.*, COUNT(notes.id) AS note_count").
+		// Личные заметки без блокнота учитываются в блокноте по умолчанию
+		Joins(`LEFT JOIN notes ON notes.deleted_at IS NULL AND (notes.notebook_id = notebooks.id
+			OR (notes.notebook_id IS NULL AND notebooks.id = ? AND notes.user_id = notebooks.user_id AND notes.workspace_id IS NULL))`, defaultNotebook.ID).
+		Scopes(space.Notebooks).
+		Group("notebooks.id").
+		Order("notebooks.is_default DESC, notebooks.name").
+		Scan(&notebooks).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении блокнотов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notebooks": notebooks,
+	})
+}
+
+// GetNotebook возвращает блокнот по ID
+func GetNotebook(c *gin.Context) {
+	notebook, ok := findUserNotebook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notebook": notebook,
+	})
+}
+
+// UpdateNotebook переименовывает блокнот
+func UpdateNotebook(c *gin.Context) {
+	notebook, ok := findUserNotebook(c)
+	if !ok {
+		return
+	}
+
+	var req NotebookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "имя блокнота не может быть пустым"})
+		return
+	}
+
+	notebook.Name = name
+	if err := database.GetDB().Save(notebook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при обновлении блокнота"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "блокнот успешно обновлен",
+		"notebook": notebook,
+	})
+}
+
+// DeleteNotebook удаляет блокнот. Параметр notes определяет судьбу его заметок:
+// move (по умолчанию) переносит их в блокнот по умолчанию, trash перемещает их в корзину
+func DeleteNotebook(c *gin.Context) {
+	notebook, ok := findUserNotebook(c)
+	if !ok {
+		return
+	}
+
+	if notebook.IsDefault {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "блокнот по умолчанию нельзя удалить"})
+		return
+	}
+
+	mode := c.DefaultQuery("notes", models.NotebookDeleteMove)
+	if mode != models.NotebookDeleteMove && mode != models.NotebookDeleteTrash {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "параметр notes должен быть move или trash"})
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Участник может отправить в корзину только свои заметки, как и при удалении по одной
+		if mode == models.NotebookDeleteTrash && !managesSpace(c) {
+			var foreign int64
+			if err := tx.Model(&models.Note{}).
+				Where("notebook_id = ? AND user_id <> ?", notebook.ID, c.GetUint("user_id")).
+				Count(&foreign).Error; err != nil {
+				return err
+			}
+			if foreign > 0 {
+				return errNotebookNotesAccess
+			}
+		}
+		return models.DeleteNotebook(tx, notebook, mode)
+	})
+	if errors.Is(err, errNotebookNotesAccess) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении блокнота"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "блокнот успешно удален",
+	})
+}
+
+// GetNotebookNotes возвращает заметки блокнота постранично
+func GetNotebookNotes(c *gin.Context) {
+	notebook, ok := findUserNotebook(c)
+	if !ok {
+		return
+	}
+
+	query := database.GetDB().Scopes(models.NotebookSpace(notebook).Notes)
+	if notebook.IsDefault {
+		query = query.Where("notes.notebook_id = ? OR notes.notebook_id IS NULL", notebook.ID)
+	} else {
+		query = query.Where("notes.notebook_id = ?", notebook.ID)
+	}
+
+	// Фильтры, сортировка и постраничный вывод работают так же, как в общем списке заметок
+	notes, meta, ok := listNotes(c, query, false)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notebook": notebook,
+		"notes":    notes,
+		"meta":     meta,
+	})
+}
+
+// MoveNotesToNotebook переносит перечисленные заметки пространства в блокнот. Участник
+// рабочего пространства переносит только свои заметки, администратор — любые.
+func MoveNotesToNotebook(c *gin.Context) {
+	notebook, ok := findUserNotebook(c)
+	if !ok {
+		return
+	}
+
+	var req MoveNotesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Переносим только доступные заметки того же пространства; остальные ID считаются отсутствующими
+	query := database.GetDB().Model(&models.Note{}).
+		Scopes(models.NotebookSpace(notebook).Notes).
+		Where("notes.id IN ?", req.NoteIDs)
+	if !managesSpace(c) {
+		query = query.Where("notes.user_id = ?", c.GetUint("user_id"))
+	}
+	result := query.Updates(map[string]interface{}{"notebook_id": notebook.ID, "version": models.NoteVersionIncrement()})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при переносе заметок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "заметки успешно перенесены",
+		"moved":   result.RowsAffected,
+	})
+}
+
+// findUserNotebook загружает блокнот активного пространства по ID из URL
+func findUserNotebook(c *gin.Context) (*models.Notebook, bool) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return nil, false
+	}
+
+	// Получаем ID блокнота из URL
+	notebookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID блокнота"})
+		return nil, false
+	}
+
+	var notebook models.Notebook
+	result := database.GetDB().Scopes(currentSpace(c).Notebooks).Where("notebooks.id = ?", notebookID).First(&notebook)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "блокнот не найден"})
+		return nil, false
+	}
+
+	return &notebook, true
+}
+
+// resolveNotebook возвращает блокнот пространства по ID или блокнот по умолчанию, если ID не указан
+func resolveNotebook(tx *gorm.DB, space models.Space, notebookID *uint) (*models.Notebook, error) {
+	if notebookID == nil {
+		return models.DefaultNotebook(tx, space)
+	}
+
+	var notebook models.Notebook
+	result := tx.Scopes(space.Notebooks).Where("notebooks.id = ?", *notebookID).Limit(1).Find(&notebook)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errNotebookNotFound
+	}
+	return &notebook, nil
+}
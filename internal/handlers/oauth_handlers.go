@@ -0,0 +1,586 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// OAuthClientRequest представляет данные для регистрации стороннего приложения
+type OAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthAuthorizeRequest представляет параметры запроса авторизации (RFC 6749, раздел 4.1.1)
+type OAuthAuthorizeRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// OAuthConsentRequest представляет решение пользователя на экране согласия
+type OAuthConsentRequest struct {
+	OAuthAuthorizeRequest
+	Approve bool `json:"approve"`
+}
+
+// oauthError описывает ошибку в формате OAuth2 (RFC 6749, раздел 5.2)
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+// authorizationGrant — проверенный запрос авторизации
+type authorizationGrant struct {
+	client      *models.OAuthClient
+	redirectURI string
+	scopes      []string
+}
+
+// RegisterOAuthClient регистрирует стороннее приложение текущего пользователя
+func RegisterOAuthClient(c *gin.Context) {
+	var req OAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	for _, redirectURI := range req.RedirectURIs {
+		if err := auth.ValidateRedirectURI(redirectURI); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = auth.SupportedScopes
+	}
+	if _, err := auth.ParseScopes(strings.Join(scopes, " ")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	clientID, err := auth.GenerateRandomString(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при регистрации приложения"})
+		return
+	}
+
+	client := models.OAuthClient{
+		ClientID:     clientID,
+		Name:         req.Name,
+		RedirectURIs: req.RedirectURIs,
+		Scopes:       scopes,
+		Confidential: req.Confidential,
+		UserID:       userID.(uint),
+	}
+
+	// Секрет выдается только конфиденциальным клиентам и показывается один раз
+	var secret string
+	if req.Confidential {
+		secret, client.SecretHash, err = auth.GenerateOpaqueToken(auth.ClientSecretPrefix)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при регистрации приложения"})
+			return
+		}
+	}
+
+	if err := database.GetDB().Create(&client).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при регистрации приложения"})
+		return
+	}
+
+	response := gin.H{
+		"message": "приложение успешно зарегистрировано",
+		"client":  client,
+	}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetOAuthClients возвращает приложения, зарегистрированные текущим пользователем
+func GetOAuthClients(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var clients []models.OAuthClient
+	if err := database.GetDB().Where("user_id = ?", userID).Order("id").Find(&clients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении приложений"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"clients": clients,
+	})
+}
+
+// DeleteOAuthClient удаляет приложение вместе со всеми выданными ему токенами
+func DeleteOAuthClient(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	clientID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID приложения"})
+		return
+	}
+
+	var client models.OAuthClient
+	result := database.GetDB().Where("id = ? AND user_id = ?", clientID, userID).First(&client)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "приложение не найдено"})
+		return
+	}
+
+	// Коды и токены удаляются каскадно по внешнему ключу
+	if err := database.GetDB().Delete(&client).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении приложения"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "приложение успешно удалено",
+	})
+}
+
+// OAuthAuthorize проверяет запрос авторизации и возвращает данные для экрана согласия
+func OAuthAuthorize(c *gin.Context) {
+	var req OAuthAuthorizeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	grant, oerr := validateAuthorizeRequest(&req)
+	if oerr != nil {
+		respondOAuthError(c, oerr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"client": gin.H{
+			"client_id": grant.client.ClientID,
+			"name":      grant.client.Name,
+		},
+		"scopes":       grant.scopes,
+		"redirect_uri": grant.redirectURI,
+		"state":        req.State,
+	})
+}
+
+// OAuthConsent принимает решение пользователя и возвращает адрес перенаправления
+// с кодом авторизации или ошибкой access_denied
+func OAuthConsent(c *gin.Context) {
+	var req OAuthConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "error_description": err.Error()})
+		return
+	}
+
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	grant, oerr := validateAuthorizeRequest(&req.OAuthAuthorizeRequest)
+	if oerr != nil {
+		respondOAuthError(c, oerr)
+		return
+	}
+
+	params := url.Values{}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	if !req.Approve {
+		params.Set("error", "access_denied")
+		params.Set("error_description", "пользователь отклонил запрос")
+		c.JSON(http.StatusOK, gin.H{"redirect_uri": appendQuery(grant.redirectURI, params)})
+		return
+	}
+
+	code, codeHash, err := auth.GenerateOpaqueToken("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	authCode := models.OAuthCode{
+		CodeHash:      codeHash,
+		ClientID:      grant.client.ID,
+		UserID:        userID.(uint),
+		RedirectURI:   grant.redirectURI,
+		Scopes:        grant.scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(auth.AuthorizationCodeTTL),
+	}
+	if err := database.GetDB().Create(&authCode).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	params.Set("code", code)
+	c.JSON(http.StatusOK, gin.H{"redirect_uri": appendQuery(grant.redirectURI, params)})
+}
+
+// OAuthToken выдает токены по коду авторизации или токену обновления (RFC 6749, раздел 4.1.3 и 6)
+func OAuthToken(c *gin.Context) {
+	// Ответы эндпоинта токенов не должны кэшироваться
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	client, oerr := authenticateOAuthClient(c)
+	if oerr != nil {
+		respondOAuthError(c, oerr)
+		return
+	}
+
+	switch c.PostForm("grant_type") {
+	case "authorization_code":
+		exchangeAuthorizationCode(c, client)
+	case "refresh_token":
+		exchangeRefreshToken(c, client)
+	default:
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "unsupported_grant_type", "неподдерживаемый grant_type"})
+	}
+}
+
+// OAuthIntrospect сообщает состояние токена (RFC 7662).
+// Клиент может узнать состояние только собственных токенов.
+func OAuthIntrospect(c *gin.Context) {
+	client, oerr := authenticateOAuthClient(c)
+	if oerr != nil {
+		respondOAuthError(c, oerr)
+		return
+	}
+
+	token, isRefresh := findClientToken(client, c.PostForm("token"))
+	if token == nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	now := time.Now()
+	active, expiresAt, tokenType := token.AccessActive(now), token.AccessExpiresAt, "access_token"
+	if isRefresh {
+		active, expiresAt, tokenType = token.RefreshActive(now), token.RefreshExpiresAt, "refresh_token"
+	}
+	if !active {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, token.UserID).Error; err != nil || user.IsSuspended() {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"active":     true,
+		"scope":      strings.Join(token.Scopes, " "),
+		"client_id":  client.ClientID,
+		"username":   user.Username,
+		"sub":        strconv.FormatUint(uint64(user.ID), 10),
+		"token_type": tokenType,
+		"exp":        expiresAt.Unix(),
+		"iat":        token.CreatedAt.Unix(),
+	})
+}
+
+// OAuthRevoke отзывает токен доступа или обновления вместе с парным токеном (RFC 7009)
+func OAuthRevoke(c *gin.Context) {
+	client, oerr := authenticateOAuthClient(c)
+	if oerr != nil {
+		respondOAuthError(c, oerr)
+		return
+	}
+
+	// По RFC 7009 неизвестный токен не считается ошибкой
+	if token, _ := findClientToken(client, c.PostForm("token")); token != nil && token.RevokedAt == nil {
+		if err := database.GetDB().Model(token).Update("revoked_at", time.Now()).Error; err != nil {
+			respondOAuthError(c, &oauthError{http.StatusInternalServerError, "server_error", "ошибка при отзыве токена"})
+			return
+		}
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// exchangeAuthorizationCode обменивает одноразовый код на пару токенов с проверкой PKCE
+func exchangeAuthorizationCode(c *gin.Context, client *models.OAuthClient) {
+	var authCode models.OAuthCode
+	result := database.GetDB().Where("code_hash = ? AND client_id = ?", auth.HashToken(c.PostForm("code")), client.ID).First(&authCode)
+	if result.Error != nil {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "код авторизации недействителен"})
+		return
+	}
+
+	// Код одноразовый: удаляем его до проверок, чтобы повторное использование было невозможно
+	deleted := database.GetDB().Delete(&authCode)
+	if deleted.Error != nil || deleted.RowsAffected == 0 {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "код авторизации недействителен"})
+		return
+	}
+
+	if time.Now().After(authCode.ExpiresAt) {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "срок действия кода авторизации истек"})
+		return
+	}
+	if c.PostForm("redirect_uri") != authCode.RedirectURI {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "redirect_uri не совпадает с запросом авторизации"})
+		return
+	}
+	if !auth.VerifyPKCE(c.PostForm("code_verifier"), authCode.CodeChallenge) {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "неверный code_verifier"})
+		return
+	}
+
+	issueOAuthTokens(c, client, authCode.UserID, authCode.Scopes, nil)
+}
+
+// exchangeRefreshToken выдает новую пару токенов, отзывая использованный токен обновления
+func exchangeRefreshToken(c *gin.Context, client *models.OAuthClient) {
+	var token models.OAuthToken
+	result := database.GetDB().Where("refresh_token_hash = ? AND client_id = ?", auth.HashToken(c.PostForm("refresh_token")), client.ID).First(&token)
+	if result.Error != nil || !token.RefreshActive(time.Now()) {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "токен обновления недействителен"})
+		return
+	}
+
+	// Новый токен может получить только часть исходных прав
+	scopes := token.Scopes
+	if scope := c.PostForm("scope"); scope != "" {
+		requested, err := auth.ParseScopes(scope)
+		if err != nil || !auth.ScopesSubset(requested, token.Scopes) {
+			respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_scope", "запрошены области доступа сверх выданных"})
+			return
+		}
+		scopes = requested
+	}
+
+	issueOAuthTokens(c, client, token.UserID, scopes, &token)
+}
+
+// issueOAuthTokens создает пару токенов и отвечает в формате RFC 6749, раздел 5.1.
+// Если передан previous, он отзывается в той же транзакции (ротация токенов обновления).
+func issueOAuthTokens(c *gin.Context, client *models.OAuthClient, userID uint, scopes []string, previous *models.OAuthToken) {
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil || user.IsSuspended() {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "учетная запись недоступна"})
+		return
+	}
+
+	accessToken, accessHash, err := auth.GenerateOpaqueToken(auth.AccessTokenPrefix)
+	if err != nil {
+		respondOAuthError(c, &oauthError{http.StatusInternalServerError, "server_error", "ошибка при создании токена"})
+		return
+	}
+	refreshToken, refreshHash, err := auth.GenerateOpaqueToken(auth.RefreshTokenPrefix)
+	if err != nil {
+		respondOAuthError(c, &oauthError{http.StatusInternalServerError, "server_error", "ошибка при создании токена"})
+		return
+	}
+
+	now := time.Now()
+	token := models.OAuthToken{
+		AccessTokenHash:  accessHash,
+		RefreshTokenHash: refreshHash,
+		ClientID:         client.ID,
+		UserID:           userID,
+		Scopes:           scopes,
+		AccessExpiresAt:  now.Add(auth.AccessTokenTTL),
+		RefreshExpiresAt: now.Add(auth.RefreshTokenTTL),
+	}
+
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if previous != nil {
+			// Условие на revoked_at защищает от одновременного использования одного токена обновления
+			result := tx.Model(previous).Where("revoked_at IS NULL").Update("revoked_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errRefreshTokenReused
+			}
+		}
+		return tx.Create(&token).Error
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		respondOAuthError(c, &oauthError{http.StatusBadRequest, "invalid_grant", "токен обновления уже использован"})
+		return
+	}
+	if err != nil {
+		respondOAuthError(c, &oauthError{http.StatusInternalServerError, "server_error", "ошибка при создании токена"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(auth.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         strings.Join(scopes, " "),
+	})
+}
+
+var errRefreshTokenReused = errors.New("токен обновления уже использован")
+
+// validateAuthorizeRequest проверяет клиента, redirect_uri, области доступа и параметры PKCE
+func validateAuthorizeRequest(req *OAuthAuthorizeRequest) (*authorizationGrant, *oauthError) {
+	if req.ResponseType != "code" {
+		return nil, &oauthError{http.StatusBadRequest, "unsupported_response_type", "поддерживается только response_type=code"}
+	}
+
+	var client models.OAuthClient
+	if err := database.GetDB().Where("client_id = ?", req.ClientID).First(&client).Error; err != nil {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_client", "приложение не найдено"}
+	}
+
+	// redirect_uri должен в точности совпадать с одним из зарегистрированных
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	registered := false
+	for _, uri := range client.RedirectURIs {
+		if uri == redirectURI {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_request", "redirect_uri не зарегистрирован для приложения"}
+	}
+	// Адреса, зарегистрированные до ужесточения проверки, больше не принимаются
+	if err := auth.ValidateRedirectURI(redirectURI); err != nil {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_request", err.Error()}
+	}
+
+	scopes, err := auth.ParseScopes(req.Scope)
+	if err != nil {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_scope", err.Error()}
+	}
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	if !auth.ScopesSubset(scopes, client.Scopes) {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_scope", "приложению не разрешены запрошенные области доступа"}
+	}
+
+	// PKCE обязателен для всех клиентов
+	if req.CodeChallengeMethod != auth.PKCEMethodS256 || len(req.CodeChallenge) < 43 || len(req.CodeChallenge) > 128 {
+		return nil, &oauthError{http.StatusBadRequest, "invalid_request", "требуется code_challenge с методом S256"}
+	}
+
+	return &authorizationGrant{client: &client, redirectURI: redirectURI, scopes: scopes}, nil
+}
+
+// authenticateOAuthClient проверяет клиента по HTTP Basic или параметрам формы.
+// Публичные клиенты передают только client_id и защищены PKCE.
+func authenticateOAuthClient(c *gin.Context) (*models.OAuthClient, *oauthError) {
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		clientID = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+
+	invalid := &oauthError{http.StatusUnauthorized, "invalid_client", "неверные учетные данные приложения"}
+
+	var client models.OAuthClient
+	if clientID == "" || database.GetDB().Where("client_id = ?", clientID).First(&client).Error != nil {
+		return nil, invalid
+	}
+
+	if client.Confidential {
+		hash := auth.HashToken(secret)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) != 1 {
+			return nil, invalid
+		}
+	}
+
+	return &client, nil
+}
+
+// findClientToken ищет токен клиента по значению токена доступа или обновления
+func findClientToken(client *models.OAuthClient, value string) (*models.OAuthToken, bool) {
+	if value == "" {
+		return nil, false
+	}
+
+	column, isRefresh := "access_token_hash", false
+	if strings.HasPrefix(value, auth.RefreshTokenPrefix) {
+		column, isRefresh = "refresh_token_hash", true
+	}
+
+	var token models.OAuthToken
+	if err := database.GetDB().Where(column+" = ? AND client_id = ?", auth.HashToken(value), client.ID).First(&token).Error; err != nil {
+		return nil, false
+	}
+	return &token, isRefresh
+}
+
+// appendQuery добавляет параметры к адресу перенаправления, сохраняя его собственные параметры
+func appendQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func respondOAuthError(c *gin.Context, err *oauthError) {
+	if err.status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(err.status, gin.H{
+		"error":             err.code,
+		"error_description": err.description,
+	})
+}
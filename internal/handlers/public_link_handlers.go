@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/ratelimit"
+	"gorm.io/gorm"
+)
+
+// PublicLinkRequest представляет параметры новой публичной ссылки
+type PublicLinkRequest struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password"`
+	Snapshot  bool       `json:"snapshot"`
+}
+
+// PublicNote представляет заметку, показанную по публичной ссылке
+type PublicNote struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Snapshot  bool      `json:"snapshot"`
+}
+
+// publicLinkPasswordHeader — заголовок с паролем ссылки для JSON-клиентов
+const publicLinkPasswordHeader = "X-Link-Password"
+
+// Ограничения подбора паролей публичных ссылок: неудачные попытки считаются отдельно
+// для каждой ссылки и для каждого IP-адреса
+var (
+	publicLinkPasswordLimiter = ratelimit.New(10, 15*time.Minute)
+	publicLinkClientLimiter   = ratelimit.New(30, 15*time.Minute)
+)
+
+// publicNoteTemplate — HTML-страница заметки и форма ввода пароля
+var publicNoteTemplate = template.Must(template.New("public_note").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Note}}{{.Note.Title}}{{else}}Заметка{{end}}</title>
+<style>
+body { font-family: sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.5; }
+.content { white-space: pre-wrap; }
+.meta, .error { color: #666; font-size: 0.9rem; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+{{if .Note}}
+<h1>{{.Note.Title}}</h1>
+<p class="meta">{{if .Note.Snapshot}}Копия от{{else}}Обновлено{{end}} {{.Note.UpdatedAt.Format "02.01.2006 15:04"}}</p>
+<div class="content">{{.Note.Content}}</div>
+{{else}}
+<h1>Заметка защищена паролем</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post">
+<input type="password" name="password" autofocus required>
+<button type="submit">Открыть</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// CreatePublicLink создает публичную ссылку на заметку. Токен возвращается только в этом ответе.
+func CreatePublicLink(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+
+	var req PublicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at должен быть в будущем"})
+		return
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken(models.PublicLinkTokenPrefix)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании ссылки"})
+		return
+	}
+
+	link := models.PublicLink{
+		NoteID:    note.ID,
+		UserID:    note.UserID,
+		TokenHash: tokenHash,
+		Snapshot:  req.Snapshot,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if req.Snapshot {
+		link.SnapshotTitle = note.Title
+		link.SnapshotContent = note.Content
+	}
+	if err := link.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании ссылки"})
+		return
+	}
+	if err := database.GetDB().Create(&link).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании ссылки"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "публичная ссылка создана",
+		"link":    link,
+		"token":   token,
+		"url":     publicURL("/p/" + token),
+	})
+}
+
+// GetPublicLinks возвращает публичные ссылки заметки, включая отозванные и истекшие
+func GetPublicLinks(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+
+	var links []models.PublicLink
+	if err := database.GetDB().Where("note_id = ?", note.ID).Order("id DESC").Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении ссылок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"links": links,
+	})
+}
+
+// RevokePublicLink отзывает публичную ссылку; повторный отзыв ничего не меняет
+func RevokePublicLink(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessOwner)
+	if !ok {
+		return
+	}
+
+	linkID, err := strconv.ParseUint(c.Param("link_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID ссылки"})
+		return
+	}
+
+	var link models.PublicLink
+	if err := database.GetDB().Where("id = ? AND note_id = ?", linkID, note.ID).First(&link).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "ссылка не найдена"})
+		return
+	}
+	if link.RevokedAt == nil {
+		now := time.Now()
+		link.RevokedAt = &now
+		if err := database.GetDB().Model(&link).Update("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при отзыве ссылки"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "ссылка отозвана",
+		"link":    link,
+	})
+}
+
+// ViewPublicLink показывает заметку по публичной ссылке без аутентификации.
+// Формат выбирается параметром format (json или html) или заголовком Accept.
+// Пароль передается в заголовке X-Link-Password или полем password формы (POST).
+func ViewPublicLink(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Robots-Tag", "noindex")
+
+	asHTML := c.Query("format") == "html" ||
+		c.Query("format") == "" && c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+	fail := func(status int, message string) {
+		if asHTML {
+			c.Data(status, "text/plain; charset=utf-8", []byte(message))
+			return
+		}
+		c.JSON(status, gin.H{"error": message})
+	}
+
+	token := c.Param("token")
+	if !strings.HasPrefix(token, models.PublicLinkTokenPrefix) {
+		fail(http.StatusNotFound, "ссылка не найдена")
+		return
+	}
+
+	var link models.PublicLink
+	if err := database.GetDB().Where("token_hash = ?", auth.HashToken(token)).First(&link).Error; err != nil {
+		fail(http.StatusNotFound, "ссылка не найдена")
+		return
+	}
+	if !link.Active(time.Now()) {
+		fail(http.StatusGone, "ссылка отозвана или срок ее действия истек")
+		return
+	}
+
+	if link.HasPassword {
+		password := c.GetHeader(publicLinkPasswordHeader)
+		if c.Request.Method == http.MethodPost {
+			password = c.PostForm("password")
+		}
+		now := time.Now()
+		linkKey, clientKey := strconv.FormatUint(uint64(link.ID), 10), c.ClientIP()
+		if password != "" {
+			allowed, retryLink := publicLinkPasswordLimiter.Allow(linkKey, now)
+			allowedClient, retryClient := publicLinkClientLimiter.Allow(clientKey, now)
+			if !allowed || !allowedClient {
+				c.Header("Retry-After", strconv.Itoa(int(max(retryLink, retryClient).Seconds())+1))
+				fail(http.StatusTooManyRequests, "слишком много попыток ввода пароля, повторите позже")
+				return
+			}
+		}
+		if password == "" || !link.CheckPassword(password) {
+			if password != "" {
+				publicLinkPasswordLimiter.Fail(linkKey, now)
+				publicLinkClientLimiter.Fail(clientKey, now)
+			}
+			message := "требуется пароль"
+			if password != "" {
+				message = "неверный пароль"
+			}
+			if asHTML {
+				c.Header("Content-Type", "text/html; charset=utf-8")
+				c.Status(http.StatusUnauthorized)
+				data := gin.H{}
+				if password != "" {
+					data["Error"] = message
+				}
+				_ = publicNoteTemplate.Execute(c.Writer, data)
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+			return
+		}
+	}
+
+	// Ссылка, в том числе на копию, перестает работать, когда заметка уходит в корзину
+	var note models.Note
+	if err := database.GetDB().First(&note, link.NoteID).Error; err != nil {
+		fail(http.StatusNotFound, "заметка не найдена")
+		return
+	}
+	public := PublicNote{Title: note.Title, Content: note.Content, UpdatedAt: note.UpdatedAt}
+	if link.Snapshot {
+		public = PublicNote{Title: link.SnapshotTitle, Content: link.SnapshotContent, UpdatedAt: link.CreatedAt, Snapshot: true}
+	}
+
+	err := database.GetDB().Model(&link).UpdateColumns(map[string]interface{}{
+		"view_count":     gorm.Expr("view_count + 1"),
+		"last_viewed_at": time.Now(),
+	}).Error
+	if err != nil {
+		fail(http.StatusInternalServerError, "ошибка при получении заметки")
+		return
+	}
+
+	if asHTML {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		_ = publicNoteTemplate.Execute(c.Writer, gin.H{"Note": public})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"note": public,
+	})
+}
+
+// publicURL возвращает адрес страницы сервиса для ссылок, которые открываются без
+// учетной записи; без PUBLIC_BASE_URL адрес относительный
+func publicURL(path string) string {
+	return strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/") + path
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/diff"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// GetNoteRevisions возвращает историю версий заметки без содержимого
+func GetNoteRevisions(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+
+	var revisions []models.NoteRevision
+	err := database.GetDB().
+		Select("id, note_id, number, author_id, title, created_at, updated_at").
+		Where("note_id = ?", note.ID).
+		Order("number DESC").
+		Find(&revisions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении истории версий"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revisions": revisions,
+	})
+}
+
+// GetNoteRevision возвращает версию заметки по номеру
+func GetNoteRevision(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+
+	revision, ok := findNoteRevision(c, note.ID, c.Param("rev"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revision": revision,
+	})
+}
+
+// DiffNoteRevisions сравнивает две версии заметки. Параметры from и to — номера версий
+// (по умолчанию to — последняя), mode — line (по умолчанию) или word.
+func DiffNoteRevisions(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+
+	mode := c.DefaultQuery("mode", "line")
+	if mode != "line" && mode != "word" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode должен быть line или word"})
+		return
+	}
+
+	if c.Query("from") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не указана исходная версия from"})
+		return
+	}
+	from, ok := findNoteRevision(c, note.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+
+	var to *models.NoteRevision
+	if c.Query("to") != "" {
+		if to, ok = findNoteRevision(c, note.ID, c.Query("to")); !ok {
+			return
+		}
+	} else {
+		var latest models.NoteRevision
+		if err := database.GetDB().Where("note_id = ?", note.ID).Order("number DESC").First(&latest).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении версии"})
+			return
+		}
+		to = &latest
+	}
+
+	compare := diff.Lines
+	if mode == "word" {
+		compare = diff.Words
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from.Number,
+		"to":      to.Number,
+		"mode":    mode,
+		"title":   diff.Words(from.Title, to.Title),
+		"content": compare(from.Content, to.Content),
+	})
+}
+
+// RestoreNoteRevision возвращает заметку к содержимому указанной версии.
+// Восстановление записывается в историю как новая версия.
+func RestoreNoteRevision(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessEdit)
+	if !ok {
+		return
+	}
+
+	revision, ok := findNoteRevision(c, note.ID, c.Param("rev"))
+	if !ok {
+		return
+	}
+
+	previous := *note
+	note.Title = revision.Title
+	note.Content = revision.Content
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := models.SaveNoteVersion(tx, note); err != nil {
+			return err
+		}
+		if err := models.EnsureBaselineRevision(tx, &previous); err != nil {
+			return err
+		}
+		if err := models.RecordRevision(tx, note, c.GetUint("user_id"), 0); err != nil {
+			return err
+		}
+		if err := models.RebaseSuggestions(tx, note.ID, previous.Content, note.Content); err != nil {
+			return err
+		}
+		return tx.Model(note).Association("Tags").Find(&note.Tags)
+	})
+	if errors.Is(err, models.ErrNoteVersionConflict) {
+		respondNoteConflict(c, note.ID)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при восстановлении версии"})
+		return
+	}
+	collabHub.ApplyExternal(note.ID, previous.Content, note.Content, c.GetUint("user_id"))
+
+	c.Header("ETag", noteETag(note))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "версия заметки восстановлена",
+		"note":    note,
+	})
+}
+
+// findNoteRevision загружает версию заметки по номеру
+func findNoteRevision(c *gin.Context, noteID uint, rev string) (*models.NoteRevision, bool) {
+	number, err := strconv.Atoi(rev)
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный номер версии"})
+		return nil, false
+	}
+
+	var revision models.NoteRevision
+	result := database.GetDB().Where("note_id = ? AND number = ?", noteID, number).First(&revision)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "версия не найдена"})
+		return nil, false
+	}
+
+	return &revision, true
+}
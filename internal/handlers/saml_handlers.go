@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// samlLinkCookie — cookie с nonce, которым ACS проверяет, что ответ IdP на привязку
+// пришел в браузер, начавший ее
+const samlLinkCookie = "saml_link"
+
+// SAMLLinkConfirmRequest представляет запрос на подтверждение привязки входа через IdP
+type SAMLLinkConfirmRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// SAMLMetadata возвращает XML-метаданные поставщика услуг для регистрации в IdP
+func SAMLMetadata(c *gin.Context) {
+	sp, ok := serviceProvider(c)
+	if !ok {
+		return
+	}
+
+	buf, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при формировании метаданных"})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/samlmetadata+xml", buf)
+}
+
+// Ошибки сопоставления утверждения IdP с учетной записью
+var (
+	errSAMLAccountExists = errors.New("учетная запись с этим email уже существует; войдите и привяжите вход через IdP")
+	errSAMLSubjectLinked = errors.New("учетная запись IdP уже привязана к другому пользователю")
+)
+
+// SAMLLogin перенаправляет пользователя на страницу входа IdP
+func SAMLLogin(c *gin.Context) {
+	sp, ok := serviceProvider(c)
+	if !ok {
+		return
+	}
+
+	redirectURL, _, err := samlRedirectURL(sp, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании SAML-запроса"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// SAMLLink начинает привязку входа через IdP к учетной записи текущего пользователя.
+// Возвращает адрес IdP, на который фронтенд должен перейти: браузерный переход
+// не передает заголовок Authorization, поэтому перенаправление не выполняется.
+// Браузер получает HttpOnly cookie с nonce: ответ IdP, пришедший в другой браузер,
+// например по ссылке злоумышленника, не будет принят.
+func SAMLLink(c *gin.Context) {
+	sp, ok := serviceProvider(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	redirectURL, requestID, err := samlRedirectURL(sp, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании SAML-запроса"})
+		return
+	}
+	nonce, nonceHash, err := auth.GenerateOpaqueToken("")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании SAML-запроса"})
+		return
+	}
+
+	link := models.SAMLLinkRequest{
+		UserID:    userID,
+		RequestID: &requestID,
+		NonceHash: nonceHash,
+		ExpiresAt: time.Now().Add(models.SAMLLinkTTL),
+	}
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Новая привязка заменяет незавершенные
+		if err := tx.Where("user_id = ?", userID).Delete(&models.SAMLLinkRequest{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&link).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании SAML-запроса"})
+		return
+	}
+
+	setSAMLLinkCookie(c, nonce, int(models.SAMLLinkTTL/time.Second))
+	c.JSON(http.StatusOK, gin.H{
+		"redirect_url": redirectURL,
+	})
+}
+
+// SAMLConfirmLink привязывает учетную запись IdP к текущему пользователю по токену,
+// который ACS выдал после ответа IdP. Токен одноразовый и принадлежит начавшему привязку.
+func SAMLConfirmLink(c *gin.Context) {
+	var req SAMLLinkConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	var link models.SAMLLinkRequest
+	result := database.GetDB().Where("confirm_hash = ? AND user_id = ?", auth.HashToken(req.Token), userID).First(&link)
+	if result.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "токен подтверждения привязки недействителен"})
+		return
+	}
+
+	// Токен одноразовый: удаляем привязку до проверок, чтобы повторное подтверждение было невозможно
+	deleted := database.GetDB().Delete(&link)
+	if deleted.Error != nil || deleted.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "токен подтверждения привязки недействителен"})
+		return
+	}
+	if time.Now().After(link.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "срок действия привязки истек"})
+		return
+	}
+
+	_, err := linkSAMLUser(userID, &auth.SAMLIdentity{NameID: link.NameID, Email: link.Email})
+	if errors.Is(err, errSAMLSubjectLinked) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при привязке входа через IdP"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "вход через IdP привязан к учетной записи",
+	})
+}
+
+// samlRedirectURL создает запрос аутентификации и возвращает адрес IdP для перехода и ID
+// запроса. ID запроса передаем через подписанный RelayState, чтобы вход не хранил состояние
+// на сервере.
+func samlRedirectURL(sp *saml.ServiceProvider, linkUserID uint) (string, string, error) {
+	req, err := sp.MakeAuthenticationRequest(
+		sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding,
+		saml.HTTPPostBinding,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	relayState, err := auth.SignRelayState(req.ID, linkUserID)
+	if err != nil {
+		return "", "", err
+	}
+
+	redirectURL, err := req.Redirect(relayState, sp)
+	if err != nil {
+		return "", "", err
+	}
+	return redirectURL.String(), req.ID, nil
+}
+
+// setSAMLLinkCookie выдает или, при maxAge < 0, удаляет cookie привязки. Ответ IdP
+// приходит на ACS POST-запросом с другого сайта, поэтому cookie нужен SameSite=None.
+func setSAMLLinkCookie(c *gin.Context, nonce string, maxAge int) {
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(samlLinkCookie, nonce, maxAge, "/api/auth/saml", "", true, true)
+}
+
+// consumeSAMLLink находит привязку, начатую для SAML-запроса requestID, и принимает ответ
+// на него. Ответ принимается один раз и только в браузере с cookie, выданной SAMLLink.
+func consumeSAMLLink(c *gin.Context, requestID string, userID uint) (*models.SAMLLinkRequest, bool) {
+	nonce, _ := c.Cookie(samlLinkCookie)
+	setSAMLLinkCookie(c, "", -1)
+
+	var link models.SAMLLinkRequest
+	result := database.GetDB().Where("request_id = ? AND user_id = ?", requestID, userID).Limit(1).Find(&link)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при привязке входа через IdP"})
+		return nil, false
+	}
+	if result.RowsAffected == 0 || nonce == "" ||
+		subtle.ConstantTimeCompare([]byte(auth.HashToken(nonce)), []byte(link.NonceHash)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "привязка не найдена или начата в другом браузере"})
+		return nil, false
+	}
+
+	// ID запроса одноразовый: сбрасываем его до проверки ответа, чтобы повтор был невозможен
+	consumed := database.GetDB().Model(&link).Where("request_id = ?", requestID).Update("request_id", nil)
+	if consumed.Error != nil || consumed.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "привязка не найдена или начата в другом браузере"})
+		return nil, false
+	}
+	if time.Now().After(link.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "срок действия привязки истек"})
+		return nil, false
+	}
+	return &link, true
+}
+
+// prepareSAMLLink запоминает учетную запись IdP в привязке и выдает токен, которым
+// пользователь подтверждает привязку
+func prepareSAMLLink(link *models.SAMLLinkRequest, identity *auth.SAMLIdentity) (string, error) {
+	if identity.NameID == "" {
+		return "", errors.New("утверждение IdP не содержит NameID")
+	}
+	if err := checkSAMLSubjectFree(link.UserID, identity.NameID); err != nil {
+		return "", err
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken("")
+	if err != nil {
+		return "", err
+	}
+	err = database.GetDB().Model(link).Updates(map[string]interface{}{
+		"confirm_hash": tokenHash,
+		"name_id":      identity.NameID,
+		"email":        identity.Email,
+		"expires_at":   time.Now().Add(models.SAMLLinkTTL),
+	}).Error
+	return token, err
+}
+
+// SAMLACS принимает ответ IdP, проверяет подпись утверждения,
+// создает пользователя при первом входе и выдает обычный JWT-токен
+func SAMLACS(c *gin.Context) {
+	sp, ok := serviceProvider(c)
+	if !ok {
+		return
+	}
+
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный SAML-ответ"})
+		return
+	}
+
+	// Без RelayState ответ считается инициированным IdP и принимается,
+	// только если это разрешено настройкой SAML_ALLOW_IDP_INITIATED
+	var possibleRequestIDs []string
+	var link *models.SAMLLinkRequest
+	if relayState := c.Request.PostForm.Get("RelayState"); relayState != "" {
+		requestID, userID, err := auth.VerifyRelayState(relayState)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный RelayState"})
+			return
+		}
+		possibleRequestIDs = append(possibleRequestIDs, requestID)
+		if userID != 0 {
+			if link, ok = consumeSAMLLink(c, requestID, userID); !ok {
+				return
+			}
+		}
+	}
+
+	assertion, err := sp.ParseResponse(c.Request, possibleRequestIDs)
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			log.Printf("Ошибка проверки SAML-ответа: %v", invalid.PrivateErr)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "недействительный SAML-ответ"})
+		return
+	}
+
+	identity, err := auth.IdentityFromAssertion(assertion)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if link != nil {
+		respondSAMLLink(c, link, identity)
+		return
+	}
+
+	user, err := provisionSAMLUser(identity)
+	if errors.Is(err, errSAMLAccountExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании пользователя"})
+		return
+	}
+
+	if user.IsSuspended() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "учетная запись заблокирована"})
+		return
+	}
+
+	// Генерируем JWT-токен
+	token, err := auth.GenerateToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании токена"})
+		return
+	}
+
+	// Браузерный вход завершаем перенаправлением во фронтенд с токеном во фрагменте URL
+	if redirectURL := os.Getenv("SAML_REDIRECT_URL"); redirectURL != "" {
+		c.Redirect(http.StatusFound, redirectURL+"#token="+url.QueryEscape(token))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "вход выполнен успешно",
+		"user": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
+		},
+		"token": token,
+	})
+}
+
+// respondSAMLLink завершает ответ IdP на привязку: учетная запись IdP не привязывается сразу,
+// а пользователь получает токен, которым подтверждает привязку через SAMLConfirmLink
+func respondSAMLLink(c *gin.Context, link *models.SAMLLinkRequest, identity *auth.SAMLIdentity) {
+	token, err := prepareSAMLLink(link, identity)
+	if errors.Is(err, errSAMLSubjectLinked) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при привязке входа через IdP"})
+		return
+	}
+
+	if redirectURL := os.Getenv("SAML_REDIRECT_URL"); redirectURL != "" {
+		c.Redirect(http.StatusFound, redirectURL+"#saml_link="+url.QueryEscape(token))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "подтвердите привязку входа через IdP",
+		"email":      identity.Email,
+		"link_token": token,
+	})
+}
+
+// serviceProvider возвращает SAML SP или отвечает ошибкой, если SSO не настроен
+func serviceProvider(c *gin.Context) (*saml.ServiceProvider, bool) {
+	sp, err := auth.GetServiceProvider()
+	if errors.Is(err, auth.ErrSAMLNotConfigured) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Ошибка настройки SAML: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "SAML SSO недоступен"})
+		return nil, false
+	}
+	return sp, true
+}
+
+// provisionSAMLUser находит пользователя, привязанного к учетной записи IdP, или создает его
+// при первом входе через SSO. Существующая учетная запись с тем же email привязывается
+// автоматически, только если ее создал IdP через SCIM или администратор разрешил домен
+// в SAML_LINK_DOMAINS; иначе владелец должен привязать вход сам через SAMLLink.
+func provisionSAMLUser(identity *auth.SAMLIdentity) (*models.User, error) {
+	var user models.User
+	if identity.NameID != "" {
+		result := database.GetDB().Where("saml_subject = ?", identity.NameID).Limit(1).Find(&user)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return &user, nil
+		}
+	}
+
+	result := database.GetDB().Where("email = ?", identity.Email).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		// Учетная запись, уже привязанная к другому NameID, автоматически не перепривязывается
+		if user.SAMLSubject != nil || user.ExternalID == nil && !auth.SAMLLinkDomainAllowed(user.Email) {
+			return nil, errSAMLAccountExists
+		}
+		if err := setSAMLSubject(&user, identity); err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+
+	username, err := uniqueUsername(identity.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	// Пароль не передается пользователю: вход возможен только через IdP
+	password, err := auth.GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	user = models.User{
+		Username: username,
+		Email:    identity.Email,
+		Password: password,
+	}
+	if identity.NameID != "" {
+		user.SAMLSubject = &identity.NameID
+	}
+	if err := database.GetDB().Create(&user).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// linkSAMLUser привязывает учетную запись IdP к пользователю, подтвердившему привязку
+func linkSAMLUser(userID uint, identity *auth.SAMLIdentity) (*models.User, error) {
+	if identity.NameID == "" {
+		return nil, errors.New("утверждение IdP не содержит NameID")
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if err := checkSAMLSubjectFree(user.ID, identity.NameID); err != nil {
+		return nil, err
+	}
+
+	if err := setSAMLSubject(&user, identity); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// checkSAMLSubjectFree проверяет, что учетная запись IdP не привязана к другому пользователю
+func checkSAMLSubjectFree(userID uint, nameID string) error {
+	var linked int64
+	err := database.GetDB().Model(&models.User{}).
+		Where("saml_subject = ? AND id <> ?", nameID, userID).
+		Count(&linked).Error
+	if err != nil {
+		return err
+	}
+	if linked > 0 {
+		return errSAMLSubjectLinked
+	}
+	return nil
+}
+
+// setSAMLSubject запоминает NameID IdP у пользователя
+func setSAMLSubject(user *models.User, identity *auth.SAMLIdentity) error {
+	if identity.NameID == "" {
+		return nil
+	}
+	user.SAMLSubject = &identity.NameID
+	return database.GetDB().Model(user).Update("saml_subject", identity.NameID).Error
+}
+
+// uniqueUsername возвращает свободное имя пользователя, добавляя числовой суффикс при совпадении
+func uniqueUsername(base string) (string, error) {
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := database.GetDB().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%d", base, i)
+	}
+}
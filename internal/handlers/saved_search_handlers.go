@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/search"
+)
+
+// SavedSearchRequest представляет данные для создания или изменения сохраненного поиска
+type SavedSearchRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Query string `json:"query" binding:"required"`
+}
+
+// SavedSearchWithCount представляет сохраненный поиск с текущим количеством заметок.
+// Если запрос больше не разбирается, вместо количества возвращается ошибка.
+type SavedSearchWithCount struct {
+	models.SavedSearch
+	NoteCount *int64 `json:"note_count"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CreateSavedSearch сохраняет поисковый запрос под именем
+func CreateSavedSearch(c *gin.Context) {
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	name, query, ok := validateSavedSearch(c, req)
+	if !ok {
+		return
+	}
+
+	savedSearch := models.SavedSearch{
+		Name:   name,
+		Query:  query,
+		UserID: userID.(uint),
+	}
+	if err := database.GetDB().Create(&savedSearch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при сохранении поиска"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "поиск успешно сохранен",
+		"saved_search": savedSearch,
+	})
+}
+
+// GetSavedSearches возвращает сохраненные поиски пользователя с количеством заметок в каждом
+func GetSavedSearches(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var savedSearches []models.SavedSearch
+	if err := database.GetDB().Where("user_id = ?", userID).Order("name, id").Find(&savedSearches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении сохраненных поисков"})
+		return
+	}
+
+	result := make([]SavedSearchWithCount, 0, len(savedSearches))
+	for _, savedSearch := range savedSearches {
+		item := SavedSearchWithCount{SavedSearch: savedSearch}
+		query, err := search.Compile(savedSearch.Query)
+		if err != nil {
+			item.Error = err.Error()
+			result = append(result, item)
+			continue
+		}
+
+		var count int64
+		err = database.GetDB().Model(&models.Note{}).
+			Scopes(currentSpace(c).Notes).
+			Where(query.Where, query.Args...).
+			Count(&count).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении сохраненных поисков"})
+			return
+		}
+		item.NoteCount = &count
+		result = append(result, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"saved_searches": result,
+	})
+}
+
+// GetSavedSearch возвращает сохраненный поиск по ID
+func GetSavedSearch(c *gin.Context) {
+	savedSearch, ok := findUserSavedSearch(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"saved_search": savedSearch,
+	})
+}
+
+// UpdateSavedSearch изменяет имя и запрос сохраненного поиска
+func UpdateSavedSearch(c *gin.Context) {
+	savedSearch, ok := findUserSavedSearch(c)
+	if !ok {
+		return
+	}
+
+	var req SavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, query, ok := validateSavedSearch(c, req)
+	if !ok {
+		return
+	}
+
+	savedSearch.Name = name
+	savedSearch.Query = query
+	if err := database.GetDB().Save(savedSearch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при обновлении сохраненного поиска"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "сохраненный поиск успешно обновлен",
+		"saved_search": savedSearch,
+	})
+}
+
+// DeleteSavedSearch удаляет сохраненный поиск; заметки при этом не затрагиваются
+func DeleteSavedSearch(c *gin.Context) {
+	savedSearch, ok := findUserSavedSearch(c)
+	if !ok {
+		return
+	}
+
+	if err := database.GetDB().Delete(savedSearch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении сохраненного поиска"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "сохраненный поиск успешно удален",
+	})
+}
+
+// GetSavedSearchNotes выполняет сохраненный запрос и возвращает заметки постранично
+// с теми же параметрами сортировки и фильтрации, что и GET /api/notes
+func GetSavedSearchNotes(c *gin.Context) {
+	savedSearch, ok := findUserSavedSearch(c)
+	if !ok {
+		return
+	}
+
+	query, err := search.Compile(savedSearch.Query)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+
+	// Сохраненный поиск выполняется в активном пространстве
+	base := database.GetDB().
+		Scopes(currentSpace(c).Notes).
+		Where(query.Where, query.Args...)
+	// Как и поиск, сохраненный запрос находит архивные заметки
+	notes, meta, ok := listNotes(c, base, true)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"saved_search": savedSearch,
+		"notes":        notes,
+		"meta":         meta,
+	})
+}
+
+// validateSavedSearch проверяет имя и разбирает запрос, чтобы не сохранять ошибочные запросы
+func validateSavedSearch(c *gin.Context, req SavedSearchRequest) (string, string, bool) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "имя сохраненного поиска не может быть пустым"})
+		return "", "", false
+	}
+
+	query := strings.TrimSpace(req.Query)
+	if _, err := search.Compile(query); err != nil {
+		respondSearchError(c, err)
+		return "", "", false
+	}
+
+	return name, query, true
+}
+
+// findUserSavedSearch загружает сохраненный поиск текущего пользователя по ID из URL
+func findUserSavedSearch(c *gin.Context) (*models.SavedSearch, bool) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return nil, false
+	}
+
+	// Получаем ID сохраненного поиска из URL
+	savedSearchID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID сохраненного поиска"})
+		return nil, false
+	}
+
+	var savedSearch models.SavedSearch
+	result := database.GetDB().Where("id = ? AND user_id = ?", savedSearchID, userID).First(&savedSearch)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "сохраненный поиск не найден"})
+		return nil, false
+	}
+
+	return &savedSearch, true
+}
@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/scim"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// scimGroupAttributes — атрибуты группы, доступные в фильтрах SCIM
+var scimGroupAttributes = map[string]scim.Attribute{
+	"id":                {Column: "id", Kind: scim.KindInt},
+	"displayName":       {Column: "name"},
+	"externalId":        {Column: "external_id", CaseExact: true},
+	"meta.created":      {Column: "created_at", Kind: scim.KindTime},
+	"meta.lastModified": {Column: "updated_at", Kind: scim.KindTime},
+}
+
+// errSCIMUnknownMember — в составе группы указан несуществующий пользователь
+var errSCIMUnknownMember = errors.New("участник группы не найден среди пользователей")
+
+// errSCIMNoGroupOwner — не настроен владелец рабочих пространств, создаваемых через SCIM
+var errSCIMNoGroupOwner = errors.New("владелец групп SCIM_GROUP_OWNER не задан или не найден")
+
+// scimGroupMembers — ID пользователей, которые должны состоять в группе
+type scimGroupMembers map[uint]bool
+
+// scimGroups ограничивает запрос рабочими пространствами, связанными с группами IdP.
+// Пространства, созданные пользователями, через SCIM не видны и не меняются.
+func scimGroups(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&models.Workspace{}).Where("external_id IS NOT NULL")
+}
+
+// SCIMListGroups возвращает группы (рабочие пространства) с фильтрацией и постраничной выдачей
+func SCIMListGroups(c *gin.Context) {
+	startIndex, count, ok := scimPage(c)
+	if !ok {
+		return
+	}
+
+	query := scimGroups(database.GetDB())
+	if filter := c.Query("filter"); filter != "" {
+		sql, args, err := scim.CompileFilter(filter, scimGroupAttributes)
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		query = query.Where(sql, args...)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при получении групп")
+		return
+	}
+
+	var workspaces []models.Workspace
+	if count > 0 {
+		if err := query.Order("id").Offset(startIndex - 1).Limit(count).Find(&workspaces).Error; err != nil {
+			scimError(c, http.StatusInternalServerError, "", "ошибка при получении групп")
+			return
+		}
+	}
+
+	resources, err := toSCIMGroups(c, workspaces)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при получении групп")
+		return
+	}
+
+	scimJSON(c, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// SCIMGetGroup возвращает группу по ID
+func SCIMGetGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	respondSCIMGroup(c, http.StatusOK, workspace)
+}
+
+// SCIMCreateGroup создает рабочее пространство по группе IdP. Владельцем пространства
+// становится пользователь из SCIM_GROUP_OWNER, участниками группы управляет IdP.
+func SCIMCreateGroup(c *gin.Context) {
+	var req scim.Group
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	workspace := models.Workspace{}
+	members := scimGroupMembers{}
+	if err := applySCIMGroup(&workspace, members, &req); err != nil {
+		scimError(c, http.StatusBadRequest, err.scimType, err.detail)
+		return
+	}
+
+	owner, err := scimGroupOwner()
+	if errors.Is(err, errSCIMNoGroupOwner) {
+		scimError(c, http.StatusNotImplemented, "", err.Error())
+		return
+	}
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при создании группы")
+		return
+	}
+
+	saveSCIMGroup(c, &workspace, members, http.StatusCreated, owner)
+}
+
+// scimGroupOwner возвращает пользователя, который владеет рабочими пространствами,
+// созданными через SCIM. Он указывается email в переменной SCIM_GROUP_OWNER.
+func scimGroupOwner() (*models.User, error) {
+	email := strings.TrimSpace(os.Getenv("SCIM_GROUP_OWNER"))
+	if email == "" {
+		return nil, errSCIMNoGroupOwner
+	}
+
+	var users []models.User
+	if err := database.GetDB().Where("LOWER(email) = LOWER(?)", email).Limit(1).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, errSCIMNoGroupOwner
+	}
+	return &users[0], nil
+}
+
+// SCIMReplaceGroup полностью заменяет имя и состав группы (PUT)
+func SCIMReplaceGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	var req scim.Group
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	members := scimGroupMembers{}
+	if err := applySCIMGroup(workspace, members, &req); err != nil {
+		scimError(c, http.StatusBadRequest, err.scimType, err.detail)
+		return
+	}
+
+	saveSCIMGroup(c, workspace, members, http.StatusOK, nil)
+}
+
+// SCIMPatchGroup частично изменяет группу: имя, externalId и состав участников
+func SCIMPatchGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	var req scim.PatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	var userIDs []uint
+	if err := database.GetDB().Model(&models.WorkspaceMember{}).
+		Where("workspace_id = ? AND provisioned = ?", workspace.ID, true).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при обновлении группы")
+		return
+	}
+	members := scimGroupMembers{}
+	for _, id := range userIDs {
+		members[id] = true
+	}
+
+	for _, op := range req.Operations {
+		if err := applySCIMGroupPatch(workspace, members, op); err != nil {
+			scimError(c, http.StatusBadRequest, err.scimType, err.detail)
+			return
+		}
+	}
+
+	saveSCIMGroup(c, workspace, members, http.StatusOK, nil)
+}
+
+// SCIMDeleteGroup отвязывает рабочее пространство от группы IdP: участники, добавленные IdP,
+// исключаются, а само пространство с заметками остается у владельца и других участников
+func SCIMDeleteGroup(c *gin.Context) {
+	workspace, ok := findSCIMGroup(c)
+	if !ok {
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := syncSCIMGroupMembers(tx, workspace.ID, scimGroupMembers{}); err != nil {
+			return err
+		}
+		return tx.Model(workspace).Update("external_id", nil).Error
+	})
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при удалении группы")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// findSCIMGroup загружает рабочее пространство по ID из URL или отвечает 404
+func findSCIMGroup(c *gin.Context) (*models.Workspace, bool) {
+	workspaceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "группа не найдена")
+		return nil, false
+	}
+
+	var workspace models.Workspace
+	if err := scimGroups(database.GetDB()).First(&workspace, workspaceID).Error; err != nil {
+		scimError(c, http.StatusNotFound, "", "группа не найдена")
+		return nil, false
+	}
+
+	return &workspace, true
+}
+
+// saveSCIMGroup сохраняет рабочее пространство и его состав и возвращает представление SCIM.
+// Для новой группы передается owner — владелец создаваемого пространства.
+func saveSCIMGroup(c *gin.Context, workspace *models.Workspace, members scimGroupMembers, status int, owner *models.User) {
+	if workspace.ExternalID != nil {
+		var count int64
+		err := database.GetDB().Model(&models.Workspace{}).
+			Where("id <> ? AND external_id = ?", workspace.ID, *workspace.ExternalID).
+			Count(&count).Error
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "ошибка при сохранении группы")
+			return
+		}
+		if count > 0 {
+			scimError(c, http.StatusConflict, "uniqueness", "группа с таким externalId уже существует")
+			return
+		}
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(workspace).Error; err != nil {
+			return err
+		}
+		if owner != nil {
+			member := models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: owner.ID, Role: models.WorkspaceRoleOwner}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return syncSCIMGroupMembers(tx, workspace.ID, members)
+	})
+	if errors.Is(err, errSCIMUnknownMember) {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при сохранении группы")
+		return
+	}
+
+	respondSCIMGroup(c, status, workspace)
+}
+
+// syncSCIMGroupMembers приводит участников рабочего пространства, добавленных IdP, к составу
+// группы. Новые участники получают роль member, роли оставшихся не меняются. Участники,
+// добавленные в пространство вручную, и владелец не исключаются; если IdP включает такого
+// участника в группу, тот начинает числиться в ней.
+func syncSCIMGroupMembers(tx *gorm.DB, workspaceID uint, members scimGroupMembers) error {
+	userIDs := make([]uint, 0, len(members))
+	for id := range members {
+		userIDs = append(userIDs, id)
+	}
+	slices.Sort(userIDs)
+
+	if len(userIDs) > 0 {
+		var found int64
+		if err := tx.Model(&models.User{}).Where("id IN ?", userIDs).Count(&found).Error; err != nil {
+			return err
+		}
+		if int(found) != len(userIDs) {
+			return errSCIMUnknownMember
+		}
+	}
+
+	removed := tx.Where("workspace_id = ? AND provisioned = ? AND role <> ?", workspaceID, true, models.WorkspaceRoleOwner)
+	if len(userIDs) > 0 {
+		removed = removed.Where("user_id NOT IN ?", userIDs)
+	}
+	if err := removed.Delete(&models.WorkspaceMember{}).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	if err := tx.Model(&models.WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id IN ? AND provisioned = ?", workspaceID, userIDs, false).
+		Update("provisioned", true).Error; err != nil {
+		return err
+	}
+	for _, id := range userIDs {
+		member := models.WorkspaceMember{WorkspaceID: workspaceID, UserID: id, Role: models.WorkspaceRoleMember, Provisioned: true}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySCIMGroup переносит атрибуты ресурса группы в рабочее пространство и состав участников
+func applySCIMGroup(workspace *models.Workspace, members scimGroupMembers, req *scim.Group) *scimPatchError {
+	name := strings.TrimSpace(req.DisplayName)
+	if name == "" {
+		return &scimPatchError{scimType: "invalidValue", detail: "атрибут displayName обязателен"}
+	}
+	workspace.Name = name
+
+	// По externalId пространство связано с группой IdP, поэтому сбросить его нельзя
+	if req.ExternalID == "" {
+		return &scimPatchError{scimType: "invalidValue", detail: "атрибут externalId обязателен"}
+	}
+	externalID := req.ExternalID
+	workspace.ExternalID = &externalID
+
+	return addSCIMGroupMembers(members, req.Members)
+}
+
+// applySCIMGroupPatch применяет одну операцию PATCH к группе (RFC 7644, раздел 3.5.2)
+func applySCIMGroupPatch(workspace *models.Workspace, members scimGroupMembers, op scim.PatchOperation) *scimPatchError {
+	path := strings.ToLower(op.Path)
+
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		return removeSCIMGroupAttribute(members, op)
+	default:
+		return &scimPatchError{scimType: "invalidSyntax", detail: fmt.Sprintf("неизвестная операция %q", op.Op)}
+	}
+	replace := strings.EqualFold(op.Op, "replace")
+
+	// Без path значение содержит набор изменяемых атрибутов
+	if path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return &scimPatchError{scimType: "invalidValue", detail: "значение операции должно быть объектом"}
+		}
+		for name, value := range attrs {
+			if err := applySCIMGroupAttribute(workspace, members, strings.ToLower(name), value, replace); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return applySCIMGroupAttribute(workspace, members, path, op.Value, replace)
+}
+
+// applySCIMGroupAttribute изменяет один атрибут группы по его пути SCIM (в нижнем регистре).
+// При replace список участников заменяется, при add — дополняется.
+func applySCIMGroupAttribute(workspace *models.Workspace, members scimGroupMembers, path string, value json.RawMessage, replace bool) *scimPatchError {
+	invalid := &scimPatchError{scimType: "invalidValue", detail: fmt.Sprintf("неверное значение атрибута %s", path)}
+
+	switch path {
+	case "displayname":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil || strings.TrimSpace(s) == "" {
+			return invalid
+		}
+		workspace.Name = strings.TrimSpace(s)
+	case "externalid":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil || s == "" {
+			return invalid
+		}
+		workspace.ExternalID = &s
+	case "members":
+		var list []scim.Member
+		if err := json.Unmarshal(value, &list); err != nil {
+			return invalid
+		}
+		if replace {
+			clear(members)
+		}
+		return addSCIMGroupMembers(members, list)
+	case "id":
+		// Некоторые IdP (например, Okta) передают id вместе с изменяемыми атрибутами
+	default:
+		return &scimPatchError{scimType: "invalidPath", detail: fmt.Sprintf("неподдерживаемый атрибут %s", path)}
+	}
+
+	return nil
+}
+
+// removeSCIMGroupAttribute выполняет операцию remove: убирает участников, перечисленных
+// в значении или в фильтре пути members[value eq "..."]. externalId удалить нельзя:
+// чтобы отвязать пространство от IdP, группу удаляют.
+func removeSCIMGroupAttribute(members scimGroupMembers, op scim.PatchOperation) *scimPatchError {
+	switch strings.ToLower(op.Path) {
+	case "":
+		return &scimPatchError{scimType: "noTarget", detail: "для remove требуется path"}
+	case "externalid":
+		return &scimPatchError{scimType: "mutability", detail: "атрибут externalId нельзя удалить"}
+	case "members":
+		// Без значения remove убирает всех участников
+		if len(op.Value) == 0 {
+			clear(members)
+			return nil
+		}
+		var list []scim.Member
+		if err := json.Unmarshal(op.Value, &list); err != nil {
+			return &scimPatchError{scimType: "invalidValue", detail: "неверное значение атрибута members"}
+		}
+		for _, member := range list {
+			id, err := parseSCIMMemberID(member.Value)
+			if err != nil {
+				return err
+			}
+			delete(members, id)
+		}
+		return nil
+	}
+
+	attr, sub, value, err := scim.ParseValuePath(op.Path)
+	if err != nil {
+		return &scimPatchError{scimType: "invalidPath", detail: err.Error()}
+	}
+	if !strings.EqualFold(attr, "members") || !strings.EqualFold(sub, "value") {
+		return &scimPatchError{scimType: "invalidPath", detail: fmt.Sprintf("атрибут %s нельзя удалить", op.Path)}
+	}
+	id, patchErr := parseSCIMMemberID(value)
+	if patchErr != nil {
+		return patchErr
+	}
+	delete(members, id)
+	return nil
+}
+
+// addSCIMGroupMembers добавляет участников из ресурса SCIM в состав группы
+func addSCIMGroupMembers(members scimGroupMembers, list []scim.Member) *scimPatchError {
+	for _, member := range list {
+		id, err := parseSCIMMemberID(member.Value)
+		if err != nil {
+			return err
+		}
+		members[id] = true
+	}
+	return nil
+}
+
+// parseSCIMMemberID разбирает ID пользователя из значения участника группы
+func parseSCIMMemberID(value string) (uint, *scimPatchError) {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || id == 0 {
+		return 0, &scimPatchError{scimType: "invalidValue", detail: fmt.Sprintf("неверный участник %q", value)}
+	}
+	return uint(id), nil
+}
+
+// respondSCIMGroup отвечает представлением группы вместе с ее участниками
+func respondSCIMGroup(c *gin.Context, status int, workspace *models.Workspace) {
+	resources, err := toSCIMGroups(c, []models.Workspace{*workspace})
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при получении группы")
+		return
+	}
+
+	if status == http.StatusCreated {
+		c.Header("Location", resources[0].Meta.Location)
+	}
+	scimJSON(c, status, resources[0])
+}
+
+// toSCIMGroups преобразует рабочие пространства в ресурсы групп SCIM, загружая участников
+// всех пространств одним запросом
+func toSCIMGroups(c *gin.Context, workspaces []models.Workspace) ([]scim.Group, error) {
+	resources := make([]scim.Group, 0, len(workspaces))
+	if len(workspaces) == 0 {
+		return resources, nil
+	}
+
+	ids := make([]uint, len(workspaces))
+	for i := range workspaces {
+		ids[i] = workspaces[i].ID
+	}
+	var members []models.WorkspaceMember
+	if err := database.GetDB().Preload("User").
+		Where("workspace_id IN ? AND provisioned = ?", ids, true).
+		Order("id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	byWorkspace := make(map[uint][]scim.Member, len(workspaces))
+	for _, member := range members {
+		resource := scim.Member{
+			Value: strconv.FormatUint(uint64(member.UserID), 10),
+			Ref:   fmt.Sprintf("%s/scim/v2/Users/%d", requestBaseURL(c), member.UserID),
+		}
+		if member.User != nil {
+			resource.Display = member.User.Username
+		}
+		byWorkspace[member.WorkspaceID] = append(byWorkspace[member.WorkspaceID], resource)
+	}
+
+	for i := range workspaces {
+		workspace := &workspaces[i]
+		resource := scim.Group{
+			Schemas:     []string{scim.SchemaGroup},
+			ID:          strconv.FormatUint(uint64(workspace.ID), 10),
+			DisplayName: workspace.Name,
+			Members:     byWorkspace[workspace.ID],
+			Meta: &scim.Meta{
+				ResourceType: "Group",
+				Created:      workspace.CreatedAt,
+				LastModified: workspace.UpdatedAt,
+				Location:     fmt.Sprintf("%s/scim/v2/Groups/%d", requestBaseURL(c), workspace.ID),
+			},
+		}
+		if resource.Members == nil {
+			resource.Members = []scim.Member{}
+		}
+		if workspace.ExternalID != nil {
+			resource.ExternalID = *workspace.ExternalID
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
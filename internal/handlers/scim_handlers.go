@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/scim"
+	"gorm.io/gorm"
+)
+
+// Ограничения постраничной выдачи SCIM
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+)
+
+// scimUserAttributes — атрибуты пользователя, доступные в фильтрах SCIM
+var scimUserAttributes = map[string]scim.Attribute{
+	"id":                {Column: "id", Kind: scim.KindInt},
+	"userName":          {Column: "username"},
+	"externalId":        {Column: "external_id", CaseExact: true},
+	"emails":            {Column: "email"},
+	"emails.value":      {Column: "email"},
+	"active":            {Column: "suspended_at", Kind: scim.KindNullAsTrue},
+	"meta.created":      {Column: "created_at", Kind: scim.KindTime},
+	"meta.lastModified": {Column: "updated_at", Kind: scim.KindTime},
+}
+
+// scimPatchError описывает ошибку применения PATCH-операции
+type scimPatchError struct {
+	scimType string
+	detail   string
+}
+
+// SCIMServiceProviderConfig описывает возможности SCIM-сервера
+func SCIMServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": true},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Выделенный токен SCIM_TOKEN",
+		}},
+	})
+}
+
+// SCIMListUsers возвращает пользователей с фильтрацией и постраничной выдачей
+func SCIMListUsers(c *gin.Context) {
+	startIndex, count, ok := scimPage(c)
+	if !ok {
+		return
+	}
+
+	query := database.GetDB().Model(&models.User{})
+	if filter := c.Query("filter"); filter != "" {
+		sql, args, err := scim.CompileFilter(filter, scimUserAttributes)
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		query = query.Where(sql, args...)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при получении пользователей")
+		return
+	}
+
+	var users []models.User
+	if count > 0 {
+		if err := query.Order("id").Offset(startIndex - 1).Limit(count).Find(&users).Error; err != nil {
+			scimError(c, http.StatusInternalServerError, "", "ошибка при получении пользователей")
+			return
+		}
+	}
+
+	resources := make([]scim.User, 0, len(users))
+	for i := range users {
+		resources = append(resources, toSCIMUser(c, &users[i]))
+	}
+
+	scimJSON(c, http.StatusOK, scim.ListResponse{
+		Schemas:      []string{scim.SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// SCIMGetUser возвращает пользователя по ID
+func SCIMGetUser(c *gin.Context) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	scimJSON(c, http.StatusOK, toSCIMUser(c, user))
+}
+
+// SCIMCreateUser создает пользователя по запросу IdP
+func SCIMCreateUser(c *gin.Context) {
+	var req scim.User
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	user := models.User{}
+	if err := applySCIMUser(&user, &req); err != nil {
+		scimError(c, http.StatusBadRequest, err.scimType, err.detail)
+		return
+	}
+
+	// Если IdP не передал пароль, вход возможен только через SSO
+	if user.Password == "" {
+		password, err := auth.GenerateRandomString(32)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "ошибка при создании пользователя")
+			return
+		}
+		user.SetPassword(password)
+	}
+
+	detail, err := scimUniquenessConflict(&user)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при создании пользователя")
+		return
+	}
+	if detail != "" {
+		scimError(c, http.StatusConflict, "uniqueness", detail)
+		return
+	}
+
+	if err := database.GetDB().Create(&user).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при создании пользователя")
+		return
+	}
+
+	resource := toSCIMUser(c, &user)
+	c.Header("Location", resource.Meta.Location)
+	scimJSON(c, http.StatusCreated, resource)
+}
+
+// SCIMReplaceUser полностью заменяет атрибуты пользователя (PUT)
+func SCIMReplaceUser(c *gin.Context) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	var req scim.User
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	// При замене отсутствующий active означает активного пользователя
+	if req.Active == nil {
+		active := true
+		req.Active = &active
+	}
+	if err := applySCIMUser(user, &req); err != nil {
+		scimError(c, http.StatusBadRequest, err.scimType, err.detail)
+		return
+	}
+
+	saveSCIMUser(c, user)
+}
+
+// SCIMPatchUser частично изменяет пользователя, в том числе блокирует его через active=false
+func SCIMPatchUser(c *gin.Context) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	var req scim.PatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	for _, op := range req.Operations {
+		if err := applySCIMPatch(user, op); err != nil {
+			scimError(c, http.StatusBadRequest, err.scimType, err.detail)
+			return
+		}
+	}
+
+	saveSCIMUser(c, user)
+}
+
+// SCIMDeleteUser блокирует пользователя. Заметки пользователя при этом сохраняются,
+// поэтому удаление через SCIM не стирает данные безвозвратно.
+func SCIMDeleteUser(c *gin.Context) {
+	user, ok := findSCIMUser(c)
+	if !ok {
+		return
+	}
+
+	setSCIMActive(user, false)
+	if err := database.GetDB().Save(user).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при блокировке пользователя")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// scimPage читает параметры постраничной выдачи startIndex и count (RFC 7644, раздел 3.4.2.4)
+func scimPage(c *gin.Context) (int, int, bool) {
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", "неверный startIndex")
+		return 0, 0, false
+	}
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err := strconv.Atoi(c.DefaultQuery("count", strconv.Itoa(scimDefaultCount)))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", "неверный count")
+		return 0, 0, false
+	}
+	if count < 0 {
+		count = 0
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count, true
+}
+
+// findSCIMUser загружает пользователя по ID из URL или отвечает 404
+func findSCIMUser(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "пользователь не найден")
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.GetDB().First(&user, userID).Error; err != nil {
+		scimError(c, http.StatusNotFound, "", "пользователь не найден")
+		return nil, false
+	}
+
+	return &user, true
+}
+
+// saveSCIMUser сохраняет изменения пользователя и возвращает его представление SCIM
+func saveSCIMUser(c *gin.Context, user *models.User) {
+	detail, err := scimUniquenessConflict(user)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при обновлении пользователя")
+		return
+	}
+	if detail != "" {
+		scimError(c, http.StatusConflict, "uniqueness", detail)
+		return
+	}
+
+	if err := database.GetDB().Save(user).Error; err != nil {
+		scimError(c, http.StatusInternalServerError, "", "ошибка при обновлении пользователя")
+		return
+	}
+
+	scimJSON(c, http.StatusOK, toSCIMUser(c, user))
+}
+
+// applySCIMUser переносит атрибуты ресурса SCIM в модель пользователя
+func applySCIMUser(user *models.User, req *scim.User) *scimPatchError {
+	if strings.TrimSpace(req.UserName) == "" {
+		return &scimPatchError{scimType: "invalidValue", detail: "атрибут userName обязателен"}
+	}
+	user.Username = req.UserName
+
+	email := req.PrimaryEmail()
+	if email == "" && strings.Contains(req.UserName, "@") {
+		email = req.UserName
+	}
+	if email == "" {
+		return &scimPatchError{scimType: "invalidValue", detail: "требуется email пользователя"}
+	}
+	user.Email = email
+
+	if req.ExternalID != "" {
+		externalID := req.ExternalID
+		user.ExternalID = &externalID
+	} else {
+		user.ExternalID = nil
+	}
+
+	if req.Active != nil {
+		setSCIMActive(user, *req.Active)
+	}
+	if req.Password != "" {
+		user.SetPassword(req.Password)
+	}
+
+	return nil
+}
+
+// applySCIMPatch применяет одну операцию PATCH (RFC 7644, раздел 3.5.2)
+func applySCIMPatch(user *models.User, op scim.PatchOperation) *scimPatchError {
+	path := strings.ToLower(op.Path)
+
+	switch strings.ToLower(op.Op) {
+	case "add", "replace":
+	case "remove":
+		switch path {
+		case "externalid":
+			user.ExternalID = nil
+			return nil
+		case "":
+			return &scimPatchError{scimType: "noTarget", detail: "для remove требуется path"}
+		}
+		return &scimPatchError{scimType: "mutability", detail: fmt.Sprintf("атрибут %s нельзя удалить", op.Path)}
+	default:
+		return &scimPatchError{scimType: "invalidSyntax", detail: fmt.Sprintf("неизвестная операция %q", op.Op)}
+	}
+
+	// Без path значение содержит набор изменяемых атрибутов
+	if path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return &scimPatchError{scimType: "invalidValue", detail: "значение операции должно быть объектом"}
+		}
+		for name, value := range attrs {
+			if err := applySCIMAttribute(user, strings.ToLower(name), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return applySCIMAttribute(user, path, op.Value)
+}
+
+// applySCIMAttribute изменяет один атрибут пользователя по его пути SCIM (в нижнем регистре)
+func applySCIMAttribute(user *models.User, path string, value json.RawMessage) *scimPatchError {
+	invalid := &scimPatchError{scimType: "invalidValue", detail: fmt.Sprintf("неверное значение атрибута %s", path)}
+
+	switch {
+	case path == "username":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil || strings.TrimSpace(s) == "" {
+			return invalid
+		}
+		user.Username = s
+	case path == "externalid":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return invalid
+		}
+		if s == "" {
+			user.ExternalID = nil
+		} else {
+			user.ExternalID = &s
+		}
+	case path == "active":
+		active, ok := scim.ParseBool(value)
+		if !ok {
+			return invalid
+		}
+		setSCIMActive(user, active)
+	case path == "emails":
+		var emails []scim.Email
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return invalid
+		}
+		resource := scim.User{Emails: emails}
+		if email := resource.PrimaryEmail(); email != "" {
+			user.Email = email
+		}
+	case path == "emails.value" || strings.HasPrefix(path, "emails["):
+		// Храним единственный email, поэтому любой фильтр по emails указывает на него
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil || s == "" {
+			return invalid
+		}
+		user.Email = s
+	case path == "password":
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil || s == "" {
+			return invalid
+		}
+		user.SetPassword(s)
+	case path == "displayname" || path == "name" || strings.HasPrefix(path, "name."):
+		// Имя и отображаемое имя не хранятся в модели пользователя, изменение игнорируется
+	default:
+		return &scimPatchError{scimType: "invalidPath", detail: fmt.Sprintf("неподдерживаемый атрибут %s", path)}
+	}
+
+	return nil
+}
+
+// setSCIMActive сопоставляет атрибут active с блокировкой учетной записи
+func setSCIMActive(user *models.User, active bool) {
+	if active {
+		user.SuspendedAt = nil
+		return
+	}
+	if user.SuspendedAt == nil {
+		now := time.Now()
+		user.SuspendedAt = &now
+	}
+}
+
+// scimUniquenessConflict проверяет, не заняты ли userName, email или externalId другим
+// пользователем. Возвращает описание конфликта или пустую строку.
+func scimUniquenessConflict(user *models.User) (string, error) {
+	db := database.GetDB().Model(&models.User{}).Where("id <> ?", user.ID)
+	taken := func(query string, value interface{}) (bool, error) {
+		var count int64
+		err := db.Session(&gorm.Session{}).Where(query, value).Count(&count).Error
+		return count > 0, err
+	}
+
+	if exists, err := taken("username = ?", user.Username); err != nil || exists {
+		return "пользователь с таким именем уже существует", err
+	}
+	if exists, err := taken("email = ?", user.Email); err != nil || exists {
+		return "пользователь с таким email уже существует", err
+	}
+	if user.ExternalID != nil {
+		if exists, err := taken("external_id = ?", *user.ExternalID); err != nil || exists {
+			return "пользователь с таким externalId уже существует", err
+		}
+	}
+	return "", nil
+}
+
+// toSCIMUser преобразует модель пользователя в ресурс SCIM
+func toSCIMUser(c *gin.Context, user *models.User) scim.User {
+	active := !user.IsSuspended()
+
+	resource := scim.User{
+		Schemas:  []string{scim.SchemaUser},
+		ID:       strconv.FormatUint(uint64(user.ID), 10),
+		UserName: user.Username,
+		Emails:   []scim.Email{{Value: user.Email, Type: "work", Primary: true}},
+		Active:   &active,
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     fmt.Sprintf("%s/scim/v2/Users/%d", requestBaseURL(c), user.ID),
+		},
+	}
+	if user.ExternalID != nil {
+		resource.ExternalID = *user.ExternalID
+	}
+
+	return resource
+}
+
+// requestBaseURL возвращает схему и хост, по которым клиент обратился к серверу
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, body)
+}
+
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	scimJSON(c, status, scim.NewError(status, scimType, detail))
+}
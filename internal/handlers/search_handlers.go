@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/pagination"
+	"github.com/omega/notes-app/internal/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Служебные символы, которыми ts_headline обрамляет совпадения. Они не встречаются
+// в обычном тексте и заменяются на <mark> после экранирования HTML.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+// Длина фрагмента содержимого, если в запросе нет текстовых условий
+const plainSnippetLength = 200
+
+// headlineOptions — параметры ts_headline для заголовка и фрагментов содержимого
+var (
+	titleHeadlineOptions   = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+	contentHeadlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop +
+		", MaxFragments=2, MaxWords=30, MinWords=10, FragmentDelimiter=\" … \""
+)
+
+// SearchResult представляет найденную заметку с релевантностью и подсвеченными фрагментами.
+// Фрагменты экранированы для HTML, совпадения обрамлены тегами <mark>.
+type SearchResult struct {
+	Note           models.Note `json:"note"`
+	Rank           float64     `json:"rank"`
+	TitleHighlight string      `json:"title_highlight"`
+	Snippet        string      `json:"snippet"`
+}
+
+// searchRow — строка результата поискового запроса до загрузки заметок
+type searchRow struct {
+	ID             uint
+	Rank           float64
+	TitleHighlight string
+	Snippet        string
+}
+
+// SearchNotes ищет заметки по запросу q на языке поиска (см. пакет search): слова и фразы
+// ищутся полнотекстово, поля tag:, notebook:, title:, lang:, created:, updated: и is:
+// ограничивают выборку, -условие исключает заметки, OR объединяет условия.
+// Результаты с текстом упорядочены по релевантности, совпадения в заголовке весят больше.
+func SearchNotes(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не указан поисковый запрос q"})
+		return
+	}
+
+	query, err := search.Compile(q)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+
+	limit, err := pagination.ParseLimit(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset должен быть неотрицательным числом"})
+			return
+		}
+	}
+
+	matches := database.GetDB().Model(&models.Note{}).
+		Scopes(currentSpace(c).Notes).
+		Where(query.Where, query.Args...)
+
+	var total int64
+	if err := matches.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при поиске заметок"})
+		return
+	}
+
+	// Если по словам ничего не нашлось, повторяем поиск по заголовкам с допуском опечаток
+	fuzzy := false
+	if query.HasText && total == 0 {
+		if query, err = search.CompileFuzzy(q); err != nil {
+			respondSearchError(c, err)
+			return
+		}
+		matches = database.GetDB().Model(&models.Note{}).
+			Scopes(currentSpace(c).Notes).
+			Where(query.Where, query.Args...)
+		if err := matches.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при поиске заметок"})
+			return
+		}
+		fuzzy = true
+	}
+
+	// Без текстовых условий ранжировать нечего: заметки идут от недавно измененных
+	switch {
+	case fuzzy:
+		matches = matches.Select(`notes.id, word_similarity(?, LOWER(notes.title)) AS rank,
+			notes.title AS title_highlight, left(notes.content, ?) AS snippet`, query.Terms, plainSnippetLength)
+	case query.HasText:
+		args := append([]interface{}{}, query.TSArgs...)
+		args = append(args, query.TSArgs...)
+		args = append(args, titleHeadlineOptions)
+		args = append(args, query.TSArgs...)
+		args = append(args, contentHeadlineOptions)
+		matches = matches.Select(fmt.Sprintf(`notes.id,
+			ts_rank(notes.search_vector, %[1]s) AS rank,
+			ts_headline('%[2]s', notes.title, %[1]s, ?) AS title_highlight,
+			ts_headline('%[2]s', notes.content, %[1]s, ?) AS snippet`, query.TSQuery, search.Config), args...)
+	default:
+		matches = matches.Select(`notes.id, 0 AS rank, notes.title AS title_highlight,
+			left(notes.content, ?) AS snippet`, plainSnippetLength)
+	}
+
+	var rows []searchRow
+	err = matches.
+		Order("rank DESC, notes.updated_at DESC, notes.id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при поиске заметок"})
+		return
+	}
+
+	results, err := loadSearchResults(rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при поиске заметок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": results,
+		"meta": gin.H{
+			"total":  total,
+			"limit":  limit,
+			"offset": offset,
+			"fuzzy":  fuzzy,
+		},
+	})
+}
+
+// Размер списка подсказок по умолчанию и максимальный
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+)
+
+// TitleSuggestion представляет подсказку заголовка при наборе
+type TitleSuggestion struct {
+	ID    uint    `json:"id"`
+	Title string  `json:"title"`
+	Score float64 `json:"score"`
+}
+
+// SuggestNotes подсказывает заголовки заметок активного пространства по началу prefix. Сначала идут
+// заголовки, начинающиеся с prefix, затем похожие по триграммам (с опечатками),
+// при равенстве — недавно измененные.
+func SuggestNotes(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	prefix := strings.ToLower(strings.TrimSpace(c.Query("prefix")))
+	if prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "не указан prefix"})
+		return
+	}
+
+	limit := defaultSuggestLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit должен быть положительным числом"})
+			return
+		}
+		if parsed < maxSuggestLimit {
+			limit = parsed
+		} else {
+			limit = maxSuggestLimit
+		}
+	}
+
+	var suggestions []TitleSuggestion
+	err := database.GetDB().Model(&models.Note{}).
+		Select("notes.id, notes.title, word_similarity(?, LOWER(notes.title)) AS score", prefix).
+		Scopes(currentSpace(c).Notes).
+		Where("LOWER(notes.title) LIKE ? OR word_similarity(?, LOWER(notes.title)) >= ?",
+			escapeLikePattern(prefix)+"%", prefix, search.FuzzyThreshold).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "LOWER(notes.title) LIKE ? DESC, score DESC, notes.updated_at DESC, notes.id DESC",
+			Vars: []interface{}{escapeLikePattern(prefix) + "%"},
+		}}).
+		Limit(limit).
+		Scan(&suggestions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при подборе подсказок"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"suggestions": suggestions,
+	})
+}
+
+// respondSearchError сообщает об ошибке в поисковом запросе вместе с ее позицией
+func respondSearchError(c *gin.Context, err error) {
+	var parseErr *search.ParseError
+	if errors.As(err, &parseErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    parseErr.Msg,
+			"position": parseErr.Pos,
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// loadSearchResults загружает заметки с тегами для строк поиска, сохраняя порядок релевантности
+func loadSearchResults(rows []searchRow) ([]SearchResult, error) {
+	results := make([]SearchResult, 0, len(rows))
+	if len(rows) == 0 {
+		return results, nil
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	var notes []models.Note
+	if err := database.GetDB().Preload("Tags").Where("id IN ?", ids).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Note, len(notes))
+	for _, note := range notes {
+		byID[note.ID] = note
+	}
+
+	for _, row := range rows {
+		note, ok := byID[row.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, SearchResult{
+			Note:           note,
+			Rank:           row.Rank,
+			TitleHighlight: renderHighlight(row.TitleHighlight),
+			Snippet:        renderHighlight(row.Snippet),
+		})
+	}
+	return results, nil
+}
+
+// renderHighlight экранирует фрагмент для HTML и заменяет служебные символы на <mark>
+func renderHighlight(fragment string) string {
+	escaped := html.EscapeString(fragment)
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(escaped)
+}
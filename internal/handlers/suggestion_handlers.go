@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Ошибки принятия и отклонения предложенных правок
+var (
+	errSuggestionNotFound = errors.New("предложение не найдено")
+	errSuggestionClosed   = errors.New("предложение уже принято или отклонено")
+	errSuggestionReject   = errors.New("отклонить предложение может только его автор или редактор заметки")
+)
+
+// SuggestionRequest представляет предложенную правку: замену фрагмента [start, end)
+// содержимого текстом replacement. Version — версия заметки, для которой указан диапазон.
+type SuggestionRequest struct {
+	Start       *int   `json:"start" binding:"required"`
+	End         *int   `json:"end" binding:"required"`
+	Replacement string `json:"replacement"`
+	Comment     string `json:"comment" binding:"max=1000"`
+	Version     *int   `json:"version"`
+}
+
+// CreateSuggestion предлагает правку содержимого заметки. Предлагать могут комментаторы
+// и все, у кого есть право редактирования.
+func CreateSuggestion(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessComment)
+	if !ok {
+		return
+	}
+
+	var req SuggestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Version != nil && *req.Version != note.Version {
+		respondNoteConflict(c, note.ID)
+		return
+	}
+
+	suggestion, err := models.NewNoteSuggestion(note.Content, *req.Start, *req.End, req.Replacement)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if suggestion.Original == suggestion.Replacement {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "предложение не меняет заметку"})
+		return
+	}
+	suggestion.NoteID = note.ID
+	suggestion.AuthorID = c.GetUint("user_id")
+	suggestion.Comment = req.Comment
+
+	if err := database.GetDB().Create(suggestion).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании предложения"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "предложение создано",
+		"suggestion": suggestion,
+	})
+}
+
+// GetSuggestions возвращает предложенные правки заметки; параметр status оставляет
+// предложения в одном состоянии
+func GetSuggestions(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessView)
+	if !ok {
+		return
+	}
+
+	query := database.GetDB().Preload("Author").Where("note_id = ?", note.ID)
+	if status := c.Query("status"); status != "" {
+		if !models.ValidSuggestionStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status должен быть open, accepted, rejected или outdated"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	var suggestions []models.NoteSuggestion
+	if err := query.Order("range_start, id").Find(&suggestions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении предложений"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"suggestions": suggestions,
+		"version":     note.Version,
+	})
+}
+
+// AcceptSuggestion применяет предложенную правку к заметке. Применение записывается
+// в историю версий, остальные открытые предложения переносятся.
+func AcceptSuggestion(c *gin.Context) {
+	note, _, ok := findAccessibleNote(c, models.NoteAccessEdit)
+	if !ok {
+		return
+	}
+	suggestionID, ok := parseSuggestionID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var suggestion models.NoteSuggestion
+	var previous models.Note
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Блокируем заметку, чтобы диапазон предложения соответствовал сохраняемому содержимому
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(note, note.ID).Error; err != nil {
+			return err
+		}
+		if err := lockSuggestion(tx, note.ID, suggestionID, &suggestion); err != nil {
+			return err
+		}
+		if suggestion.Status == models.SuggestionStatusOutdated {
+			return models.ErrSuggestionOutdated
+		}
+
+		content, err := suggestion.Apply(note.Content)
+		if err != nil {
+			return err
+		}
+		previous = *note
+		note.Content = content
+		if err := models.SaveNoteVersion(tx, note); err != nil {
+			return err
+		}
+		if err := models.EnsureBaselineRevision(tx, &previous); err != nil {
+			return err
+		}
+		if err := models.RecordRevision(tx, note, userID, 0); err != nil {
+			return err
+		}
+
+		if err := resolveSuggestion(tx, &suggestion, models.SuggestionStatusAccepted, userID); err != nil {
+			return err
+		}
+		if err := models.RebaseSuggestions(tx, note.ID, previous.Content, note.Content); err != nil {
+			return err
+		}
+		return tx.Model(note).Association("Tags").Find(&note.Tags)
+	})
+	if respondSuggestionError(c, err, "ошибка при принятии предложения") {
+		return
+	}
+	collabHub.ApplyExternal(note.ID, previous.Content, note.Content, userID)
+
+	c.Header("ETag", noteETag(note))
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "предложение принято",
+		"suggestion": suggestion,
+		"note":       note,
+	})
+}
+
+// RejectSuggestion отклоняет предложенную правку. Редакторы могут отклонить любое
+// предложение, автор — отозвать свое.
+func RejectSuggestion(c *gin.Context) {
+	note, access, ok := findAccessibleNote(c, models.NoteAccessComment)
+	if !ok {
+		return
+	}
+	suggestionID, ok := parseSuggestionID(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var suggestion models.NoteSuggestion
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := lockSuggestion(tx, note.ID, suggestionID, &suggestion); err != nil {
+			return err
+		}
+		if access < models.NoteAccessEdit && suggestion.AuthorID != userID {
+			return errSuggestionReject
+		}
+		return resolveSuggestion(tx, &suggestion, models.SuggestionStatusRejected, userID)
+	})
+	if respondSuggestionError(c, err, "ошибка при отклонении предложения") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "предложение отклонено",
+		"suggestion": suggestion,
+	})
+}
+
+// parseSuggestionID читает ID предложения из URL
+func parseSuggestionID(c *gin.Context) (uint, bool) {
+	suggestionID, err := strconv.ParseUint(c.Param("suggestion_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID предложения"})
+		return 0, false
+	}
+	return uint(suggestionID), true
+}
+
+// lockSuggestion загружает и блокирует незакрытое предложение: открытое или устаревшее,
+// которое еще можно отклонить
+func lockSuggestion(tx *gorm.DB, noteID, suggestionID uint, suggestion *models.NoteSuggestion) error {
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND note_id = ?", suggestionID, noteID).Limit(1).Find(suggestion)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errSuggestionNotFound
+	}
+	if suggestion.Status != models.SuggestionStatusOpen && suggestion.Status != models.SuggestionStatusOutdated {
+		return errSuggestionClosed
+	}
+	return nil
+}
+
+// resolveSuggestion закрывает предложение с указанным состоянием
+func resolveSuggestion(tx *gorm.DB, suggestion *models.NoteSuggestion, status string, userID uint) error {
+	now := time.Now()
+	suggestion.Status = status
+	suggestion.ResolvedByID = &userID
+	suggestion.ResolvedAt = &now
+	return tx.Model(suggestion).Updates(map[string]interface{}{
+		"status":         suggestion.Status,
+		"resolved_by_id": suggestion.ResolvedByID,
+		"resolved_at":    suggestion.ResolvedAt,
+	}).Error
+}
+
+// respondSuggestionError отвечает клиенту на ошибку операции с предложением.
+// Возвращает true, если ошибка была.
+func respondSuggestionError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errSuggestionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errSuggestionReject):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errSuggestionClosed), errors.Is(err, models.ErrSuggestionOutdated):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+	return true
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// Максимальная длина имени тега
+const maxTagNameLength = 100
+
+// TagRequest представляет данные для переименования тега
+type TagRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// MergeTagRequest представляет данные для объединения тегов
+type MergeTagRequest struct {
+	TargetID uint `json:"target_id" binding:"required"`
+}
+
+// TagWithCount представляет тег с количеством помеченных им заметок
+type TagWithCount struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	NoteCount int64  `json:"note_count"`
+}
+
+// GetTags возвращает теги активного пространства с количеством заметок
+func GetTags(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var tags []TagWithCount
+	err := database.GetDB().
+		Table("tags").
+		Select("tags.id, tags.name, COUNT(notes.id) AS note_count").
+		Joins("LEFT JOIN note_tags ON note_tags.tag_id = tags.id").
+		// Заметки из корзины не учитываются
+		Joins("LEFT JOIN notes ON notes.id = note_tags.note_id AND notes.deleted_at IS NULL").
+		Scopes(currentSpace(c).Tags).
+		Group("tags.id").
+		Order("tags.name").
+		Scan(&tags).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении тегов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tags": tags,
+	})
+}
+
+// RenameTag переименовывает тег. Если тег с новым именем уже существует,
+// возвращается конфликт: такие теги нужно объединить
+func RenameTag(c *gin.Context) {
+	tag, ok := findSpaceTag(c)
+	if !ok {
+		return
+	}
+
+	var req TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, err := normalizeTagName(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing models.Tag
+	result := database.GetDB().Scopes(models.TagSpace(tag).Tags).
+		Where("LOWER(name) = LOWER(?) AND id <> ?", name, tag.ID).
+		Limit(1).Find(&existing)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при переименовании тега"})
+		return
+	}
+	if result.RowsAffected > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "тег с таким именем уже существует, используйте объединение тегов",
+			"tag_id": existing.ID,
+		})
+		return
+	}
+
+	tag.Name = name
+	if err := database.GetDB().Save(tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при переименовании тега"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "тег успешно переименован",
+		"tag":     tag,
+	})
+}
+
+// MergeTag переносит заметки тега в целевой тег и удаляет исходный
+func MergeTag(c *gin.Context) {
+	source, ok := findSpaceTag(c)
+	if !ok {
+		return
+	}
+
+	var req MergeTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.TargetID == source.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "нельзя объединить тег с самим собой"})
+		return
+	}
+
+	var target models.Tag
+	result := database.GetDB().Scopes(models.TagSpace(source).Tags).Where("id = ?", req.TargetID).First(&target)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "целевой тег не найден"})
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Заметки, у которых уже есть целевой тег, не дублируются
+		if err := tx.Exec(`
+			INSERT INTO note_tags (note_id, tag_id)
+			SELECT note_id, ? FROM note_tags WHERE tag_id = ?
+			ON CONFLICT DO NOTHING`, target.ID, source.ID).Error; err != nil {
+			return err
+		}
+		return deleteTag(tx, source.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при объединении тегов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "теги успешно объединены",
+		"tag":     target,
+	})
+}
+
+// DeleteTag удаляет тег, снимая его со всех заметок
+func DeleteTag(c *gin.Context) {
+	tag, ok := findSpaceTag(c)
+	if !ok {
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		return deleteTag(tx, tag.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении тега"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "тег успешно удален",
+	})
+}
+
+// findSpaceTag загружает тег активного пространства по ID из URL для изменения.
+// Теги рабочего пространства общие, поэтому менять их могут только администраторы.
+func findSpaceTag(c *gin.Context) (*models.Tag, bool) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return nil, false
+	}
+
+	// Получаем ID тега из URL
+	tagID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID тега"})
+		return nil, false
+	}
+
+	var tag models.Tag
+	result := database.GetDB().Scopes(currentSpace(c).Tags).Where("tags.id = ?", tagID).First(&tag)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "тег не найден"})
+		return nil, false
+	}
+	if !managesSpace(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "управлять тегами рабочего пространства могут только администраторы"})
+		return nil, false
+	}
+
+	return &tag, true
+}
+
+func deleteTag(tx *gorm.DB, tagID uint) error {
+	if err := tx.Exec("DELETE FROM note_tags WHERE tag_id = ?", tagID).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.Tag{}, tagID).Error
+}
+
+// normalizeTagName убирает лишние пробелы и проверяет длину имени тега
+func normalizeTagName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", errors.New("имя тега не может быть пустым")
+	}
+	if utf8.RuneCountInString(name) > maxTagNameLength {
+		return "", fmt.Errorf("имя тега не может быть длиннее %d символов", maxTagNameLength)
+	}
+	return name, nil
+}
+
+// validateTagNames проверяет имена тегов из запроса до обращения к базе данных
+func validateTagNames(names []string) error {
+	for _, name := range names {
+		if _, err := normalizeTagName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveTags находит теги пространства по именам без учета регистра и создает недостающие
+func resolveTags(tx *gorm.DB, space models.Space, names []string) ([]models.Tag, error) {
+	tags := make([]models.Tag, 0, len(names))
+	seen := make(map[string]bool)
+	for _, raw := range names {
+		name, err := normalizeTagName(raw)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var tag models.Tag
+		result := tx.Scopes(space.Tags).Where("LOWER(name) = ?", key).Limit(1).Find(&tag)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			tag = models.Tag{Name: name, UserID: space.UserID, WorkspaceID: space.WorkspaceID}
+			if err := tx.Create(&tag).Error; err != nil {
+				return nil, err
+			}
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
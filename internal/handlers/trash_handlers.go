@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/jobs"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// errTrashAccess возвращается, если среди восстанавливаемых заметок есть недоступные для удаления
+var errTrashAccess = errors.New("недостаточно прав для восстановления всех вложенных заметок")
+
+// TrashedNote представляет заметку в корзине с моментом ее автоматического удаления
+type TrashedNote struct {
+	models.Note
+	PurgeAt *time.Time `json:"purge_at"`
+}
+
+// GetTrash возвращает заметки активного пространства, находящиеся в корзине
+func GetTrash(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var notes []models.Note
+	err := database.GetDB().Unscoped().Preload("Tags").
+		Scopes(currentSpace(c).Notes).
+		Where("notes.deleted_at IS NOT NULL").
+		Order("deleted_at DESC, id").
+		Find(&notes).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении корзины"})
+		return
+	}
+
+	retention := jobs.TrashRetention()
+	trashed := make([]TrashedNote, 0, len(notes))
+	for _, note := range notes {
+		item := TrashedNote{Note: note}
+		if retention > 0 {
+			purgeAt := note.DeletedAt.Time.Add(retention)
+			item.PurgeAt = &purgeAt
+		}
+		trashed = append(trashed, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notes": trashed,
+	})
+}
+
+// RestoreNote восстанавливает заметку из корзины вместе с потомками, удаленными вместе с ней.
+// Восстановить заметки можно, только если пользователь может удалить каждую из них.
+func RestoreNote(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	// Получаем ID заметки из URL
+	noteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID заметки"})
+		return
+	}
+
+	var note models.Note
+	result := database.GetDB().Unscoped().
+		Scopes(currentSpace(c).Notes).
+		Where("notes.id = ? AND notes.deleted_at IS NOT NULL", noteID).
+		First(&note)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "заметка не найдена в корзине"})
+		return
+	}
+
+	var restored int
+	err = database.GetDB().Transaction(func(tx *gorm.DB) error {
+		space := models.NoteSpace(&note)
+		if err := models.LockSpace(tx, space); err != nil {
+			return err
+		}
+		ids, err := models.TrashedSubtreeNoteIDs(tx, space, note.ID)
+		if err != nil {
+			return err
+		}
+		var notes []models.Note
+		if err := tx.Unscoped().Where("id IN ?", ids).Find(&notes).Error; err != nil {
+			return err
+		}
+		access, err := models.NotesAccessFor(tx, notes, c.GetUint("user_id"))
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if access[id] < models.NoteAccessOwner {
+				return errTrashAccess
+			}
+		}
+		restored = len(ids)
+
+		// Одного увеличения версии достаточно и для смены родителя и блокнота ниже
+		if err := tx.Unscoped().Model(&models.Note{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"deleted_at": nil, "version": models.NoteVersionIncrement()}).Error; err != nil {
+			return err
+		}
+
+		// Если родитель остался в корзине или удален, заметка становится корневой
+		if note.ParentID != nil {
+			var count int64
+			if err := tx.Model(&models.Note{}).Where("id = ?", *note.ParentID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				note.ParentID = nil
+				if err := tx.Model(&models.Note{}).Where("id = ?", note.ID).
+					Update("parent_id", nil).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// Заметки из удаленных блокнотов попадают в блокнот по умолчанию
+		defaultNotebook, err := models.DefaultNotebook(tx, space)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Note{}).
+			Where("id IN ? AND (notebook_id IS NULL OR notebook_id NOT IN (?))", ids,
+				space.Notebooks(tx.Model(&models.Notebook{}).Select("id"))).
+			Update("notebook_id", defaultNotebook.ID).Error
+	})
+	if errors.Is(err, errTrashAccess) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при восстановлении заметки"})
+		return
+	}
+
+	if err := database.GetDB().Preload("Tags").First(&note, note.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при восстановлении заметки"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "заметка успешно восстановлена",
+		"note":     note,
+		"restored": restored,
+	})
+}
+
+// EmptyTrash безвозвратно удаляет заметки активного пространства из корзины. Участник
+// рабочего пространства удаляет только свои заметки, администратор — все.
+func EmptyTrash(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	if _, exists := c.Get("user_id"); !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var purged int
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		query := tx.Unscoped().Model(&models.Note{}).
+			Scopes(currentSpace(c).Notes).
+			Where("notes.deleted_at IS NOT NULL")
+		if !managesSpace(c) {
+			query = query.Where("notes.user_id = ?", c.GetUint("user_id"))
+		}
+		var ids []uint
+		if err := query.Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		purged = len(ids)
+		return models.PurgeNotes(tx, ids)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при очистке корзины"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "корзина очищена",
+		"deleted": purged,
+	})
+}
@@ -98,6 +98,11 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if user.IsSuspended() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "учетная запись заблокирована"})
+		return
+	}
+
 	// Генерируем JWT-токен
 	token, err := auth.GenerateToken(&user)
 	if err != nil {
@@ -128,4 +133,4 @@ func GetProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"user": user,
 	})
-} 
\ No newline at end of file
+}
@@ -0,0 +1,579 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/mail"
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// WorkspaceRequest представляет данные для создания или переименования рабочего пространства
+type WorkspaceRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// WorkspaceMemberRequest представляет данные для смены роли участника
+type WorkspaceMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// InvitationRequest представляет данные для приглашения в рабочее пространство
+type InvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// AcceptInvitationRequest представляет данные для принятия приглашения
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// WorkspaceWithRole представляет рабочее пространство вместе с ролью текущего пользователя
+type WorkspaceWithRole struct {
+	models.Workspace
+	Role string `json:"role"`
+}
+
+// currentSpace возвращает активное пространство запроса: рабочее пространство,
+// выбранное заголовком X-Workspace-ID, или личное пространство пользователя
+func currentSpace(c *gin.Context) models.Space {
+	space := models.PersonalSpace(c.GetUint("user_id"))
+	if value, exists := c.Get("workspace_id"); exists {
+		workspaceID := value.(uint)
+		space.WorkspaceID = &workspaceID
+	}
+	return space
+}
+
+// managesSpace сообщает, может ли пользователь управлять чужими записями активного
+// пространства: в личном пространстве все записи свои, в рабочем нужна роль администратора
+func managesSpace(c *gin.Context) bool {
+	if _, exists := c.Get("workspace_id"); !exists {
+		return true
+	}
+	return models.WorkspaceRoleAtLeast(c.GetString("workspace_role"), models.WorkspaceRoleAdmin)
+}
+
+// CreateWorkspace создает рабочее пространство; создатель становится его владельцем
+func CreateWorkspace(c *gin.Context) {
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "имя рабочего пространства не может быть пустым"})
+		return
+	}
+
+	workspace := models.Workspace{Name: name}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WorkspaceMember{
+			WorkspaceID: workspace.ID,
+			UserID:      userID.(uint),
+			Role:        models.WorkspaceRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании рабочего пространства"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "рабочее пространство успешно создано",
+		"workspace": WorkspaceWithRole{Workspace: workspace, Role: models.WorkspaceRoleOwner},
+	})
+}
+
+// GetWorkspaces возвращает рабочие пространства, в которых состоит пользователь, с его ролями
+func GetWorkspaces(c *gin.Context) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+
+	var workspaces []WorkspaceWithRole
+	err := database.GetDB().
+		Table("workspaces").
+		Select("workspaces.*, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.name, workspaces.id").
+		Scan(&workspaces).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении рабочих пространств"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspaces": workspaces,
+	})
+}
+
+// GetWorkspace возвращает рабочее пространство по ID
+func GetWorkspace(c *gin.Context) {
+	workspace, role, ok := findWorkspace(c, models.WorkspaceRoleGuest)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspace": WorkspaceWithRole{Workspace: *workspace, Role: role},
+	})
+}
+
+// UpdateWorkspace переименовывает рабочее пространство; доступно администраторам и владельцу
+func UpdateWorkspace(c *gin.Context) {
+	workspace, role, ok := findWorkspace(c, models.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "имя рабочего пространства не может быть пустым"})
+		return
+	}
+
+	workspace.Name = name
+	if err := database.GetDB().Save(workspace).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при обновлении рабочего пространства"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "рабочее пространство успешно обновлено",
+		"workspace": WorkspaceWithRole{Workspace: *workspace, Role: role},
+	})
+}
+
+// DeleteWorkspace безвозвратно удаляет рабочее пространство вместе с его заметками,
+// блокнотами, тегами, участниками и приглашениями; доступно только владельцу
+func DeleteWorkspace(c *gin.Context) {
+	workspace, _, ok := findWorkspace(c, models.WorkspaceRoleOwner)
+	if !ok {
+		return
+	}
+
+	var purged int
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+		purged, err = models.PurgeWorkspace(tx, workspace.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при удалении рабочего пространства"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "рабочее пространство успешно удалено",
+		"purged":  purged,
+	})
+}
+
+// GetWorkspaceMembers возвращает участников рабочего пространства
+func GetWorkspaceMembers(c *gin.Context) {
+	workspace, _, ok := findWorkspace(c, models.WorkspaceRoleGuest)
+	if !ok {
+		return
+	}
+
+	var members []models.WorkspaceMember
+	if err := database.GetDB().Preload("User").Where("workspace_id = ?", workspace.ID).Order("id").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении участников"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": members,
+	})
+}
+
+// UpdateWorkspaceMember меняет роль участника. Роль владельца не передается и не отнимается,
+// а назначать и менять администраторов может только владелец.
+func UpdateWorkspaceMember(c *gin.Context) {
+	workspace, role, ok := findWorkspace(c, models.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+	member, ok := findWorkspaceMember(c, workspace)
+	if !ok {
+		return
+	}
+
+	var req WorkspaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidWorkspaceRole(req.Role) || req.Role == models.WorkspaceRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role должен быть admin, member или guest"})
+		return
+	}
+	if !canManageWorkspaceMember(role, member.Role) || !canManageWorkspaceMember(role, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав для изменения роли участника"})
+		return
+	}
+
+	member.Role = req.Role
+	if err := database.GetDB().Omit("User").Save(member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при изменении роли участника"})
+		return
+	}
+	restrictNoteSockets(member.UserID, collabHub.UserNotes(member.UserID)...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "роль участника успешно изменена",
+		"member":  member,
+	})
+}
+
+// DeleteWorkspaceMember исключает участника из рабочего пространства. Участник может выйти
+// сам, кроме владельца; исключать других могут администраторы и владелец.
+func DeleteWorkspaceMember(c *gin.Context) {
+	workspace, role, ok := findWorkspace(c, models.WorkspaceRoleGuest)
+	if !ok {
+		return
+	}
+	member, ok := findWorkspaceMember(c, workspace)
+	if !ok {
+		return
+	}
+
+	if member.Role == models.WorkspaceRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "владелец не может покинуть рабочее пространство"})
+		return
+	}
+	if member.UserID != c.GetUint("user_id") &&
+		(!models.WorkspaceRoleAtLeast(role, models.WorkspaceRoleAdmin) || !canManageWorkspaceMember(role, member.Role)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав для исключения участника"})
+		return
+	}
+
+	if err := database.GetDB().Delete(member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при исключении участника"})
+		return
+	}
+	restrictNoteSockets(member.UserID, collabHub.UserNotes(member.UserID)...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "участник исключен из рабочего пространства",
+	})
+}
+
+// CreateInvitation приглашает пользователя в рабочее пространство по email. Токен приглашения
+// отправляется только письмом; принять его может пользователь с этим адресом.
+func CreateInvitation(c *gin.Context) {
+	workspace, role, ok := findWorkspace(c, models.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidWorkspaceRole(req.Role) || req.Role == models.WorkspaceRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role должен быть admin, member или guest"})
+		return
+	}
+	if !canManageWorkspaceMember(role, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав для приглашения с этой ролью"})
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+
+	var members int64
+	err := database.GetDB().Model(&models.WorkspaceMember{}).
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ? AND LOWER(users.email) = LOWER(?)", workspace.ID, email).
+		Count(&members).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании приглашения"})
+		return
+	}
+	if members > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "пользователь уже состоит в рабочем пространстве"})
+		return
+	}
+
+	token, tokenHash, err := auth.GenerateOpaqueToken(models.WorkspaceInvitationTokenPrefix)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании приглашения"})
+		return
+	}
+
+	invitation := models.WorkspaceInvitation{
+		WorkspaceID: workspace.ID,
+		Email:       email,
+		Role:        req.Role,
+		TokenHash:   tokenHash,
+		InvitedByID: c.GetUint("user_id"),
+		ExpiresAt:   time.Now().Add(models.WorkspaceInvitationTTL),
+	}
+	if err := database.GetDB().Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при создании приглашения"})
+		return
+	}
+
+	// Письмо отправляется без открытой транзакции; если отправить не удалось,
+	// приглашение удаляется, чтобы не оставлять токен, которого никто не получил
+	err = mail.Send(email, "Приглашение в рабочее пространство «"+workspace.Name+"»",
+		invitationMessage(workspace, token, invitation.ExpiresAt))
+	if err != nil {
+		log.Printf("Ошибка при отправке приглашения в рабочее пространство %d: %v", workspace.ID, err)
+		if err := database.GetDB().Delete(&invitation).Error; err != nil {
+			log.Printf("Ошибка при удалении неотправленного приглашения %d: %v", invitation.ID, err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при отправке приглашения"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "приглашение отправлено",
+		"invitation": invitation,
+	})
+}
+
+// GetInvitations возвращает приглашения рабочего пространства, включая принятые и истекшие
+func GetInvitations(c *gin.Context) {
+	workspace, _, ok := findWorkspace(c, models.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	var invitations []models.WorkspaceInvitation
+	if err := database.GetDB().Where("workspace_id = ?", workspace.ID).Order("id DESC").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении приглашений"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invitations": invitations,
+	})
+}
+
+// DeleteInvitation отзывает приглашение
+func DeleteInvitation(c *gin.Context) {
+	workspace, _, ok := findWorkspace(c, models.WorkspaceRoleAdmin)
+	if !ok {
+		return
+	}
+
+	invitationID, err := strconv.ParseUint(c.Param("invitation_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID приглашения"})
+		return
+	}
+
+	result := database.GetDB().Where("id = ? AND workspace_id = ?", invitationID, workspace.ID).Delete(&models.WorkspaceInvitation{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при отзыве приглашения"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "приглашение не найдено"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "приглашение отозвано",
+	})
+}
+
+// AcceptInvitation принимает приглашение: текущий пользователь становится участником
+// рабочего пространства, если его email совпадает с адресом приглашения
+func AcceptInvitation(c *gin.Context) {
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Получаем пользователя из контекста
+	value, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return
+	}
+	user := value.(models.User)
+
+	var member models.WorkspaceMember
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var invitation models.WorkspaceInvitation
+		result := tx.Where("token_hash = ?", auth.HashToken(req.Token)).Limit(1).Find(&invitation)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationNotFound
+		}
+		if !invitation.Pending(time.Now()) {
+			return errInvitationExpired
+		}
+		if !strings.EqualFold(invitation.Email, user.Email) {
+			return errInvitationEmail
+		}
+
+		role, err := models.WorkspaceMemberRole(tx, invitation.WorkspaceID, user.ID)
+		if err != nil {
+			return err
+		}
+		if role != "" {
+			return errAlreadyMember
+		}
+
+		now := time.Now()
+		invitation.AcceptedAt = &now
+		if err := tx.Save(&invitation).Error; err != nil {
+			return err
+		}
+		member = models.WorkspaceMember{WorkspaceID: invitation.WorkspaceID, UserID: user.ID, Role: invitation.Role}
+		return tx.Create(&member).Error
+	})
+	switch {
+	case errors.Is(err, errInvitationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errInvitationExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errInvitationEmail):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при принятии приглашения"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "приглашение принято",
+		"member":  member,
+	})
+}
+
+// Ошибки принятия приглашения
+var (
+	errInvitationNotFound = errors.New("приглашение не найдено")
+	errInvitationExpired  = errors.New("приглашение истекло или уже принято")
+	errInvitationEmail    = errors.New("приглашение отправлено на другой email")
+	errAlreadyMember      = errors.New("пользователь уже состоит в рабочем пространстве")
+)
+
+// canManageWorkspaceMember сообщает, может ли участник с ролью actor назначать роль target
+// или менять участника с ней: владелец управляет всеми, администратор — участниками и гостями
+func canManageWorkspaceMember(actor, target string) bool {
+	if target == models.WorkspaceRoleOwner {
+		return false
+	}
+	if actor == models.WorkspaceRoleOwner {
+		return true
+	}
+	return actor == models.WorkspaceRoleAdmin && !models.WorkspaceRoleAtLeast(target, models.WorkspaceRoleAdmin)
+}
+
+// invitationMessage составляет текст письма с приглашением
+func invitationMessage(workspace *models.Workspace, token string, expiresAt time.Time) string {
+	return fmt.Sprintf(`Вас пригласили в рабочее пространство «%s».
+
+Чтобы присоединиться, войдите под этим адресом и примите приглашение:
+POST %s с телом {"token": "%s"}
+
+Приглашение действует до %s.
+`, workspace.Name, publicURL("/api/invitations/accept"), token, expiresAt.Format("02.01.2006 15:04"))
+}
+
+// findWorkspace загружает рабочее пространство по ID из URL и проверяет роль текущего
+// пользователя: тем, кто не состоит в пространстве, оно не видно
+func findWorkspace(c *gin.Context, minRole string) (*models.Workspace, string, bool) {
+	// Получаем ID пользователя из контекста
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не аутентифицирован"})
+		return nil, "", false
+	}
+
+	// Получаем ID рабочего пространства из URL
+	workspaceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID рабочего пространства"})
+		return nil, "", false
+	}
+
+	role, err := models.WorkspaceMemberRole(database.GetDB(), uint(workspaceID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при получении рабочего пространства"})
+		return nil, "", false
+	}
+	if role == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "рабочее пространство не найдено"})
+		return nil, "", false
+	}
+	if !models.WorkspaceRoleAtLeast(role, minRole) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав в рабочем пространстве"})
+		return nil, "", false
+	}
+
+	var workspace models.Workspace
+	if err := database.GetDB().First(&workspace, workspaceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "рабочее пространство не найдено"})
+		return nil, "", false
+	}
+
+	return &workspace, role, true
+}
+
+// findWorkspaceMember загружает участника рабочего пространства по ID пользователя из URL
+func findWorkspaceMember(c *gin.Context, workspace *models.Workspace) (*models.WorkspaceMember, bool) {
+	memberUserID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "неверный ID пользователя"})
+		return nil, false
+	}
+
+	var member models.WorkspaceMember
+	result := database.GetDB().Preload("User").
+		Where("workspace_id = ? AND user_id = ?", workspace.ID, memberUserID).
+		First(&member)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "участник не найден"})
+		return nil, false
+	}
+
+	return &member, true
+}
@@ -0,0 +1,33 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// Период удаления непрочитанных одноразовых заметок с истекшим сроком
+const burnNotePurgeInterval = 10 * time.Minute
+
+// StartBurnNotePurge запускает периодическое удаление одноразовых заметок с истекшим сроком
+func StartBurnNotePurge(ctx context.Context, db *gorm.DB) {
+	Every(ctx, "удаление одноразовых заметок", burnNotePurgeInterval, func(ctx context.Context) error {
+		purged, err := PurgeBurnNotes(db.WithContext(ctx), time.Now())
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Удалено непрочитанных одноразовых заметок: %d", purged)
+		}
+		return nil
+	})
+}
+
+// PurgeBurnNotes удаляет одноразовые заметки, срок которых истек к моменту now
+func PurgeBurnNotes(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at <= ?", now).Delete(&models.BurnNote{})
+	return result.RowsAffected, result.Error
+}
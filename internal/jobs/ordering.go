@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// Период проверки ключей ручного порядка заметок
+const positionRebalanceInterval = time.Hour
+
+// StartPositionRebalance запускает периодическую перестройку ключей ручного порядка заметок.
+// Первый запуск также расставляет ключи заметкам, созданным до появления ручного порядка.
+func StartPositionRebalance(ctx context.Context, db *gorm.DB) {
+	Every(ctx, "перестройка порядка заметок", positionRebalanceInterval, func(ctx context.Context) error {
+		rebalanced, err := RebalancePositions(db.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if rebalanced > 0 {
+			log.Printf("Перестроен порядок заметок в блокнотах: %d", rebalanced)
+		}
+		return nil
+	})
+}
+
+// RebalancePositions перестраивает ключи порядка во всех группах, где они отсутствуют
+// или стали слишком длинными, и возвращает количество перестроенных групп
+func RebalancePositions(db *gorm.DB) (int, error) {
+	groups, err := models.UnbalancedNotePositionGroups(db)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, group := range groups {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Блокировка пространства не дает перемещениям заметок пересечься с перестройкой
+			if err := models.LockSpace(tx, group.Space()); err != nil {
+				return err
+			}
+			return models.RebalanceNotePositions(tx, group)
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(groups), nil
+}
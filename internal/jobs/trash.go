@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/omega/notes-app/internal/models"
+	"gorm.io/gorm"
+)
+
+// Срок хранения заметок в корзине по умолчанию и период проверки корзины
+const (
+	DefaultTrashRetentionDays = 30
+	trashPurgeInterval        = time.Hour
+)
+
+// TrashRetention возвращает срок хранения заметок в корзине из TRASH_RETENTION_DAYS.
+// Нулевое значение отключает автоматическую очистку.
+func TrashRetention() time.Duration {
+	days := DefaultTrashRetentionDays
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Некорректное значение TRASH_RETENTION_DAYS=%q, используется %d", value, days)
+		} else {
+			days = parsed
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartTrashPurge запускает периодическое удаление заметок, пролежавших в корзине дольше срока хранения
+func StartTrashPurge(ctx context.Context, db *gorm.DB) {
+	retention := TrashRetention()
+	if retention == 0 {
+		log.Println("Автоматическая очистка корзины отключена")
+		return
+	}
+
+	Every(ctx, "очистка корзины", trashPurgeInterval, func(ctx context.Context) error {
+		purged, err := PurgeTrash(db.WithContext(ctx), time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Из корзины удалено заметок: %d", purged)
+		}
+		return nil
+	})
+}
+
+// PurgeTrash безвозвратно удаляет заметки, перемещенные в корзину раньше момента before
+func PurgeTrash(db *gorm.DB, before time.Time) (int, error) {
+	var ids []uint
+	err := db.Unscoped().Model(&models.Note{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return models.PurgeNotes(tx, ids)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
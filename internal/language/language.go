@@ -0,0 +1,50 @@
+package language
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Коды языков, которые определяются для заметок
+const (
+	Russian = "ru"
+	English = "en"
+	// Mixed — текст, в котором заметная доля слов на обоих языках
+	Mixed = "mixed"
+	// Unknown — в тексте нет кириллических или латинских букв
+	Unknown = ""
+)
+
+// dominantShare — доля букв одного алфавита, начиная с которой текст считается одноязычным
+const dominantShare = 0.8
+
+// Detect определяет язык текста по соотношению кириллических и латинских букв
+func Detect(text string) string {
+	var cyrillic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	total := cyrillic + latin
+	switch {
+	case total == 0:
+		return Unknown
+	case float64(cyrillic) >= dominantShare*float64(total):
+		return Russian
+	case float64(latin) >= dominantShare*float64(total):
+		return English
+	default:
+		return Mixed
+	}
+}
+
+// Normalize приводит текст к форме, в которой он индексируется для поиска: буква «ё»
+// заменяется на «е», поскольку в русских текстах она используется непоследовательно
+func Normalize(text string) string {
+	return strings.NewReplacer("ё", "е", "Ё", "Е").Replace(text)
+}
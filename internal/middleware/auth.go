@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/omega/notes-app/internal/auth"
@@ -29,28 +30,77 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Валидируем токен
+		// Валидируем токен: JWT первой стороны или токен доступа OAuth2 стороннего приложения
 		tokenString := parts[1]
-		claims, err := auth.ValidateToken(tokenString)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "недействительный токен: " + err.Error()})
-			c.Abort()
-			return
+		var userID uint
+		if auth.IsAccessToken(tokenString) {
+			var token models.OAuthToken
+			result := database.GetDB().Where("access_token_hash = ?", auth.HashToken(tokenString)).First(&token)
+			if result.Error != nil || !token.AccessActive(time.Now()) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "недействительный токен доступа"})
+				c.Abort()
+				return
+			}
+			userID = token.UserID
+			c.Set("oauth_scopes", token.Scopes)
+			c.Set("oauth_client_id", token.ClientID)
+		} else {
+			claims, err := auth.ValidateToken(tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "недействительный токен: " + err.Error()})
+				c.Abort()
+				return
+			}
+			userID = claims.UserID
 		}
 
 		// Получаем пользователя из базы данных
 		var user models.User
-		result := database.GetDB().First(&user, claims.UserID)
+		result := database.GetDB().First(&user, userID)
 		if result.Error != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "пользователь не найден"})
 			c.Abort()
 			return
 		}
 
+		// Заблокированный пользователь теряет доступ даже с действующим токеном
+		if user.IsSuspended() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "учетная запись заблокирована"})
+			c.Abort()
+			return
+		}
+
 		// Устанавливаем пользователя в контекст
 		c.Set("user", user)
-		c.Set("user_id", claims.UserID)
+		c.Set("user_id", userID)
+
+		c.Next()
+	}
+}
+
+// SocketTokenFromQuery переносит токен из параметра access_token в заголовок Authorization
+// для запросов на подключение WebSocket: браузер не может передать при подключении заголовки.
+// Параметр удаляется из адреса, поэтому подключается раньше журнала запросов, чтобы токен
+// не попадал в журнал.
+func SocketTokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+			c.Next()
+			return
+		}
+
+		query := c.Request.URL.Query()
+		token := query.Get("access_token")
+		if token == "" {
+			c.Next()
+			return
+		}
+		query.Del("access_token")
+		c.Request.URL.RawQuery = query.Encode()
+		if c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
 
 		c.Next()
 	}
-} 
\ No newline at end of file
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/scim"
+)
+
+// SCIMAuthMiddleware проверяет выделенный bearer-токен SCIM (переменная SCIM_TOKEN).
+// Если токен не задан, эндпоинты SCIM недоступны.
+func SCIMAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := os.Getenv("SCIM_TOKEN")
+		if expected == "" {
+			scimAbort(c, http.StatusNotFound, "SCIM не настроен")
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			scimAbort(c, http.StatusUnauthorized, "недействительный токен SCIM")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func scimAbort(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", scim.ContentType)
+	c.AbortWithStatusJSON(status, scim.NewError(status, "", detail))
+}
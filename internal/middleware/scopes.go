@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+)
+
+// ScopeMiddleware ограничивает доступ сторонних приложений областями доступа их токена:
+// для чтения (GET, HEAD) требуется readScope, для остальных методов — writeScope.
+// Запросы с JWT первой стороны не ограничиваются.
+func ScopeMiddleware(readScope, writeScope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		required := writeScope
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			required = readScope
+		}
+
+		requireScope(c, required)
+	}
+}
+
+// RequireScope ограничивает доступ сторонних приложений одной областью доступа scope
+// для всех методов. Запросы с JWT первой стороны не ограничиваются.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requireScope(c, scope)
+	}
+}
+
+// requireScope пропускает запрос дальше, если токен разрешает scope, иначе отвечает 403
+func requireScope(c *gin.Context, scope string) {
+	if !TokenHasScope(c, scope) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+		c.JSON(http.StatusForbidden, gin.H{"error": "недостаточно прав токена: требуется " + scope})
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// TokenHasScope сообщает, разрешает ли токен запроса область доступа scope. JWT первой
+// стороны разрешает все. Нужна обработчикам, которые по одному GET-запросу выполняют
+// и запись, например WebSocket совместного редактирования.
+func TokenHasScope(c *gin.Context, scope string) bool {
+	value, exists := c.Get("oauth_scopes")
+	if !exists {
+		return true
+	}
+	return auth.HasScope(value.([]string), scope)
+}
+
+// FirstPartyOnly запрещает доступ по токенам сторонних приложений.
+// Используется для управления приложениями и экрана согласия, чтобы приложение
+// не могло выдать себе права от имени пользователя.
+func FirstPartyOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("oauth_scopes"); exists {
+			c.JSON(http.StatusForbidden, gin.H{"error": "операция недоступна сторонним приложениям"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+)
+
+// WorkspaceHeader — заголовок, которым клиент выбирает активное рабочее пространство
+const WorkspaceHeader = "X-Workspace-ID"
+
+// WorkspaceMiddleware выбирает активное пространство запроса. Без заголовка X-Workspace-ID
+// запрос работает с личными заметками пользователя, с ним — с заметками рабочего
+// пространства, участником которого пользователь должен быть. Гости только читают.
+// Должен выполняться после AuthMiddleware.
+func WorkspaceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader(WorkspaceHeader)
+		if raw == "" {
+			c.Next()
+			return
+		}
+
+		workspaceID, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "неверный заголовок " + WorkspaceHeader})
+			c.Abort()
+			return
+		}
+
+		role, err := models.WorkspaceMemberRole(database.GetDB(), uint(workspaceID), c.GetUint("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "ошибка при проверке рабочего пространства"})
+			c.Abort()
+			return
+		}
+		if role == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "нет доступа к рабочему пространству"})
+			c.Abort()
+			return
+		}
+
+		if role == models.WorkspaceRoleGuest && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.JSON(http.StatusForbidden, gin.H{"error": "гости рабочего пространства могут только читать заметки"})
+			c.Abort()
+			return
+		}
+
+		c.Set("workspace_id", uint(workspaceID))
+		c.Set("workspace_role", role)
+
+		c.Next()
+	}
+}
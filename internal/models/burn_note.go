@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// Время жизни одноразовых заметок по умолчанию и максимальное
+const (
+	DefaultBurnNoteTTL = 24 * time.Hour
+	MaxBurnNoteTTL     = 7 * 24 * time.Hour
+)
+
+// BurnNote представляет одноразовую заметку, которая удаляется после первого прочтения.
+// Текст хранится зашифрованным ключом, который есть только во фрагменте ссылки,
+// поэтому по одной базе данных содержимое восстановить нельзя.
+type BurnNote struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	PublicID string `gorm:"size:43;not null;uniqueIndex" json:"id"`
+	UserID   uint   `gorm:"not null;index" json:"user_id"`
+	// WorkspaceID — рабочее пространство, в котором создана заметка; ее видят все его участники
+	WorkspaceID *uint     `gorm:"index" json:"workspace_id"`
+	Nonce       []byte    `gorm:"not null" json:"-"`
+	Ciphertext  []byte    `gorm:"not null" json:"-"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
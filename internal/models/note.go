@@ -1,15 +1,188 @@
 package models
 
 import (
+	"errors"
 	"time"
+
+	"github.com/omega/notes-app/internal/language"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Note представляет модель заметки в системе
 type Note struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Title     string    `gorm:"size:255;not null" json:"title"`
-	Content   string    `gorm:"type:text" json:"content"`
-	UserID    uint      `gorm:"not null" json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-} 
\ No newline at end of file
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Title       string         `gorm:"size:255;not null" json:"title"`
+	Content     string         `gorm:"type:text" json:"content"`
+	UserID      uint           `gorm:"not null" json:"user_id"`
+	WorkspaceID *uint          `gorm:"index" json:"workspace_id"`
+	NotebookID  *uint          `gorm:"index" json:"notebook_id"`
+	ParentID    *uint          `gorm:"index" json:"parent_id"`
+	Version     int            `gorm:"not null;default:1" json:"version"`
+	Language    string         `gorm:"size:8;index" json:"language"`
+	Pinned      bool           `gorm:"not null;default:false" json:"pinned"`
+	Archived    bool           `gorm:"not null;default:false" json:"archived"`
+	Favorite    bool           `gorm:"not null;default:false" json:"favorite"`
+	Position    string         `gorm:"type:text COLLATE \"C\"" json:"position"`
+	Tags        []Tag          `gorm:"many2many:note_tags" json:"tags"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// BeforeCreate определяет язык новой заметки и ставит ее в конец ручного порядка блокнота
+func (n *Note) BeforeCreate(tx *gorm.DB) error {
+	n.Language = DetectNoteLanguage(n.Title, n.Content)
+	if n.Position == "" {
+		position, err := NextNotePosition(tx.Session(&gorm.Session{NewDB: true}), NoteSpace(n), n.NotebookID)
+		if err != nil {
+			return err
+		}
+		n.Position = position
+	}
+	return nil
+}
+
+// DetectNoteLanguage определяет язык заметки по заголовку и содержимому
+func DetectNoteLanguage(title, content string) string {
+	return language.Detect(title + "\n" + content)
+}
+
+// NoteVersionIncrement — значение колонки version для Updates и UpdateColumns. Любое
+// изменение полей заметки увеличивает ее версию, чтобы сменился ETag.
+func NoteVersionIncrement() clause.Expr {
+	return gorm.Expr("version + 1")
+}
+
+// ErrNoteVersionConflict возвращается, если заметку изменили после того, как ее прочитали
+var ErrNoteVersionConflict = errors.New("заметка была изменена другим запросом")
+
+// SaveNoteVersion сохраняет заголовок, содержимое и блокнот заметки, только если версия
+// в базе данных совпадает с note.Version, и увеличивает версию. Язык заметки определяется заново.
+func SaveNoteVersion(tx *gorm.DB, note *Note) error {
+	now := time.Now()
+	note.Language = DetectNoteLanguage(note.Title, note.Content)
+	result := tx.Model(&Note{}).
+		Where("id = ? AND version = ?", note.ID, note.Version).
+		Updates(map[string]interface{}{
+			"title":       note.Title,
+			"content":     note.Content,
+			"notebook_id": note.NotebookID,
+			"language":    note.Language,
+			"version":     NoteVersionIncrement(),
+			"updated_at":  now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoteVersionConflict
+	}
+	note.Version++
+	note.UpdatedAt = now
+	return nil
+}
+
+// PurgeNotes безвозвратно удаляет заметки вместе со связанными записями, минуя корзину
+func PurgeNotes(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM note_tags WHERE note_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&NoteRevision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&NoteShare{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&PublicLink{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&NoteSuggestion{}).Error; err != nil {
+		return err
+	}
+	// Уцелевшие дочерние заметки становятся корневыми, чтобы не ссылаться на удаленных родителей
+	if err := tx.Unscoped().Model(&Note{}).Where("parent_id IN ? AND id NOT IN ?", ids, ids).
+		Updates(map[string]interface{}{"parent_id": nil, "version": NoteVersionIncrement()}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&Note{}, ids).Error
+}
+
+// SubtreeNoteIDs возвращает ID заметки и всех ее потомков, не находящихся в корзине.
+// Корень идет первым, затем потомки в порядке обхода в ширину.
+func SubtreeNoteIDs(tx *gorm.DB, space Space, rootID uint) ([]uint, error) {
+	var ids []uint
+	condition, args := space.notesCondition()
+	err := tx.Raw(`
+		WITH RECURSIVE subtree (id, depth) AS (
+			SELECT id, 0 FROM notes WHERE id = ? AND `+condition+` AND deleted_at IS NULL
+			UNION
+			SELECT notes.id, subtree.depth + 1 FROM notes JOIN subtree ON notes.parent_id = subtree.id
+			WHERE notes.deleted_at IS NULL
+		)
+		SELECT id FROM subtree ORDER BY depth, id`, append([]interface{}{rootID}, args...)...).Scan(&ids).Error
+	return ids, err
+}
+
+// TrashedSubtreeNoteIDs возвращает ID заметки из корзины и ее потомков, удаленных
+// вместе с ней одной операцией (с тем же моментом удаления)
+func TrashedSubtreeNoteIDs(tx *gorm.DB, space Space, rootID uint) ([]uint, error) {
+	var ids []uint
+	condition, args := space.notesCondition()
+	err := tx.Raw(`
+		WITH RECURSIVE subtree (id, deleted_at) AS (
+			SELECT id, deleted_at FROM notes WHERE id = ? AND `+condition+` AND deleted_at IS NOT NULL
+			UNION
+			SELECT notes.id, notes.deleted_at FROM notes JOIN subtree ON notes.parent_id = subtree.id
+			WHERE notes.deleted_at = subtree.deleted_at
+		)
+		SELECT id FROM subtree`, append([]interface{}{rootID}, args...)...).Scan(&ids).Error
+	return ids, err
+}
+
+// TrashNotes перемещает заметки в корзину с общим моментом удаления
+func TrashNotes(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	// Мягкое удаление GORM проставляет deleted_at одним запросом
+	return tx.Where("id IN ?", ids).Delete(&Note{}).Error
+}
+
+// NoteNode представляет заметку в дереве иерархии
+type NoteNode struct {
+	ID       uint        `json:"id"`
+	Title    string      `json:"title"`
+	ParentID *uint       `json:"parent_id"`
+	Children []*NoteNode `json:"children"`
+}
+
+// BuildNoteTree строит лес заметок по ссылкам на родителей. Заметки, родитель которых
+// отсутствует в наборе, становятся корнями. Порядок детей совпадает с порядком во входном срезе.
+func BuildNoteTree(notes []Note) []*NoteNode {
+	nodes := make(map[uint]*NoteNode, len(notes))
+	for _, note := range notes {
+		nodes[note.ID] = &NoteNode{
+			ID:       note.ID,
+			Title:    note.Title,
+			ParentID: note.ParentID,
+			Children: []*NoteNode{},
+		}
+	}
+
+	roots := []*NoteNode{}
+	for _, note := range notes {
+		node := nodes[note.ID]
+		if note.ParentID != nil {
+			if parent, ok := nodes[*note.ParentID]; ok && parent != node {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"github.com/omega/notes-app/internal/ordering"
+	"gorm.io/gorm"
+)
+
+// NotePositionGroup — заметки одного блокнота пространства, среди которых действует ручной порядок
+type NotePositionGroup struct {
+	UserID      uint
+	WorkspaceID *uint
+	NotebookID  *uint
+}
+
+// Space возвращает пространство группы
+func (g NotePositionGroup) Space() Space {
+	return Space{UserID: g.UserID, WorkspaceID: g.WorkspaceID}
+}
+
+// notePositionScope ограничивает выборку живыми заметками группы
+func notePositionScope(tx *gorm.DB, space Space, notebookID *uint) *gorm.DB {
+	return tx.Model(&Note{}).Scopes(space.Notes).Where("notes.notebook_id IS NOT DISTINCT FROM ?", notebookID)
+}
+
+// NextNotePosition возвращает ключ порядка после последней заметки блокнота
+func NextNotePosition(tx *gorm.DB, space Space, notebookID *uint) (string, error) {
+	var last *string
+	if err := notePositionScope(tx, space, notebookID).Select("MAX(position)").Scan(&last).Error; err != nil {
+		return "", err
+	}
+	if last == nil || !ordering.Valid(*last) {
+		return ordering.Between("", "")
+	}
+	return ordering.Between(*last, "")
+}
+
+// NoteNeighbourPosition возвращает ключ ближайшей соседней заметки группы: следующей
+// после position, если next равен true, и предыдущей иначе. Пустая строка означает,
+// что соседа нет.
+func NoteNeighbourPosition(tx *gorm.DB, note *Note, position string, next bool) (string, error) {
+	query := notePositionScope(tx, NoteSpace(note), note.NotebookID).Where("id <> ?", note.ID)
+	if next {
+		query = query.Where("position > ?", position).Order("position ASC")
+	} else {
+		query = query.Where("position < ?", position).Order("position DESC")
+	}
+
+	var positions []string
+	if err := query.Limit(1).Pluck("position", &positions).Error; err != nil {
+		return "", err
+	}
+	if len(positions) == 0 {
+		return "", nil
+	}
+	return positions[0], nil
+}
+
+// RebalanceNotePositions заново расставляет ключи порядка в группе равномерно, сохраняя
+// текущий порядок. Заметки без ключа оказываются в конце в порядке создания.
+func RebalanceNotePositions(tx *gorm.DB, group NotePositionGroup) error {
+	var ids []uint
+	err := notePositionScope(tx, group.Space(), group.NotebookID).
+		Order("position ASC NULLS LAST, created_at, id").
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	for i, key := range ordering.Spread(len(ids)) {
+		if err := tx.Model(&Note{}).Where("id = ?", ids[i]).
+			UpdateColumns(map[string]interface{}{"position": key, "version": NoteVersionIncrement()}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnbalancedNotePositionGroups возвращает группы, где у заметок нет ключа порядка или
+// ключи стали длиннее ordering.RebalanceKeyLength
+func UnbalancedNotePositionGroups(tx *gorm.DB) ([]NotePositionGroup, error) {
+	// В рабочем пространстве группа не зависит от автора заметок
+	var groups []NotePositionGroup
+	err := tx.Model(&Note{}).
+		Select("MIN(user_id) AS user_id, workspace_id, notebook_id").
+		Group("workspace_id, notebook_id, CASE WHEN workspace_id IS NULL THEN user_id END").
+		Having("COUNT(*) > COUNT(position) OR MAX(LENGTH(position)) > ?", ordering.RebalanceKeyLength).
+		Scan(&groups).Error
+	return groups, err
+}
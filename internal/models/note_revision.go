@@ -0,0 +1,94 @@
+package models
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// NoteRevision представляет сохраненную версию заметки
+type NoteRevision struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	NoteID   uint   `gorm:"not null;uniqueIndex:idx_note_revisions_note_number" json:"note_id"`
+	Number   int    `gorm:"not null;uniqueIndex:idx_note_revisions_note_number" json:"number"`
+	AuthorID uint   `gorm:"not null" json:"author_id"`
+	Title    string `gorm:"size:255;not null" json:"title"`
+	Content  string `gorm:"type:text" json:"content,omitempty"`
+	// UpdatedAt отличается от CreatedAt, если в ревизию были объединены последующие сохранения
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultRevisionCoalesceWindow — интервал, в пределах которого сохранения одного автора
+// объединяются в одну ревизию
+const DefaultRevisionCoalesceWindow = 5 * time.Minute
+
+// RevisionCoalesceWindow возвращает интервал объединения ревизий из REVISION_COALESCE_SECONDS
+func RevisionCoalesceWindow() time.Duration {
+	window := DefaultRevisionCoalesceWindow
+	if value := os.Getenv("REVISION_COALESCE_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			log.Printf("Некорректное значение REVISION_COALESCE_SECONDS=%q, используется %s", value, window)
+		} else {
+			window = time.Duration(seconds) * time.Second
+		}
+	}
+	return window
+}
+
+// EnsureBaselineRevision сохраняет состояние заметки как первую ревизию, если у заметки
+// еще нет истории (например, она создана до появления ревизий). Время ревизии совпадает
+// с временем последнего изменения заметки.
+func EnsureBaselineRevision(tx *gorm.DB, note *Note) error {
+	var count int64
+	if err := tx.Model(&NoteRevision{}).Where("note_id = ?", note.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Create(&NoteRevision{
+		NoteID:    note.ID,
+		Number:    1,
+		AuthorID:  note.UserID,
+		Title:     note.Title,
+		Content:   note.Content,
+		CreatedAt: note.UpdatedAt,
+		UpdatedAt: note.UpdatedAt,
+	}).Error
+}
+
+// RecordRevision сохраняет текущее состояние заметки в истории. Если последняя ревизия
+// того же автора изменялась не раньше чем window назад, она перезаписывается вместо
+// создания новой. Нулевой window всегда создает новую ревизию.
+func RecordRevision(tx *gorm.DB, note *Note, authorID uint, window time.Duration) error {
+	var latest NoteRevision
+	result := tx.Where("note_id = ?", note.ID).Order("number DESC").Limit(1).Find(&latest)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		// Сохранение без изменений не создает ревизию
+		if latest.Title == note.Title && latest.Content == note.Content {
+			return nil
+		}
+		if window > 0 && latest.AuthorID == authorID && time.Since(latest.UpdatedAt) < window {
+			latest.Title = note.Title
+			latest.Content = note.Content
+			return tx.Save(&latest).Error
+		}
+	}
+
+	return tx.Create(&NoteRevision{
+		NoteID:   note.ID,
+		Number:   latest.Number + 1,
+		AuthorID: authorID,
+		Title:    note.Title,
+		Content:  note.Content,
+	}).Error
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Роли пользователя, которому открыт доступ к заметке
+const (
+	ShareRoleViewer    = "viewer"
+	ShareRoleCommenter = "commenter"
+	ShareRoleEditor    = "editor"
+)
+
+// NoteAccess — уровень доступа пользователя к заметке; больший уровень включает меньшие
+type NoteAccess int
+
+// Уровни доступа к заметке
+const (
+	NoteAccessNone NoteAccess = iota
+	NoteAccessView
+	NoteAccessComment
+	NoteAccessEdit
+	NoteAccessOwner
+)
+
+// shareRoleAccess сопоставляет ролям уровни доступа
+var shareRoleAccess = map[string]NoteAccess{
+	ShareRoleViewer:    NoteAccessView,
+	ShareRoleCommenter: NoteAccessComment,
+	ShareRoleEditor:    NoteAccessEdit,
+}
+
+// Role возвращает название роли для уровня доступа; владелец называется owner
+func (a NoteAccess) Role() string {
+	if a == NoteAccessOwner {
+		return "owner"
+	}
+	for role, access := range shareRoleAccess {
+		if access == a {
+			return role
+		}
+	}
+	return ""
+}
+
+// NoteShare представляет доступ другого пользователя к заметке
+type NoteShare struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	NoteID     uint      `gorm:"not null;uniqueIndex:idx_note_shares_note_user" json:"note_id"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_note_shares_note_user;index" json:"user_id"`
+	User       *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role       string    `gorm:"size:16;not null" json:"role"`
+	SharedByID uint      `gorm:"not null" json:"shared_by_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ValidShareRole сообщает, является ли строка допустимой ролью
+func ValidShareRole(role string) bool {
+	_, ok := shareRoleAccess[role]
+	return ok
+}
+
+// WorkspaceNoteAccess возвращает уровень доступа к заметке рабочего пространства по роли
+// участника: администраторы и автор заметки получают полный доступ, остальные участники —
+// редактирование, гости — чтение. Автор, покинувший пространство, доступ теряет.
+func WorkspaceNoteAccess(role string, author bool) NoteAccess {
+	switch {
+	case WorkspaceRoleAtLeast(role, WorkspaceRoleAdmin):
+		return NoteAccessOwner
+	case WorkspaceRoleAtLeast(role, WorkspaceRoleMember) && author:
+		return NoteAccessOwner
+	case WorkspaceRoleAtLeast(role, WorkspaceRoleMember):
+		return NoteAccessEdit
+	case role == WorkspaceRoleGuest:
+		return NoteAccessView
+	}
+	return NoteAccessNone
+}
+
+// NoteAccessFor возвращает уровень доступа пользователя к заметке. Владелец личной заметки
+// получает полный доступ, участники рабочего пространства — по WorkspaceNoteAccess.
+// Доступ, открытый пользователю к заметке, может быть выше его роли в пространстве.
+func NoteAccessFor(tx *gorm.DB, note *Note, userID uint) (NoteAccess, error) {
+	access, err := NotesAccessFor(tx, []Note{*note}, userID)
+	if err != nil {
+		return NoteAccessNone, err
+	}
+	return access[note.ID], nil
+}
+
+// NoteShareAccess возвращает уровень доступа, который пользователю явно открыли к заметке,
+// без учета владения и ролей в рабочих пространствах
+func NoteShareAccess(tx *gorm.DB, noteID, userID uint) (NoteAccess, error) {
+	var shares []NoteShare
+	if err := tx.Where("user_id = ? AND note_id = ?", userID, noteID).Limit(1).Find(&shares).Error; err != nil {
+		return NoteAccessNone, err
+	}
+	if len(shares) == 0 {
+		return NoteAccessNone, nil
+	}
+	return shareRoleAccess[shares[0].Role], nil
+}
+
+// NotesAccessFor возвращает уровни доступа пользователя к нескольким заметкам, например
+// к поддереву: роли в пространствах и открытые доступы загружаются одним запросом каждые
+func NotesAccessFor(tx *gorm.DB, notes []Note, userID uint) (map[uint]NoteAccess, error) {
+	access := make(map[uint]NoteAccess, len(notes))
+	roles := make(map[uint]string)
+	var shared []uint
+	for _, note := range notes {
+		switch {
+		case note.WorkspaceID == nil && note.UserID == userID:
+			access[note.ID] = NoteAccessOwner
+			continue
+		case note.WorkspaceID != nil:
+			role, ok := roles[*note.WorkspaceID]
+			if !ok {
+				var err error
+				if role, err = WorkspaceMemberRole(tx, *note.WorkspaceID, userID); err != nil {
+					return nil, err
+				}
+				roles[*note.WorkspaceID] = role
+			}
+			access[note.ID] = WorkspaceNoteAccess(role, note.UserID == userID)
+		default:
+			access[note.ID] = NoteAccessNone
+		}
+		if access[note.ID] != NoteAccessOwner {
+			shared = append(shared, note.ID)
+		}
+	}
+	if len(shared) == 0 {
+		return access, nil
+	}
+
+	// Роль в доступе к заметке может быть выше гостевой
+	var shares []NoteShare
+	if err := tx.Where("user_id = ? AND note_id IN ?", userID, shared).Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	for _, share := range shares {
+		if shareRoleAccess[share.Role] > access[share.NoteID] {
+			access[share.NoteID] = shareRoleAccess[share.Role]
+		}
+	}
+	return access, nil
+}
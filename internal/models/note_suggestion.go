@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"time"
+	"unicode/utf16"
+
+	"github.com/omega/notes-app/internal/collab"
+	"gorm.io/gorm"
+)
+
+// Состояния предложенной правки
+const (
+	SuggestionStatusOpen     = "open"
+	SuggestionStatusAccepted = "accepted"
+	SuggestionStatusRejected = "rejected"
+	// SuggestionStatusOutdated — заменяемый фрагмент изменили после создания предложения
+	SuggestionStatusOutdated = "outdated"
+)
+
+// Ошибки предложенных правок
+var (
+	ErrSuggestionRange    = errors.New("диапазон выходит за пределы заметки или разрезает символ")
+	ErrSuggestionOutdated = errors.New("заменяемый фрагмент заметки изменился")
+)
+
+// NoteSuggestion представляет предложенную правку: замену фрагмента содержимого заметки
+// [Start, End) текстом Replacement. Позиции считаются в единицах UTF-16, как в совместном
+// редактировании, и сдвигаются при каждом изменении заметки, пока предложение открыто.
+type NoteSuggestion struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	NoteID       uint       `gorm:"not null;index" json:"note_id"`
+	AuthorID     uint       `gorm:"not null;index" json:"author_id"`
+	Author       *User      `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+	Start        int        `gorm:"column:range_start;not null" json:"start"`
+	End          int        `gorm:"column:range_end;not null" json:"end"`
+	Original     string     `gorm:"type:text;not null" json:"original"`
+	Replacement  string     `gorm:"type:text;not null" json:"replacement"`
+	Comment      string     `gorm:"size:1000" json:"comment"`
+	Status       string     `gorm:"size:16;not null;index" json:"status"`
+	ResolvedByID *uint      `json:"resolved_by_id"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ValidSuggestionStatus сообщает, является ли строка допустимым состоянием предложения
+func ValidSuggestionStatus(status string) bool {
+	switch status {
+	case SuggestionStatusOpen, SuggestionStatusAccepted, SuggestionStatusRejected, SuggestionStatusOutdated:
+		return true
+	}
+	return false
+}
+
+// NewNoteSuggestion создает открытое предложение заменить фрагмент [start, end) содержимого
+// текстом replacement и запоминает заменяемый текст
+func NewNoteSuggestion(content string, start, end int, replacement string) (*NoteSuggestion, error) {
+	units := utf16.Encode([]rune(content))
+	if start < 0 || start > end || end > len(units) || splitsSurrogate(units, start) || splitsSurrogate(units, end) {
+		return nil, ErrSuggestionRange
+	}
+	return &NoteSuggestion{
+		Start:       start,
+		End:         end,
+		Original:    string(utf16.Decode(units[start:end])),
+		Replacement: replacement,
+		Status:      SuggestionStatusOpen,
+	}, nil
+}
+
+// Apply возвращает содержимое с примененной правкой. Если фрагмент на месте предложения
+// уже не совпадает с заменяемым текстом, возвращается ErrSuggestionOutdated.
+func (s *NoteSuggestion) Apply(content string) (string, error) {
+	if !s.matches(content) {
+		return "", ErrSuggestionOutdated
+	}
+	units := utf16.Encode([]rune(content))
+	result := make([]uint16, 0, len(units))
+	result = append(result, units[:s.Start]...)
+	result = append(result, utf16.Encode([]rune(s.Replacement))...)
+	result = append(result, units[s.End:]...)
+	return string(utf16.Decode(result)), nil
+}
+
+// Rebase переносит открытое предложение через изменение change, после которого содержимое
+// стало content. Если заменяемый фрагмент затронут изменением, предложение становится
+// устаревшим. Возвращает true, если предложение изменилось.
+func (s *NoteSuggestion) Rebase(change *collab.Operation, content string) bool {
+	if s.Status != SuggestionStatusOpen {
+		return false
+	}
+	start := collab.TransformIndex(change, s.Start)
+	moved := *s
+	moved.Start, moved.End = start, start+(s.End-s.Start)
+	if !moved.matches(content) {
+		s.Status = SuggestionStatusOutdated
+		return true
+	}
+	if moved.Start == s.Start {
+		return false
+	}
+	s.Start, s.End = moved.Start, moved.End
+	return true
+}
+
+// matches проверяет, что на месте предложения в content находится заменяемый текст
+func (s *NoteSuggestion) matches(content string) bool {
+	units := utf16.Encode([]rune(content))
+	if s.Start < 0 || s.Start > s.End || s.End > len(units) {
+		return false
+	}
+	return string(utf16.Decode(units[s.Start:s.End])) == s.Original
+}
+
+// RebaseSuggestions переносит открытые предложения заметки через изменение ее содержимого
+func RebaseSuggestions(tx *gorm.DB, noteID uint, before, after string) error {
+	if before == after {
+		return nil
+	}
+	var suggestions []NoteSuggestion
+	if err := tx.Where("note_id = ? AND status = ?", noteID, SuggestionStatusOpen).Find(&suggestions).Error; err != nil {
+		return err
+	}
+	change := collab.DiffWords(before, after)
+	for i := range suggestions {
+		s := &suggestions[i]
+		if !s.Rebase(change, after) {
+			continue
+		}
+		err := tx.Model(s).Updates(map[string]interface{}{
+			"range_start": s.Start,
+			"range_end":   s.End,
+			"status":      s.Status,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitsSurrogate сообщает, что позиция приходится на середину суррогатной пары
+func splitsSurrogate(units []uint16, pos int) bool {
+	return pos > 0 && pos < len(units) && units[pos] >= 0xDC00 && units[pos] < 0xE000
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notebook представляет блокнот, в котором группируются заметки. Блокнот принадлежит
+// личному пространству пользователя или рабочему пространству; UserID — его создатель.
+// В каждом пространстве есть ровно один блокнот по умолчанию.
+type Notebook struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:255;not null" json:"name"`
+	UserID      uint      `gorm:"not null;index;uniqueIndex:idx_notebooks_personal_default,where:is_default AND workspace_id IS NULL" json:"user_id"`
+	WorkspaceID *uint     `gorm:"index;uniqueIndex:idx_notebooks_workspace_default,where:is_default" json:"workspace_id"`
+	IsDefault   bool      `gorm:"not null;default:false;uniqueIndex:idx_notebooks_personal_default;uniqueIndex:idx_notebooks_workspace_default" json:"is_default"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DefaultNotebookName — имя блокнота по умолчанию
+const DefaultNotebookName = "Заметки"
+
+// DefaultNotebook возвращает блокнот пространства по умолчанию, создавая его при первом обращении.
+// Уникальный частичный индекс не позволяет завести второй такой блокнот при гонке запросов.
+func DefaultNotebook(tx *gorm.DB, space Space) (*Notebook, error) {
+	notebook := Notebook{Name: DefaultNotebookName}
+	err := tx.Scopes(space.Notebooks).Where("is_default").
+		Attrs(Notebook{UserID: space.UserID, WorkspaceID: space.WorkspaceID, IsDefault: true}).
+		FirstOrCreate(&notebook).Error
+	if err != nil {
+		return nil, err
+	}
+	return &notebook, nil
+}
+
+// Режимы удаления блокнота: заметки переносятся в блокнот по умолчанию или в корзину
+const (
+	NotebookDeleteMove  = "move"
+	NotebookDeleteTrash = "trash"
+)
+
+// DeleteNotebook удаляет блокнот. В режиме NotebookDeleteMove его заметки, включая
+// заметки из корзины, переносятся в блокнот пространства по умолчанию, чтобы после
+// восстановления попасть в существующий блокнот. В режиме NotebookDeleteTrash заметки
+// перемещаются в корзину.
+func DeleteNotebook(tx *gorm.DB, notebook *Notebook, mode string) error {
+	if mode == NotebookDeleteTrash {
+		var ids []uint
+		if err := tx.Model(&Note{}).Where("notebook_id = ?", notebook.ID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if err := TrashNotes(tx, ids); err != nil {
+			return err
+		}
+	} else {
+		defaultNotebook, err := DefaultNotebook(tx, NotebookSpace(notebook))
+		if err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Note{}).Where("notebook_id = ?", notebook.ID).
+			Updates(map[string]interface{}{"notebook_id": defaultNotebook.ID, "version": NoteVersionIncrement()}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(notebook).Error
+}
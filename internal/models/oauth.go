@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuthClient представляет стороннее приложение, зарегистрированное пользователем
+type OAuthClient struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ClientID     string    `gorm:"size:64;not null;uniqueIndex" json:"client_id"`
+	SecretHash   string    `gorm:"size:64" json:"-"`
+	Name         string    `gorm:"size:255;not null" json:"name"`
+	RedirectURIs []string  `gorm:"type:text;serializer:json;not null" json:"redirect_uris"`
+	Scopes       []string  `gorm:"type:text;serializer:json;not null" json:"scopes"`
+	Confidential bool      `gorm:"not null;default:false" json:"confidential"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// OAuthCode представляет одноразовый код авторизации, выданный после согласия пользователя
+type OAuthCode struct {
+	ID            uint        `gorm:"primaryKey" json:"id"`
+	CodeHash      string      `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ClientID      uint        `gorm:"not null;index" json:"client_id"`
+	Client        OAuthClient `gorm:"foreignKey:ClientID;constraint:OnDelete:CASCADE" json:"-"`
+	UserID        uint        `gorm:"not null" json:"user_id"`
+	RedirectURI   string      `gorm:"type:text;not null" json:"redirect_uri"`
+	Scopes        []string    `gorm:"type:text;serializer:json;not null" json:"scopes"`
+	CodeChallenge string      `gorm:"size:128;not null" json:"-"`
+	ExpiresAt     time.Time   `gorm:"not null" json:"expires_at"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// OAuthToken представляет пару токенов доступа и обновления, выданную приложению
+type OAuthToken struct {
+	ID               uint        `gorm:"primaryKey" json:"id"`
+	AccessTokenHash  string      `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	RefreshTokenHash string      `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ClientID         uint        `gorm:"not null;index" json:"client_id"`
+	Client           OAuthClient `gorm:"foreignKey:ClientID;constraint:OnDelete:CASCADE" json:"-"`
+	UserID           uint        `gorm:"not null;index" json:"user_id"`
+	Scopes           []string    `gorm:"type:text;serializer:json;not null" json:"scopes"`
+	AccessExpiresAt  time.Time   `gorm:"not null" json:"access_expires_at"`
+	RefreshExpiresAt time.Time   `gorm:"not null" json:"refresh_expires_at"`
+	RevokedAt        *time.Time  `json:"revoked_at,omitempty"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
+
+// AccessActive сообщает, действителен ли токен доступа в момент now
+func (t *OAuthToken) AccessActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.AccessExpiresAt)
+}
+
+// RefreshActive сообщает, действителен ли токен обновления в момент now
+func (t *OAuthToken) RefreshActive(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.RefreshExpiresAt)
+}
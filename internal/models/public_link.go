@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PublicLinkTokenPrefix — префикс токенов публичных ссылок
+const PublicLinkTokenPrefix = "pl_"
+
+// PublicLink представляет публичную ссылку на заметку для чтения без учетной записи.
+// В базе данных хранится только хеш токена; пароль, если задан, хранится как bcrypt-хеш.
+type PublicLink struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	NoteID       uint   `gorm:"not null;index" json:"note_id"`
+	UserID       uint   `gorm:"not null;index" json:"user_id"`
+	TokenHash    string `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	PasswordHash string `gorm:"size:255" json:"-"`
+	HasPassword  bool   `gorm:"-" json:"has_password"`
+	// Snapshot — ссылка показывает копию заметки на момент создания, а не текущую версию
+	Snapshot        bool       `gorm:"not null;default:false" json:"snapshot"`
+	SnapshotTitle   string     `gorm:"size:255" json:"-"`
+	SnapshotContent string     `gorm:"type:text" json:"-"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	ViewCount       int64      `gorm:"not null;default:0" json:"view_count"`
+	LastViewedAt    *time.Time `json:"last_viewed_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// AfterFind заполняет признак наличия пароля для ответа клиенту
+func (l *PublicLink) AfterFind(tx *gorm.DB) error {
+	l.HasPassword = l.PasswordHash != ""
+	return nil
+}
+
+// SetPassword задает пароль ссылки; пустая строка снимает пароль
+func (l *PublicLink) SetPassword(password string) error {
+	l.HasPassword = password != ""
+	if password == "" {
+		l.PasswordHash = ""
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	l.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword проверяет пароль ссылки; ссылка без пароля принимает любой
+func (l *PublicLink) CheckPassword(password string) bool {
+	if l.PasswordHash == "" {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) == nil
+}
+
+// Active сообщает, действует ли ссылка в момент now
+func (l *PublicLink) Active(now time.Time) bool {
+	if l.RevokedAt != nil {
+		return false
+	}
+	return l.ExpiresAt == nil || now.Before(*l.ExpiresAt)
+}
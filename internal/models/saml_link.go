@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// SAMLLinkTTL — сколько действует начатая привязка входа через IdP и ее подтверждение
+const SAMLLinkTTL = 10 * time.Minute
+
+// SAMLLinkRequest — привязка входа через IdP, начатая пользователем. ACS принимает ответ IdP
+// по ней один раз и только в браузере, который начал привязку; учетная запись IdP
+// привязывается после того, как пользователь подтвердит ее.
+type SAMLLinkRequest struct {
+	ID     uint `gorm:"primaryKey" json:"-"`
+	UserID uint `gorm:"not null;index" json:"-"`
+	// RequestID — ID SAML-запроса; сбрасывается, когда ACS принимает ответ на него
+	RequestID *string `gorm:"size:64;uniqueIndex" json:"-"`
+	// NonceHash — хеш nonce из cookie браузера, начавшего привязку
+	NonceHash string `gorm:"size:64;not null" json:"-"`
+	// ConfirmHash — хеш токена подтверждения, выданного после ответа IdP
+	ConfirmHash *string   `gorm:"size:64;uniqueIndex" json:"-"`
+	NameID      string    `gorm:"size:255" json:"-"`
+	Email       string    `gorm:"size:255" json:"-"`
+	ExpiresAt   time.Time `gorm:"not null" json:"-"`
+	CreatedAt   time.Time `json:"-"`
+}
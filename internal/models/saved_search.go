@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// SavedSearch представляет сохраненный поисковый запрос («умный блокнот»),
+// заметки которого вычисляются при каждом обращении
+type SavedSearch struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	Query     string    `gorm:"type:text;not null" json:"query"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
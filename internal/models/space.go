@@ -0,0 +1,91 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Space — пространство, в котором живут заметки и блокноты: личные записи пользователя
+// (WorkspaceID пуст) или записи рабочего пространства, общие для всех его участников
+type Space struct {
+	UserID      uint
+	WorkspaceID *uint
+}
+
+// PersonalSpace возвращает личное пространство пользователя
+func PersonalSpace(userID uint) Space {
+	return Space{UserID: userID}
+}
+
+// NoteSpace возвращает пространство, которому принадлежит заметка
+func NoteSpace(note *Note) Space {
+	return Space{UserID: note.UserID, WorkspaceID: note.WorkspaceID}
+}
+
+// NotebookSpace возвращает пространство, которому принадлежит блокнот
+func NotebookSpace(notebook *Notebook) Space {
+	return Space{UserID: notebook.UserID, WorkspaceID: notebook.WorkspaceID}
+}
+
+// Equal сообщает, совпадают ли пространства: рабочие — по ID, личные — по владельцу
+func (s Space) Equal(other Space) bool {
+	if s.WorkspaceID != nil || other.WorkspaceID != nil {
+		return s.WorkspaceID != nil && other.WorkspaceID != nil && *s.WorkspaceID == *other.WorkspaceID
+	}
+	return s.UserID == other.UserID
+}
+
+// Notes ограничивает выборку заметками пространства; используется с db.Scopes
+func (s Space) Notes(db *gorm.DB) *gorm.DB {
+	condition, args := s.notesCondition()
+	return db.Where(condition, args...)
+}
+
+// notesCondition возвращает условие принадлежности заметки пространству для SQL-запросов
+func (s Space) notesCondition() (string, []interface{}) {
+	if s.WorkspaceID != nil {
+		return "notes.workspace_id = ?", []interface{}{*s.WorkspaceID}
+	}
+	return "notes.user_id = ? AND notes.workspace_id IS NULL", []interface{}{s.UserID}
+}
+
+// Notebooks ограничивает выборку блокнотами пространства; используется с db.Scopes
+func (s Space) Notebooks(db *gorm.DB) *gorm.DB {
+	if s.WorkspaceID != nil {
+		return db.Where("notebooks.workspace_id = ?", *s.WorkspaceID)
+	}
+	return db.Where("notebooks.user_id = ? AND notebooks.workspace_id IS NULL", s.UserID)
+}
+
+// TagSpace возвращает пространство, которому принадлежит тег
+func TagSpace(tag *Tag) Space {
+	return Space{UserID: tag.UserID, WorkspaceID: tag.WorkspaceID}
+}
+
+// Tags ограничивает выборку тегами пространства; используется с db.Scopes
+func (s Space) Tags(db *gorm.DB) *gorm.DB {
+	if s.WorkspaceID != nil {
+		return db.Where("tags.workspace_id = ?", *s.WorkspaceID)
+	}
+	return db.Where("tags.user_id = ? AND tags.workspace_id IS NULL", s.UserID)
+}
+
+// BurnNotes ограничивает выборку одноразовыми заметками пространства; используется с db.Scopes
+func (s Space) BurnNotes(db *gorm.DB) *gorm.DB {
+	if s.WorkspaceID != nil {
+		return db.Where("burn_notes.workspace_id = ?", *s.WorkspaceID)
+	}
+	return db.Where("burn_notes.user_id = ? AND burn_notes.workspace_id IS NULL", s.UserID)
+}
+
+// LockSpace сериализует изменения иерархии и порядка заметок пространства, блокируя
+// строку пользователя или рабочего пространства до конца транзакции
+func LockSpace(tx *gorm.DB, s Space) error {
+	locked := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id")
+	if s.WorkspaceID != nil {
+		var workspace Workspace
+		return locked.First(&workspace, *s.WorkspaceID).Error
+	}
+	var user User
+	return locked.First(&user, s.UserID).Error
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tag представляет тег, которым можно пометить заметки. Как и блокнот, тег принадлежит
+// личному пространству пользователя или рабочему пространству; UserID — его создатель.
+type Tag struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:100;not null;uniqueIndex:idx_tags_personal_name,where:workspace_id IS NULL;uniqueIndex:idx_tags_workspace_name" json:"name"`
+	UserID      uint      `gorm:"not null;index;uniqueIndex:idx_tags_personal_name" json:"user_id"`
+	WorkspaceID *uint     `gorm:"index;uniqueIndex:idx_tags_workspace_name" json:"workspace_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// FilterNotesByTags ограничивает выборку заметок тегами. В режиме "all" (по умолчанию)
+// заметка должна иметь все перечисленные теги, в режиме "any" — хотя бы один.
+// Имена сравниваются без учета регистра и лишних пробелов, пустые имена пропускаются.
+func FilterNotesByTags(query *gorm.DB, names []string, mode string) (*gorm.DB, error) {
+	lowered := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		key := strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if key != "" && !seen[key] {
+			seen[key] = true
+			lowered = append(lowered, key)
+		}
+	}
+	if len(lowered) == 0 {
+		return query, nil
+	}
+	if mode != "" && mode != "all" && mode != "any" {
+		return nil, errors.New("tag_mode должен быть all или any")
+	}
+
+	subquery := query.Session(&gorm.Session{NewDB: true}).
+		Table("note_tags").
+		Select("note_tags.note_id").
+		Joins("JOIN tags ON tags.id = note_tags.tag_id").
+		Where("LOWER(tags.name) IN ?", lowered)
+	if mode != "any" {
+		subquery = subquery.Group("note_tags.note_id").Having("COUNT(DISTINCT LOWER(tags.name)) = ?", len(lowered))
+	}
+
+	return query.Where("notes.id IN (?)", subquery), nil
+}
@@ -9,23 +9,50 @@ import (
 
 // User представляет модель пользователя в системе
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"size:255;not null;unique" json:"username"`
-	Email     string    `gorm:"size:255;not null;unique" json:"email"`
-	Password  string    `gorm:"size:255;not null" json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Notes     []Note    `gorm:"foreignKey:UserID" json:"notes,omitempty"`
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"size:255;not null;unique" json:"username"`
+	Email    string `gorm:"size:255;not null;unique" json:"email"`
+	Password string `gorm:"size:255;not null" json:"-"`
+	// ExternalID — идентификатор пользователя во внешнем IdP (SCIM externalId)
+	ExternalID *string `gorm:"size:255;uniqueIndex" json:"-"`
+	// SAMLSubject — NameID пользователя в SAML IdP, привязанный к учетной записи
+	SAMLSubject *string `gorm:"size:255;uniqueIndex" json:"-"`
+	// SuspendedAt — время блокировки учетной записи; заблокированный пользователь не может войти
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Notes       []Note     `gorm:"foreignKey:UserID" json:"notes,omitempty"`
+
+	// passwordHashed отмечает, что Password уже содержит хеш: пароль загружен из базы
+	// или захеширован при сохранении
+	passwordHashed bool
+}
+
+// AfterFind отмечает пароль загруженного пользователя как хеш, чтобы повторное
+// сохранение не хешировало его еще раз
+func (u *User) AfterFind(tx *gorm.DB) error {
+	u.passwordHashed = true
+	return nil
+}
+
+// SetPassword задает новый пароль открытым текстом; он будет захеширован при сохранении
+func (u *User) SetPassword(password string) {
+	u.Password = password
+	u.passwordHashed = false
 }
 
 // BeforeSave хеширует пароль пользователя перед сохранением в базу данных
 func (u *User) BeforeSave(tx *gorm.DB) error {
+	if u.passwordHashed {
+		return nil
+	}
 	if len(u.Password) > 0 {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return err
 		}
 		u.Password = string(hashedPassword)
+		u.passwordHashed = true
 	}
 	return nil
 }
@@ -33,4 +60,9 @@ func (u *User) BeforeSave(tx *gorm.DB) error {
 // ValidatePassword проверяет, соответствует ли предоставленный пароль хешированному паролю пользователя
 func (u *User) ValidatePassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-} 
\ No newline at end of file
+}
+
+// IsSuspended сообщает, заблокирована ли учетная запись пользователя
+func (u *User) IsSuspended() bool {
+	return u.SuspendedAt != nil
+}
@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Роли участников рабочего пространства
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleAdmin  = "admin"
+	WorkspaceRoleMember = "member"
+	WorkspaceRoleGuest  = "guest"
+)
+
+// workspaceRoleRank упорядочивает роли: старшая роль включает права младших
+var workspaceRoleRank = map[string]int{
+	WorkspaceRoleGuest:  1,
+	WorkspaceRoleMember: 2,
+	WorkspaceRoleAdmin:  3,
+	WorkspaceRoleOwner:  4,
+}
+
+// Время жизни приглашения в рабочее пространство
+const WorkspaceInvitationTTL = 7 * 24 * time.Hour
+
+// WorkspaceInvitationTokenPrefix — префикс токенов приглашений
+const WorkspaceInvitationTokenPrefix = "wsi_"
+
+// Workspace представляет рабочее пространство команды с общими заметками и блокнотами
+type Workspace struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"size:255;not null" json:"name"`
+	// ExternalID — идентификатор группы во внешнем IdP (SCIM externalId)
+	ExternalID *string   `gorm:"size:255;uniqueIndex" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// WorkspaceMember представляет участника рабочего пространства и его роль
+type WorkspaceMember struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint   `gorm:"not null;uniqueIndex:idx_workspace_members_workspace_user" json:"workspace_id"`
+	UserID      uint   `gorm:"not null;uniqueIndex:idx_workspace_members_workspace_user;index" json:"user_id"`
+	User        *User  `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Role        string `gorm:"size:16;not null" json:"role"`
+	// Provisioned — участника добавил IdP через SCIM: только такие участники входят в группу
+	// SCIM, и только их IdP может исключить
+	Provisioned bool      `gorm:"not null;default:false" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WorkspaceInvitation представляет приглашение в рабочее пространство по email.
+// Принять его может только пользователь с этим адресом; хранится только хеш токена.
+type WorkspaceInvitation struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint       `gorm:"not null;index" json:"workspace_id"`
+	Email       string     `gorm:"size:255;not null" json:"email"`
+	Role        string     `gorm:"size:16;not null" json:"role"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	InvitedByID uint       `gorm:"not null" json:"invited_by_id"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Pending сообщает, можно ли еще принять приглашение в момент now
+func (i *WorkspaceInvitation) Pending(now time.Time) bool {
+	return i.AcceptedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// WorkspaceMemberRole возвращает роль пользователя в рабочем пространстве или пустую
+// строку, если он не участник
+func WorkspaceMemberRole(tx *gorm.DB, workspaceID, userID uint) (string, error) {
+	var member WorkspaceMember
+	result := tx.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).Limit(1).Find(&member)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	return member.Role, nil
+}
+
+// ValidWorkspaceRole сообщает, является ли строка ролью участника
+func ValidWorkspaceRole(role string) bool {
+	_, ok := workspaceRoleRank[role]
+	return ok
+}
+
+// WorkspaceRoleAtLeast сообщает, не ниже ли роль role роли min
+func WorkspaceRoleAtLeast(role, min string) bool {
+	return workspaceRoleRank[role] >= workspaceRoleRank[min]
+}
+
+// PurgeWorkspace безвозвратно удаляет рабочее пространство вместе с его заметками, блокнотами,
+// тегами, одноразовыми заметками, участниками и приглашениями. Возвращает число удаленных заметок.
+func PurgeWorkspace(tx *gorm.DB, workspaceID uint) (int, error) {
+	var ids []uint
+	if err := tx.Unscoped().Model(&Note{}).Where("workspace_id = ?", workspaceID).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if err := PurgeNotes(tx, ids); err != nil {
+		return 0, err
+	}
+	for _, model := range []interface{}{&Notebook{}, &Tag{}, &BurnNote{}, &WorkspaceInvitation{}, &WorkspaceMember{}} {
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(model).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Delete(&Workspace{}, workspaceID).Error
+}
@@ -0,0 +1,123 @@
+package ordering
+
+import (
+	"errors"
+	"strings"
+)
+
+// digits — алфавит ключей. Символы идут в порядке возрастания кодов ASCII, поэтому ключи
+// сравниваются обычным побайтовым сравнением строк (в PostgreSQL — с COLLATE "C").
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const base = len(digits)
+
+// RebalanceKeyLength — длина ключа, после которой порядок стоит перестроить с помощью Spread
+const RebalanceKeyLength = 16
+
+// ErrInvalidKey возвращается для ключа с недопустимыми символами или нулем в конце
+var ErrInvalidKey = errors.New("неверный ключ порядка")
+
+// ErrInvalidOrder возвращается, если левая граница не меньше правой
+var ErrInvalidOrder = errors.New("левый ключ должен быть меньше правого")
+
+// Between возвращает ключ, лежащий строго между a и b. Пустая строка означает отсутствие
+// границы: Between("", "") дает первый ключ, Between(a, "") — ключ после a.
+//
+// Ключ рассматривается как дробь 0.k1k2... в системе счисления по основанию 62, поэтому
+// между любыми двумя ключами всегда есть еще один. Ключи не заканчиваются нулем,
+// иначе ниже них могло бы не найтись места.
+func Between(a, b string) (string, error) {
+	if a != "" && !Valid(a) || b != "" && !Valid(b) {
+		return "", ErrInvalidKey
+	}
+	if a != "" && b != "" && a >= b {
+		return "", ErrInvalidOrder
+	}
+	return midpoint(a, b), nil
+}
+
+// midpoint ищет ключ между a и b, когда известно, что a < b или b пуст
+func midpoint(a, b string) string {
+	if b != "" {
+		// Общий префикс (a дополняется нулями) переносится в результат без изменений
+		n := 0
+		for n < len(b) && digitAt(a, n) == strings.IndexByte(digits, b[n]) {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:])
+		}
+	}
+
+	digitA := digitAt(a, 0)
+	digitB := base
+	if b != "" {
+		digitB = strings.IndexByte(digits, b[0])
+	}
+	if digitB-digitA > 1 {
+		return string(digits[(digitA+digitB)/2])
+	}
+
+	// Первые цифры соседние: если b длиннее одной цифры, подходит ее первая цифра
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(digits[digitA]) + midpoint(rest, "")
+}
+
+// digitAt возвращает значение i-й цифры ключа, считая недостающие цифры нулями
+func digitAt(key string, i int) int {
+	if i >= len(key) {
+		return 0
+	}
+	return strings.IndexByte(digits, key[i])
+}
+
+// Spread возвращает n возрастающих ключей, равномерно распределенных по всему диапазону.
+// Используется для первоначальной расстановки и перестройки слишком длинных ключей.
+func Spread(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+
+	// Подбираем наименьшую длину, при которой ключи не совпадают
+	length, capacity := 1, uint64(base)
+	for capacity <= uint64(n) {
+		length++
+		capacity *= uint64(base)
+	}
+	step := capacity / uint64(n+1)
+
+	keys := make([]string, n)
+	for i := range keys {
+		value := step * uint64(i+1)
+		key := make([]byte, length)
+		for j := length - 1; j >= 0; j-- {
+			key[j] = digits[value%uint64(base)]
+			value /= uint64(base)
+		}
+		keys[i] = strings.TrimRight(string(key), "0")
+	}
+	return keys
+}
+
+// Valid сообщает, является ли строка допустимым ключом
+func Valid(key string) bool {
+	if key == "" || key[len(key)-1] == digits[0] {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
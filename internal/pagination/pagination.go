@@ -0,0 +1,66 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Размер страницы по умолчанию и максимальный размер страницы
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrInvalidCursor возвращается для поврежденного курсора или курсора от другой сортировки
+var ErrInvalidCursor = errors.New("неверный курсор")
+
+// Cursor указывает на последнюю запись страницы. Sort фиксирует сортировку, для которой
+// выдан курсор, Value — значение поля сортировки, ID — ключ для однозначного порядка,
+// Pinned — находится ли запись в группе закрепленных, которая идет перед остальными.
+type Cursor struct {
+	Sort   string `json:"s"`
+	Value  string `json:"v"`
+	ID     uint   `json:"id"`
+	Pinned bool   `json:"p,omitempty"`
+}
+
+// Encode кодирует курсор в непрозрачную строку для клиента
+func Encode(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode разбирает курсор и проверяет, что он выдан для сортировки sort
+func Decode(raw, sort string) (Cursor, error) {
+	var cursor Cursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Sort != sort {
+		return cursor, fmt.Errorf("%w: курсор выдан для другой сортировки", ErrInvalidCursor)
+	}
+	return cursor, nil
+}
+
+// ParseLimit разбирает размер страницы: пустое значение дает DefaultLimit,
+// значения больше MaxLimit ограничиваются
+func ParseLimit(raw string) (int, error) {
+	if raw == "" {
+		return DefaultLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit должен быть положительным числом")
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	return limit, nil
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter ограничивает число неудачных попыток по ключу в фиксированном окне времени.
+// Состояние хранится в памяти процесса.
+type Limiter struct {
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]*attempts
+	lastSweep time.Time
+}
+
+type attempts struct {
+	start time.Time
+	count int
+}
+
+// New создает ограничитель, допускающий limit неудачных попыток за окно window
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		window:   window,
+		attempts: make(map[string]*attempts),
+	}
+}
+
+// Allow сообщает, можно ли сделать попытку по ключу в момент now. Если лимит исчерпан,
+// возвращает время до начала нового окна.
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok || !now.Before(a.start.Add(l.window)) || a.count < l.limit {
+		return true, 0
+	}
+	return false, a.start.Add(l.window).Sub(now)
+}
+
+// Fail учитывает неудачную попытку по ключу в момент now
+func (l *Limiter) Fail(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Истекшие окна удаляются не чаще раза за окно, чтобы карта не росла бесконечно
+	if now.Sub(l.lastSweep) >= l.window {
+		for k, a := range l.attempts {
+			if !now.Before(a.start.Add(l.window)) {
+				delete(l.attempts, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	a, ok := l.attempts[key]
+	if !ok || !now.Before(a.start.Add(l.window)) {
+		l.attempts[key] = &attempts{start: now, count: 1}
+		return
+	}
+	a.count++
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
 	"github.com/omega/notes-app/internal/handlers"
 	"github.com/omega/notes-app/internal/middleware"
 )
@@ -12,28 +13,200 @@ func SetupRoutes(router *gin.Engine) {
 	api := router.Group("/api")
 	{
 		// Маршруты для аутентификации (без middleware)
-		auth := api.Group("/auth")
+		authGroup := api.Group("/auth")
 		{
-			auth.POST("/register", handlers.Register)
-			auth.POST("/login", handlers.Login)
+			authGroup.POST("/register", handlers.Register)
+			authGroup.POST("/login", handlers.Login)
+
+			// SAML SSO: метаданные SP, вход через IdP, привязка к учетной записи с подтверждением и прием ответа IdP
+			saml := authGroup.Group("/saml")
+			{
+				saml.GET("/metadata", handlers.SAMLMetadata)
+				saml.GET("/login", handlers.SAMLLogin)
+				saml.POST("/link", middleware.AuthMiddleware(), middleware.FirstPartyOnly(), handlers.SAMLLink)
+				saml.POST("/link/confirm", middleware.AuthMiddleware(), middleware.FirstPartyOnly(), handlers.SAMLConfirmLink)
+				saml.POST("/acs", handlers.SAMLACS)
+			}
 		}
 
 		// Маршруты, требующие аутентификации
 		user := api.Group("/user")
-		user.Use(middleware.AuthMiddleware())
+		user.Use(middleware.AuthMiddleware(), middleware.RequireScope(auth.ScopeProfile))
 		{
 			user.GET("/profile", handlers.GetProfile)
 		}
 
+		// OAuth2: эндпоинты для сторонних приложений (аутентификация клиента внутри обработчиков)
+		oauth := api.Group("/oauth")
+		{
+			oauth.POST("/token", handlers.OAuthToken)
+			oauth.POST("/introspect", handlers.OAuthIntrospect)
+			oauth.POST("/revoke", handlers.OAuthRevoke)
+		}
+
+		// OAuth2: регистрация приложений и согласие пользователя (только для JWT первой стороны)
+		oauthUser := api.Group("/oauth")
+		oauthUser.Use(middleware.AuthMiddleware(), middleware.FirstPartyOnly())
+		{
+			oauthUser.GET("/authorize", handlers.OAuthAuthorize)
+			oauthUser.POST("/authorize", handlers.OAuthConsent)
+			oauthUser.POST("/clients", handlers.RegisterOAuthClient)
+			oauthUser.GET("/clients", handlers.GetOAuthClients)
+			oauthUser.DELETE("/clients/:id", handlers.DeleteOAuthClient)
+		}
+
 		// Маршруты для заметок (требуют аутентификации)
 		notes := api.Group("/notes")
-		notes.Use(middleware.AuthMiddleware())
+		notes.Use(middleware.AuthMiddleware(), middleware.ScopeMiddleware(auth.ScopeNotesRead, auth.ScopeNotesWrite), middleware.WorkspaceMiddleware())
 		{
 			notes.POST("", handlers.CreateNote)
 			notes.GET("", handlers.GetNotes)
+			notes.GET("/tree", handlers.GetNoteTree)
+			notes.GET("/search", handlers.SearchNotes)
+			notes.GET("/suggest", handlers.SuggestNotes)
+			notes.POST("/state", handlers.SetNoteStates)
+			notes.GET("/shared", handlers.GetSharedNotes)
 			notes.GET("/:id", handlers.GetNote)
 			notes.PUT("/:id", handlers.UpdateNote)
+			notes.PATCH("/:id", handlers.PatchNote)
 			notes.DELETE("/:id", handlers.DeleteNote)
+
+			// Иерархия: перемещение и операции над поддеревом
+			notes.POST("/:id/move", handlers.MoveNote)
+			notes.DELETE("/:id/subtree", handlers.DeleteNoteSubtree)
+			notes.GET("/:id/export", handlers.ExportNoteSubtree)
+			notes.POST("/:id/duplicate", handlers.DuplicateNoteSubtree)
+
+			// История версий
+			notes.GET("/:id/revisions", handlers.GetNoteRevisions)
+			notes.GET("/:id/revisions/diff", handlers.DiffNoteRevisions)
+			notes.GET("/:id/revisions/:rev", handlers.GetNoteRevision)
+			notes.POST("/:id/revisions/:rev/restore", handlers.RestoreNoteRevision)
+
+			// Восстановление из корзины
+			notes.POST("/:id/restore", handlers.RestoreNote)
+			notes.POST("/:id/shares", handlers.ShareNote)
+			notes.GET("/:id/shares", handlers.GetNoteShares)
+			notes.PUT("/:id/shares/:share_id", handlers.UpdateNoteShare)
+			notes.DELETE("/:id/shares/:share_id", handlers.DeleteNoteShare)
+			notes.POST("/:id/links", handlers.CreatePublicLink)
+			notes.GET("/:id/links", handlers.GetPublicLinks)
+			notes.DELETE("/:id/links/:link_id", handlers.RevokePublicLink)
+
+			// Совместное редактирование через WebSocket и присутствие участников
+			notes.GET("/:id/ws", handlers.NoteSocket)
+			notes.GET("/:id/presence", handlers.GetNotePresence)
+
+			// Предложенные правки
+			notes.POST("/:id/suggestions", handlers.CreateSuggestion)
+			notes.GET("/:id/suggestions", handlers.GetSuggestions)
+			notes.POST("/:id/suggestions/:suggestion_id/accept", handlers.AcceptSuggestion)
+			notes.POST("/:id/suggestions/:suggestion_id/reject", handlers.RejectSuggestion)
+		}
+
+		// Маршруты для корзины (требуют аутентификации)
+		trash := api.Group("/trash")
+		trash.Use(middleware.AuthMiddleware(), middleware.ScopeMiddleware(auth.ScopeNotesRead, auth.ScopeNotesWrite), middleware.WorkspaceMiddleware())
+		{
+			trash.GET("", handlers.GetTrash)
+			trash.DELETE("", handlers.EmptyTrash)
 		}
+
+		// Маршруты для блокнотов (требуют аутентификации)
+		notebooks := api.Group("/notebooks")
+		notebooks.Use(middleware.AuthMiddleware(), middleware.ScopeMiddleware(auth.ScopeNotesRead, auth.ScopeNotesWrite), middleware.WorkspaceMiddleware())
+		{
+			notebooks.POST("", handlers.CreateNotebook)
+			notebooks.GET("", handlers.GetNotebooks)
+			notebooks.GET("/:id", handlers.GetNotebook)
+			notebooks.PUT("/:id", handlers.UpdateNotebook)
+			notebooks.DELETE("/:id", handlers.DeleteNotebook)
+			notebooks.GET("/:id/notes", handlers.GetNotebookNotes)
+			notebooks.POST("/:id/notes", handlers.MoveNotesToNotebook)
+		}
+
+		// Маршруты для сохраненных поисков (требуют аутентификации)
+		savedSearches := api.Group("/saved-searches")
+		savedSearches.Use(middleware.AuthMiddleware(), middleware.ScopeMiddleware(auth.ScopeNotesRead, auth.ScopeNotesWrite), middleware.WorkspaceMiddleware())
+		{
+			savedSearches.POST("", handlers.CreateSavedSearch)
+			savedSearches.GET("", handlers.GetSavedSearches)
+			savedSearches.GET("/:id", handlers.GetSavedSearch)
+			savedSearches.PUT("/:id", handlers.UpdateSavedSearch)
+			savedSearches.DELETE("/:id", handlers.DeleteSavedSearch)
+			savedSearches.GET("/:id/notes", handlers.GetSavedSearchNotes)
+		}
+
+		// Маршруты для рабочих пространств (только для JWT первой стороны)
+		workspaces := api.Group("/workspaces")
+		workspaces.Use(middleware.AuthMiddleware(), middleware.FirstPartyOnly())
+		{
+			workspaces.POST("", handlers.CreateWorkspace)
+			workspaces.GET("", handlers.GetWorkspaces)
+			workspaces.GET("/:id", handlers.GetWorkspace)
+			workspaces.PUT("/:id", handlers.UpdateWorkspace)
+			workspaces.DELETE("/:id", handlers.DeleteWorkspace)
+
+			// Участники и приглашения
+			workspaces.GET("/:id/members", handlers.GetWorkspaceMembers)
+			workspaces.PUT("/:id/members/:user_id", handlers.UpdateWorkspaceMember)
+			workspaces.DELETE("/:id/members/:user_id", handlers.DeleteWorkspaceMember)
+			workspaces.POST("/:id/invitations", handlers.CreateInvitation)
+			workspaces.GET("/:id/invitations", handlers.GetInvitations)
+			workspaces.DELETE("/:id/invitations/:invitation_id", handlers.DeleteInvitation)
+		}
+
+		// Принятие приглашения в рабочее пространство
+		invitations := api.Group("/invitations")
+		invitations.Use(middleware.AuthMiddleware(), middleware.FirstPartyOnly())
+		{
+			invitations.POST("/accept", handlers.AcceptInvitation)
+		}
+
+		// Маршруты для одноразовых заметок (требуют аутентификации)
+		burnNotes := api.Group("/burn-notes")
+		burnNotes.Use(middleware.AuthMiddleware(), middleware.ScopeMiddleware(auth.ScopeNotesRead, auth.ScopeNotesWrite), middleware.WorkspaceMiddleware())
+		{
+			burnNotes.POST("", handlers.CreateBurnNote)
+			burnNotes.GET("", handlers.GetBurnNotes)
+			burnNotes.DELETE("/:id", handlers.DeleteBurnNote)
+		}
+
+		// Маршруты для тегов (требуют аутентификации)
+		tags := api.Group("/tags")
+		tags.Use(middleware.AuthMiddleware(), middleware.ScopeMiddleware(auth.ScopeNotesRead, auth.ScopeNotesWrite), middleware.WorkspaceMiddleware())
+		{
+			tags.GET("", handlers.GetTags)
+			tags.PUT("/:id", handlers.RenameTag)
+			tags.POST("/:id/merge", handlers.MergeTag)
+			tags.DELETE("/:id", handlers.DeleteTag)
+		}
+	}
+
+	// Публичные ссылки на заметки открываются без аутентификации
+	router.GET("/p/:token", handlers.ViewPublicLink)
+	router.POST("/p/:token", handlers.ViewPublicLink)
+
+	// Одноразовые заметки: страница не раскрывает заметку, ее получает только POST с ключом
+	router.GET("/s/:id", handlers.ViewBurnNote)
+	router.POST("/s/:id", handlers.RevealBurnNote)
+
+	// SCIM 2.0 для автоматического управления пользователями и группами из IdP
+	scimAPI := router.Group("/scim/v2")
+	scimAPI.Use(middleware.SCIMAuthMiddleware())
+	{
+		scimAPI.GET("/ServiceProviderConfig", handlers.SCIMServiceProviderConfig)
+		scimAPI.GET("/Users", handlers.SCIMListUsers)
+		scimAPI.POST("/Users", handlers.SCIMCreateUser)
+		scimAPI.GET("/Users/:id", handlers.SCIMGetUser)
+		scimAPI.PUT("/Users/:id", handlers.SCIMReplaceUser)
+		scimAPI.PATCH("/Users/:id", handlers.SCIMPatchUser)
+		scimAPI.DELETE("/Users/:id", handlers.SCIMDeleteUser)
+		scimAPI.GET("/Groups", handlers.SCIMListGroups)
+		scimAPI.POST("/Groups", handlers.SCIMCreateGroup)
+		scimAPI.GET("/Groups/:id", handlers.SCIMGetGroup)
+		scimAPI.PUT("/Groups/:id", handlers.SCIMReplaceGroup)
+		scimAPI.PATCH("/Groups/:id", handlers.SCIMPatchGroup)
+		scimAPI.DELETE("/Groups/:id", handlers.SCIMDeleteGroup)
 	}
-} 
\ No newline at end of file
+}
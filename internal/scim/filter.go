@@ -0,0 +1,365 @@
+package scim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// AttributeKind определяет, как значение атрибута сравнивается в SQL
+type AttributeKind int
+
+const (
+	KindString AttributeKind = iota
+	KindInt
+	KindBool
+	KindTime
+	// KindNullAsTrue описывает булев атрибут, хранящийся как nullable-колонка:
+	// NULL означает true (например, active ↔ suspended_at IS NULL)
+	KindNullAsTrue
+)
+
+// Attribute описывает соответствие атрибута SCIM колонке базы данных
+type Attribute struct {
+	Column    string
+	Kind      AttributeKind
+	CaseExact bool
+}
+
+// FilterError описывает ошибку в выражении фильтра с позицией символа
+type FilterError struct {
+	Pos int
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("неверный фильтр (позиция %d): %s", e.Pos, e.Msg)
+}
+
+// CompileFilter преобразует SCIM-фильтр (RFC 7644, раздел 3.4.2.2) в SQL-условие
+// с плейсхолдерами. Поддерживаются операторы eq, ne, co, sw, ew, gt, ge, lt, le, pr,
+// логические and, or, not и группировка скобками.
+func CompileFilter(filter string, attributes map[string]Attribute) (string, []interface{}, error) {
+	p := &filterParser{input: filter, attributes: normalizeAttributes(attributes)}
+	p.next()
+	sql, args, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return "", nil, p.errorf("неожиданный токен %q", p.tok.text)
+	}
+	return sql, args, nil
+}
+
+// ParseValuePath разбирает путь PATCH-операции вида attr[sub eq "value"] (RFC 7644,
+// раздел 3.5.2) и возвращает attr, sub и value. В фильтре пути поддерживается только eq.
+func ParseValuePath(path string) (attr, sub, value string, err error) {
+	open := strings.IndexByte(path, '[')
+	if open <= 0 || !strings.HasSuffix(path, "]") {
+		return "", "", "", &FilterError{Pos: 0, Msg: "ожидается путь вида attr[sub eq \"value\"]"}
+	}
+	p := &filterParser{input: path[:len(path)-1], pos: open + 1}
+	p.next()
+	if p.tok.kind != tokWord {
+		return "", "", "", p.errorf("ожидается имя атрибута")
+	}
+	sub = p.tok.text
+	p.next()
+	if !p.isKeyword("eq") {
+		return "", "", "", p.errorf("в пути поддерживается только оператор eq")
+	}
+	p.next()
+	if p.err != nil {
+		return "", "", "", p.err
+	}
+	if p.tok.kind != tokString && p.tok.kind != tokWord {
+		return "", "", "", p.errorf("ожидается значение")
+	}
+	value = p.tok.text
+	p.next()
+	if p.tok.kind != tokEOF {
+		return "", "", "", p.errorf("неожиданный токен %q", p.tok.text)
+	}
+	return path[:open], sub, value, nil
+}
+
+func normalizeAttributes(attributes map[string]Attribute) map[string]Attribute {
+	// Имена атрибутов SCIM нечувствительны к регистру
+	normalized := make(map[string]Attribute, len(attributes))
+	for name, attr := range attributes {
+		normalized[strings.ToLower(name)] = attr
+	}
+	return normalized
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type filterParser struct {
+	input      string
+	pos        int
+	tok        token
+	err        error
+	attributes map[string]Attribute
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return &FilterError{Pos: p.tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *filterParser) next() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.input) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	switch ch := p.input[p.pos]; {
+	case ch == '(':
+		p.pos++
+		p.tok = token{kind: tokLParen, text: "(", pos: start}
+	case ch == ')':
+		p.pos++
+		p.tok = token{kind: tokRParen, text: ")", pos: start}
+	case ch == '"':
+		p.pos++
+		var sb strings.Builder
+		for p.pos < len(p.input) && p.input[p.pos] != '"' {
+			if p.input[p.pos] == '\\' && p.pos+1 < len(p.input) {
+				p.pos++
+			}
+			sb.WriteByte(p.input[p.pos])
+			p.pos++
+		}
+		if p.pos >= len(p.input) {
+			p.err = &FilterError{Pos: start, Msg: "незакрытая строка"}
+			p.tok = token{kind: tokEOF, pos: start}
+			return
+		}
+		p.pos++
+		p.tok = token{kind: tokString, text: sb.String(), pos: start}
+	default:
+		for p.pos < len(p.input) {
+			r := rune(p.input[p.pos])
+			if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: tokWord, text: p.input[start:p.pos], pos: start}
+	}
+}
+
+func (p *filterParser) isKeyword(keyword string) bool {
+	return p.tok.kind == tokWord && strings.EqualFold(p.tok.text, keyword)
+}
+
+func (p *filterParser) parseOr() (string, []interface{}, error) {
+	sql, args, err := p.parseAnd()
+	if err != nil {
+		return "", nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, rightArgs, err := p.parseAnd()
+		if err != nil {
+			return "", nil, err
+		}
+		sql = "(" + sql + " OR " + right + ")"
+		args = append(args, rightArgs...)
+	}
+	return sql, args, nil
+}
+
+func (p *filterParser) parseAnd() (string, []interface{}, error) {
+	sql, args, err := p.parseUnary()
+	if err != nil {
+		return "", nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, rightArgs, err := p.parseUnary()
+		if err != nil {
+			return "", nil, err
+		}
+		sql = "(" + sql + " AND " + right + ")"
+		args = append(args, rightArgs...)
+	}
+	return sql, args, nil
+}
+
+func (p *filterParser) parseUnary() (string, []interface{}, error) {
+	if p.err != nil {
+		return "", nil, p.err
+	}
+	if p.isKeyword("not") {
+		p.next()
+		if p.tok.kind != tokLParen {
+			return "", nil, p.errorf("после not ожидается '('")
+		}
+		sql, args, err := p.parseUnary()
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + sql, args, nil
+	}
+	if p.tok.kind == tokLParen {
+		p.next()
+		sql, args, err := p.parseOr()
+		if err != nil {
+			return "", nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return "", nil, p.errorf("ожидается ')'")
+		}
+		p.next()
+		return "(" + sql + ")", args, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (string, []interface{}, error) {
+	if p.tok.kind != tokWord {
+		return "", nil, p.errorf("ожидается имя атрибута")
+	}
+	attrName := p.tok.text
+	attr, ok := p.attributes[strings.ToLower(attrName)]
+	if !ok {
+		return "", nil, p.errorf("неподдерживаемый атрибут %q", attrName)
+	}
+	p.next()
+
+	if p.tok.kind != tokWord {
+		return "", nil, p.errorf("ожидается оператор сравнения")
+	}
+	op := strings.ToLower(p.tok.text)
+	opPos := p.tok.pos
+	p.next()
+
+	if op == "pr" {
+		if attr.Kind == KindNullAsTrue {
+			return "TRUE", nil, nil
+		}
+		return attr.Column + " IS NOT NULL", nil, nil
+	}
+
+	valueTok := p.tok
+	if p.err != nil {
+		return "", nil, p.err
+	}
+	if valueTok.kind != tokString && valueTok.kind != tokWord {
+		return "", nil, p.errorf("ожидается значение")
+	}
+	p.next()
+
+	value, err := convertValue(attr, valueTok)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch attr.Kind {
+	case KindBool, KindNullAsTrue:
+		if op != "eq" && op != "ne" {
+			return "", nil, &FilterError{Pos: opPos, Msg: fmt.Sprintf("оператор %s неприменим к булеву атрибуту", op)}
+		}
+		want := value.(bool)
+		if op == "ne" {
+			want = !want
+		}
+		if attr.Kind == KindNullAsTrue {
+			if want {
+				return attr.Column + " IS NULL", nil, nil
+			}
+			return attr.Column + " IS NOT NULL", nil, nil
+		}
+		return attr.Column + " = ?", []interface{}{want}, nil
+	}
+
+	column := attr.Column
+	if attr.Kind == KindString && !attr.CaseExact {
+		column = "LOWER(" + column + ")"
+		value = strings.ToLower(value.(string))
+	}
+
+	switch op {
+	case "eq":
+		return column + " = ?", []interface{}{value}, nil
+	case "ne":
+		return column + " <> ?", []interface{}{value}, nil
+	case "gt":
+		return column + " > ?", []interface{}{value}, nil
+	case "ge":
+		return column + " >= ?", []interface{}{value}, nil
+	case "lt":
+		return column + " < ?", []interface{}{value}, nil
+	case "le":
+		return column + " <= ?", []interface{}{value}, nil
+	case "co", "sw", "ew":
+		s, ok := value.(string)
+		if !ok {
+			return "", nil, &FilterError{Pos: opPos, Msg: fmt.Sprintf("оператор %s применим только к строкам", op)}
+		}
+		s = escapeLike(s)
+		switch op {
+		case "co":
+			s = "%" + s + "%"
+		case "sw":
+			s = s + "%"
+		case "ew":
+			s = "%" + s
+		}
+		return column + " LIKE ?", []interface{}{s}, nil
+	}
+
+	return "", nil, &FilterError{Pos: opPos, Msg: fmt.Sprintf("неизвестный оператор %q", op)}
+}
+
+func convertValue(attr Attribute, tok token) (interface{}, error) {
+	switch attr.Kind {
+	case KindBool, KindNullAsTrue:
+		b, err := strconv.ParseBool(strings.ToLower(tok.text))
+		if err != nil {
+			return nil, &FilterError{Pos: tok.pos, Msg: "ожидается true или false"}
+		}
+		return b, nil
+	case KindInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, &FilterError{Pos: tok.pos, Msg: "ожидается целое число"}
+		}
+		return n, nil
+	case KindTime:
+		t, err := time.Parse(time.RFC3339, tok.text)
+		if err != nil {
+			return nil, &FilterError{Pos: tok.pos, Msg: "ожидается дата в формате RFC 3339"}
+		}
+		return t, nil
+	}
+	if tok.kind != tokString {
+		return nil, &FilterError{Pos: tok.pos, Msg: "строковое значение должно быть в кавычках"}
+	}
+	return tok.text, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,231 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/omega/notes-app/internal/language"
+)
+
+// Config — конфигурация текстового поиска PostgreSQL, совпадающая с определением
+// notes.search_vector. Она приводит к основе и русские, и английские слова.
+const Config = "russian"
+
+// Query — скомпилированный запрос: условие WHERE для таблицы notes и выражение tsquery
+// из положительных текстовых условий для ранжирования и подсветки
+type Query struct {
+	Where   string
+	Args    []interface{}
+	TSQuery string
+	TSArgs  []interface{}
+	HasText bool
+	// Terms — текстовые условия без отрицания, по которым ранжируется нечеткий поиск
+	Terms string
+}
+
+// FuzzyThreshold — минимальное сходство триграмм, при котором заголовок считается
+// совпадением в нечетком поиске
+const FuzzyThreshold = 0.3
+
+// isConditions — условия для значений поля is:
+var isConditions = map[string]string{
+	"tagged":   "EXISTS (SELECT 1 FROM note_tags WHERE note_tags.note_id = notes.id)",
+	"untagged": "NOT EXISTS (SELECT 1 FROM note_tags WHERE note_tags.note_id = notes.id)",
+	"pinned":   "notes.pinned",
+	"archived": "notes.archived",
+	"favorite": "notes.favorite",
+}
+
+// Compile разбирает запрос и превращает его в параметризованное условие для заметок.
+// Условие дополняет выборку, уже ограниченную пространством пользователя: теги и блокноты
+// сверяются с самими заметками. Значения никогда не подставляются в SQL напрямую.
+func Compile(input string) (*Query, error) {
+	return compile(input, &compiler{})
+}
+
+// CompileFuzzy работает как Compile, но слова и фразы сравниваются с заголовком заметки
+// по сходству триграмм, что допускает опечатки. Остальные условия не меняются.
+func CompileFuzzy(input string) (*Query, error) {
+	return compile(input, &compiler{fuzzy: true})
+}
+
+func compile(input string, c *compiler) (*Query, error) {
+	node, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args, err := c.compile(node)
+	if err != nil {
+		return nil, err
+	}
+	query := &Query{Where: where, Args: args}
+	if ts, tsArgs, ok := textQuery(node); ok {
+		query.TSQuery, query.TSArgs, query.HasText = ts, tsArgs, true
+		query.Terms = strings.Join(textTerms(node, nil), " ")
+	}
+	return query, nil
+}
+
+type compiler struct {
+	fuzzy bool
+}
+
+func (c *compiler) compile(node Node) (string, []interface{}, error) {
+	switch n := node.(type) {
+	case *And:
+		return c.binary(n.Left, n.Right, "AND")
+	case *Or:
+		return c.binary(n.Left, n.Right, "OR")
+	case *Not:
+		sql, args, err := c.compile(n.Expr)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + sql + ")", args, nil
+	case *Text:
+		if c.fuzzy {
+			return "word_similarity(?, LOWER(notes.title)) >= ?",
+				[]interface{}{strings.ToLower(n.Value), FuzzyThreshold}, nil
+		}
+		fn := tsQueryFunc(n)
+		value := language.Normalize(n.Value)
+		// Запрос из одних стоп-слов не содержит лексем и не должен ничего отсекать
+		return fmt.Sprintf("(numnode(%s('%s', ?)) = 0 OR notes.search_vector @@ %s('%s', ?))", fn, Config, fn, Config),
+			[]interface{}{value, value}, nil
+	case *Field:
+		return c.field(n)
+	}
+	return "", nil, fmt.Errorf("неизвестный узел запроса %T", node)
+}
+
+func (c *compiler) binary(left, right Node, op string) (string, []interface{}, error) {
+	l, largs, err := c.compile(left)
+	if err != nil {
+		return "", nil, err
+	}
+	r, rargs, err := c.compile(right)
+	if err != nil {
+		return "", nil, err
+	}
+	return "(" + l + " " + op + " " + r + ")", append(largs, rargs...), nil
+}
+
+func (c *compiler) field(f *Field) (string, []interface{}, error) {
+	switch f.Name {
+	case "tag":
+		// Теги заметки принадлежат ее автору
+		return `EXISTS (SELECT 1 FROM note_tags JOIN tags ON tags.id = note_tags.tag_id
+			WHERE note_tags.note_id = notes.id AND LOWER(tags.name) = LOWER(?))`,
+			[]interface{}{f.Value}, nil
+	case "notebook":
+		// Личные заметки без блокнота относятся к блокноту по умолчанию
+		return `(EXISTS (SELECT 1 FROM notebooks WHERE notebooks.id = notes.notebook_id AND LOWER(notebooks.name) = LOWER(?))
+			OR (notes.notebook_id IS NULL AND EXISTS (SELECT 1 FROM notebooks WHERE notebooks.user_id = notes.user_id
+				AND notebooks.workspace_id IS NULL AND notebooks.is_default AND LOWER(notebooks.name) = LOWER(?))))`,
+			[]interface{}{f.Value, f.Value}, nil
+	case "title":
+		return `LOWER(notes.title) LIKE LOWER(?)`, []interface{}{"%" + escapeLike(f.Value) + "%"}, nil
+	case "lang":
+		switch f.Value {
+		case language.Russian, language.English, language.Mixed:
+			return "notes.language = ?", []interface{}{f.Value}, nil
+		}
+		return "", nil, &ParseError{Pos: f.ValuePos, Msg: "lang: ожидается ru, en или mixed"}
+	case "created", "updated":
+		return dateCondition("notes."+f.Name+"_at", f)
+	case "is":
+		if condition, ok := isConditions[strings.ToLower(f.Value)]; ok {
+			return condition, nil, nil
+		}
+		return "", nil, &ParseError{Pos: f.ValuePos, Msg: fmt.Sprintf("неизвестное значение is:%s", f.Value)}
+	}
+	return "", nil, &ParseError{Pos: f.Pos, Msg: fmt.Sprintf("неизвестное поле %s", f.Name)}
+}
+
+// dateCondition строит сравнение с датой: created:2025-01-01, created:>2025-01-01,
+// created:<=2025-01-31T12:00:00Z. Для даты без времени операторы относятся ко всему дню.
+func dateCondition(column string, f *Field) (string, []interface{}, error) {
+	value, op := f.Value, "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, candidate) {
+			op, value = candidate, value[len(candidate):]
+			break
+		}
+	}
+	valuePos := f.ValuePos + len([]rune(f.Value)) - len([]rune(value))
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return column + " " + op + " ?", []interface{}{t}, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return "", nil, &ParseError{Pos: valuePos, Msg: "ожидается дата в формате ГГГГ-ММ-ДД или RFC 3339"}
+	}
+	next := day.AddDate(0, 0, 1)
+
+	switch op {
+	case ">":
+		return column + " >= ?", []interface{}{next}, nil
+	case ">=":
+		return column + " >= ?", []interface{}{day}, nil
+	case "<":
+		return column + " < ?", []interface{}{day}, nil
+	case "<=":
+		return column + " < ?", []interface{}{next}, nil
+	default:
+		return "(" + column + " >= ? AND " + column + " < ?)", []interface{}{day, next}, nil
+	}
+}
+
+// textQuery собирает tsquery из текстовых условий, не находящихся под отрицанием
+func textQuery(node Node) (string, []interface{}, bool) {
+	switch n := node.(type) {
+	case *And:
+		return combineTextQuery(n.Left, n.Right, "&&")
+	case *Or:
+		return combineTextQuery(n.Left, n.Right, "||")
+	case *Text:
+		return fmt.Sprintf("%s('%s', ?)", tsQueryFunc(n), Config), []interface{}{language.Normalize(n.Value)}, true
+	}
+	return "", nil, false
+}
+
+// textTerms собирает значения текстовых условий, не находящихся под отрицанием
+func textTerms(node Node, terms []string) []string {
+	switch n := node.(type) {
+	case *And:
+		return textTerms(n.Right, textTerms(n.Left, terms))
+	case *Or:
+		return textTerms(n.Right, textTerms(n.Left, terms))
+	case *Text:
+		return append(terms, strings.ToLower(n.Value))
+	}
+	return terms
+}
+
+func combineTextQuery(left, right Node, op string) (string, []interface{}, bool) {
+	l, largs, lok := textQuery(left)
+	r, rargs, rok := textQuery(right)
+	switch {
+	case lok && rok:
+		return "(" + l + " " + op + " " + r + ")", append(largs, rargs...), true
+	case lok:
+		return l, largs, true
+	case rok:
+		return r, rargs, true
+	}
+	return "", nil, false
+}
+
+func tsQueryFunc(t *Text) string {
+	if t.Phrase {
+		return "phraseto_tsquery"
+	}
+	return "plainto_tsquery"
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,305 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ParseError описывает ошибку в поисковом запросе. Pos — номер символа (с нуля),
+// на котором обнаружена ошибка.
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("позиция %d: %s", e.Pos, e.Msg)
+}
+
+// Node — узел дерева разобранного запроса
+type Node interface {
+	node()
+}
+
+// And выполняется, если выполнены оба условия
+type And struct {
+	Left, Right Node
+}
+
+// Or выполняется, если выполнено хотя бы одно условие
+type Or struct {
+	Left, Right Node
+}
+
+// Not исключает заметки, для которых выполнено условие
+type Not struct {
+	Expr Node
+}
+
+// Text — слово или фраза в кавычках для полнотекстового поиска
+type Text struct {
+	Value  string
+	Phrase bool
+	Pos    int
+}
+
+// Field — условие на поле заметки вида name:value
+type Field struct {
+	Name     string
+	Value    string
+	Pos      int
+	ValuePos int
+}
+
+func (*And) node()   {}
+func (*Or) node()    {}
+func (*Not) node()   {}
+func (*Text) node()  {}
+func (*Field) node() {}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokField
+	tokMinus
+	tokLParen
+	tokRParen
+	tokOr
+	tokAnd
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	field    string
+	pos      int
+	valuePos int
+}
+
+// Parse разбирает поисковый запрос. Поддерживаются слова, фразы в кавычках, поля
+// вида tag:work или notebook:"Проекты", исключение через -, OR, AND и скобки.
+// Условия, записанные подряд, объединяются через AND.
+func Parse(input string) (Node, error) {
+	tokens, err := tokenize([]rune(input))
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, &ParseError{Pos: 0, Msg: "пустой запрос"}
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &ParseError{Pos: tok.pos, Msg: "лишняя закрывающая скобка"}
+	}
+	return node, nil
+}
+
+func tokenize(input []rune) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		r := input[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, pos: i})
+			i++
+		case r == '-' && i+1 < len(input) && !unicode.IsSpace(input[i+1]) && startsTerm(input, i):
+			tokens = append(tokens, token{kind: tokMinus, pos: i})
+			i++
+		case r == '"':
+			value, next, err := readQuoted(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: value, pos: i})
+			i = next
+		default:
+			tok, next, err := readWord(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = next
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(input)}), nil
+}
+
+// startsTerm сообщает, стоит ли символ в начале нового условия, а не внутри слова
+func startsTerm(input []rune, i int) bool {
+	return i == 0 || unicode.IsSpace(input[i-1]) || input[i-1] == '('
+}
+
+// readQuoted читает строку в кавычках, начиная с открывающей кавычки в позиции start.
+// Внутри строки \" обозначает кавычку, а \\ — обратную косую черту.
+func readQuoted(input []rune, start int) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if i+1 < len(input) && (input[i+1] == '"' || input[i+1] == '\\') {
+				i++
+			}
+			b.WriteRune(input[i])
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteRune(input[i])
+		}
+	}
+	return "", 0, &ParseError{Pos: start, Msg: "незакрытая кавычка"}
+}
+
+// readWord читает слово или условие на поле name:value
+func readWord(input []rune, start int) (token, int, error) {
+	i := start
+	for i < len(input) && !unicode.IsSpace(input[i]) && input[i] != '(' && input[i] != ')' && input[i] != '"' && input[i] != ':' {
+		i++
+	}
+	word := string(input[start:i])
+
+	if i < len(input) && input[i] == ':' && isFieldName(word) {
+		valuePos := i + 1
+		if valuePos < len(input) && input[valuePos] == '"' {
+			value, next, err := readQuoted(input, valuePos)
+			if err != nil {
+				return token{}, 0, err
+			}
+			return token{kind: tokField, field: strings.ToLower(word), text: value, pos: start, valuePos: valuePos}, next, nil
+		}
+		end := valuePos
+		for end < len(input) && !unicode.IsSpace(input[end]) && input[end] != '(' && input[end] != ')' {
+			end++
+		}
+		if end == valuePos {
+			return token{}, 0, &ParseError{Pos: valuePos, Msg: fmt.Sprintf("не указано значение поля %s", word)}
+		}
+		return token{kind: tokField, field: strings.ToLower(word), text: string(input[valuePos:end]), pos: start, valuePos: valuePos}, end, nil
+	}
+
+	// Двоеточие внутри обычного слова (например, во времени 12:30) остается частью слова
+	for i < len(input) && !unicode.IsSpace(input[i]) && input[i] != '(' && input[i] != ')' && input[i] != '"' {
+		i++
+	}
+	word = string(input[start:i])
+
+	switch word {
+	case "OR":
+		return token{kind: tokOr, pos: start}, i, nil
+	case "AND":
+		return token{kind: tokAnd, pos: start}, i, nil
+	}
+	return token{kind: tokWord, text: word, pos: start}, i, nil
+}
+
+func isFieldName(word string) bool {
+	if word == "" {
+		return false
+	}
+	for _, r := range word {
+		if r > unicode.MaxASCII || !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokEOF, tokOr, tokRParen:
+			return left, nil
+		case tokAnd:
+			p.next()
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokMinus:
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	case tokLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, &ParseError{Pos: tok.pos, Msg: "незакрытая скобка"}
+		}
+		return expr, nil
+	case tokWord:
+		return &Text{Value: tok.text, Pos: tok.pos}, nil
+	case tokPhrase:
+		return &Text{Value: tok.text, Phrase: true, Pos: tok.pos}, nil
+	case tokField:
+		return &Field{Name: tok.field, Value: tok.text, Pos: tok.pos, ValuePos: tok.valuePos}, nil
+	case tokOr, tokAnd:
+		return nil, &ParseError{Pos: tok.pos, Msg: "ожидается условие перед оператором"}
+	case tokRParen:
+		return nil, &ParseError{Pos: tok.pos, Msg: "неожиданная закрывающая скобка"}
+	default:
+		return nil, &ParseError{Pos: tok.pos, Msg: "ожидается условие"}
+	}
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/burn"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBurnEncryptDecrypt(t *testing.T) {
+	key, err := burn.NewKey()
+	require.NoError(t, err)
+
+	nonce, ciphertext, err := burn.Encrypt(key, []byte("пароль от сервера"), []byte("abc"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "пароль")
+
+	decoded, err := burn.DecodeKey(burn.EncodeKey(key))
+	require.NoError(t, err)
+	plaintext, err := burn.Decrypt(decoded, nonce, ciphertext, []byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "пароль от сервера", string(plaintext))
+
+	// Чужой ключ и чужая запись не подходят
+	other, err := burn.NewKey()
+	require.NoError(t, err)
+	_, err = burn.Decrypt(other, nonce, ciphertext, []byte("abc"))
+	assert.ErrorIs(t, err, burn.ErrDecrypt)
+	_, err = burn.Decrypt(key, nonce, ciphertext, []byte("xyz"))
+	assert.ErrorIs(t, err, burn.ErrDecrypt)
+
+	_, err = burn.DecodeKey("короткий")
+	assert.ErrorIs(t, err, burn.ErrDecrypt)
+}
+
+func TestCreateBurnNoteTTL(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+
+	// Срок больше 7 дней отклоняется, в том числе значение, переполняющее time.Duration
+	for _, ttl := range []int{int(models.MaxBurnNoteTTL/time.Second) + 1, math.MaxInt64 / 1000} {
+		resp := api.request(alice, http.MethodPost, "/api/burn-notes", gin.H{"content": "секрет", "ttl_seconds": ttl})
+		assert.Equal(t, http.StatusBadRequest, resp.Code, "ttl_seconds %d", ttl)
+	}
+	var count int64
+	require.NoError(t, api.DB.Model(&models.BurnNote{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	var body struct {
+		BurnNote models.BurnNote `json:"burn_note"`
+	}
+	api.decode(api.request(alice, http.MethodPost, "/api/burn-notes", gin.H{"content": "секрет", "ttl_seconds": 3600}), http.StatusCreated, &body)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), body.BurnNote.ExpiresAt, time.Minute)
+}
@@ -0,0 +1,453 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/omega/notes-app/internal/collab"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollabOperationApplyAndJSON(t *testing.T) {
+	var op collab.Operation
+	require.NoError(t, json.Unmarshal([]byte(`[7, "дорогой ", 3, -2, 3]`), &op))
+	assert.Equal(t, 15, op.BaseLength)
+
+	result, err := op.Apply("Hello, мир! 👋!")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, дорогой мир👋!", result)
+
+	data, err := json.Marshal(op)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[7, "дорогой ", 3, -2, 3]`, string(data))
+
+	_, err = op.Apply("короче")
+	assert.ErrorIs(t, err, collab.ErrBaseLength)
+	assert.Error(t, json.Unmarshal([]byte(`[1.5]`), &op))
+}
+
+func TestCollabTransformConverges(t *testing.T) {
+	doc := "Совместная заметка"
+	a := (&collab.Operation{}).Retain(11).Insert("общая ").Retain(7)
+	b := (&collab.Operation{}).Delete(11).Insert("Личная ").Retain(7)
+
+	aPrime, bPrime, err := collab.Transform(a, b)
+	require.NoError(t, err)
+
+	afterA, err := a.Apply(doc)
+	require.NoError(t, err)
+	left, err := bPrime.Apply(afterA)
+	require.NoError(t, err)
+	afterB, err := b.Apply(doc)
+	require.NoError(t, err)
+	right, err := aPrime.Apply(afterB)
+	require.NoError(t, err)
+
+	assert.Equal(t, left, right)
+	assert.Equal(t, "Личная общая заметка", left)
+}
+
+func TestCollabTransformRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	alphabet := []rune("ab вг😀")
+	randomText := func(n int) string {
+		runes := make([]rune, n)
+		for i := range runes {
+			runes[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+		return string(runes)
+	}
+
+	for i := 0; i < 500; i++ {
+		doc := randomText(rng.Intn(12))
+		a := collab.Diff(doc, randomText(rng.Intn(12)))
+		b := collab.Diff(doc, randomText(rng.Intn(12)))
+
+		aPrime, bPrime, err := collab.Transform(a, b)
+		require.NoError(t, err)
+		afterA, err := a.Apply(doc)
+		require.NoError(t, err)
+		left, err := bPrime.Apply(afterA)
+		require.NoError(t, err)
+		afterB, err := b.Apply(doc)
+		require.NoError(t, err)
+		right, err := aPrime.Apply(afterB)
+		require.NoError(t, err)
+		assert.Equal(t, left, right, doc)
+	}
+}
+
+func TestCollabDiff(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"", ""}, {"", "новый текст"}, {"старый текст", ""}, {"abc", "abXc"},
+		{"😀😁", "😀😂"}, {"x😀", "x😁"}, {"одинаково", "одинаково"},
+	} {
+		op := collab.Diff(pair[0], pair[1])
+		result, err := op.Apply(pair[0])
+		require.NoError(t, err, pair)
+		assert.Equal(t, pair[1], result, pair)
+	}
+	assert.True(t, collab.Diff("текст", "текст").IsNoop())
+}
+
+// memoryNoteStore хранит содержимое заметок в памяти для проверки сессий
+type memoryNoteStore struct {
+	mu      sync.Mutex
+	content map[uint]string
+}
+
+func (s *memoryNoteStore) Load(noteID uint) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.content[noteID], nil
+}
+
+func (s *memoryNoteStore) Save(noteID uint, base, content string, authorID uint) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current := s.content[noteID]; current != base {
+		return current, collab.ErrStaleContent
+	}
+	s.content[noteID] = content
+	return content, nil
+}
+
+// failingNoteStore не сохраняет заметку первые failures раз
+type failingNoteStore struct {
+	memoryNoteStore
+	failures int
+}
+
+func (s *failingNoteStore) Save(noteID uint, base, content string, authorID uint) (string, error) {
+	s.mu.Lock()
+	if s.failures > 0 {
+		s.failures--
+		s.mu.Unlock()
+		return "", errors.New("база данных недоступна")
+	}
+	s.mu.Unlock()
+	return s.memoryNoteStore.Save(noteID, base, content, authorID)
+}
+
+func (s *memoryNoteStore) get(noteID uint) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.content[noteID]
+}
+
+// set меняет содержимое заметки в обход сессии
+func (s *memoryNoteStore) set(noteID uint, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content[noteID] = content
+}
+
+func TestCollabHubMergesConcurrentEdits(t *testing.T) {
+	store := &memoryNoteStore{content: map[uint]string{1: "заметка"}}
+	hub := collab.NewHub(store)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		hub.Serve(conn, 1, 7, "alice", r.URL.Query().Get("readonly") == "")
+	}))
+	defer server.Close()
+
+	dial := func(query, content string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/"+query, nil)
+		require.NoError(t, err)
+		var init map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&init))
+		require.Equal(t, "init", init["type"])
+		require.Equal(t, content, init["content"])
+		return conn
+	}
+	first, second := dial("", "заметка"), dial("", "заметка")
+	var msg map[string]interface{}
+	require.NoError(t, first.ReadJSON(&msg))
+	assert.Equal(t, "join", msg["type"])
+
+	// Оба клиента правят ревизию 0, не зная друг о друге
+	require.NoError(t, first.WriteJSON(map[string]interface{}{
+		"type": "op", "revision": 0, "op": json.RawMessage(`["Общая ", 7]`),
+	}))
+	require.NoError(t, first.ReadJSON(&msg))
+	assert.Equal(t, "ack", msg["type"])
+
+	require.NoError(t, second.WriteJSON(map[string]interface{}{
+		"type": "op", "revision": 0, "op": json.RawMessage(`[7, " команды"]`),
+	}))
+	require.NoError(t, second.ReadJSON(&msg))
+	assert.Equal(t, "op", msg["type"])
+	require.NoError(t, second.ReadJSON(&msg))
+	assert.Equal(t, "ack", msg["type"])
+	assert.EqualValues(t, 2, msg["revision"])
+
+	// Первый клиент получает операцию второго, преобразованную относительно своей
+	require.NoError(t, first.ReadJSON(&msg))
+	assert.Equal(t, "op", msg["type"])
+	assert.Equal(t, []interface{}{float64(13), " команды"}, msg["op"])
+
+	// Читатель не может отправлять правки
+	reader := dial("?readonly=1", "Общая заметка команды")
+	require.NoError(t, reader.WriteJSON(map[string]interface{}{
+		"type": "op", "revision": 2, "op": json.RawMessage(`[-21]`),
+	}))
+	require.NoError(t, reader.ReadJSON(&msg))
+	assert.Equal(t, "error", msg["type"])
+
+	// После отключения всех клиентов документ сохраняется
+	first.Close()
+	second.Close()
+	reader.Close()
+	assert.Eventually(t, func() bool {
+		return store.get(1) == "Общая заметка команды"
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestCollabDiffWords(t *testing.T) {
+	before := "Первый абзац 😀 и второй абзац"
+	after := "Новый первый абзац 😀 и второй абзац текста"
+	op := collab.DiffWords(before, after)
+	result, err := op.Apply(before)
+	require.NoError(t, err)
+	assert.Equal(t, after, result)
+
+	// Текст между правками сохраняется, а не заменяется целиком
+	data, err := json.Marshal(op)
+	require.NoError(t, err)
+	assert.Equal(t, `["Новый первый",-6,24," текста"]`, string(data))
+}
+
+func TestCollabTransformIndex(t *testing.T) {
+	// "заметка" -> "Общая заметка" -> удаление "мет"
+	insert := (&collab.Operation{}).Insert("Общая ").Retain(7)
+	assert.Equal(t, 6, collab.TransformIndex(insert, 0))
+	assert.Equal(t, 10, collab.TransformIndex(insert, 4))
+	assert.Equal(t, 13, collab.TransformIndex(insert, 7))
+
+	remove := (&collab.Operation{}).Retain(2).Delete(3).Retain(2)
+	assert.Equal(t, 1, collab.TransformIndex(remove, 1))
+	assert.Equal(t, 2, collab.TransformIndex(remove, 3))
+	assert.Equal(t, 2, collab.TransformIndex(remove, 5))
+	assert.Equal(t, 4, collab.TransformIndex(remove, 7))
+}
+
+func TestCollabPresenceAndCursors(t *testing.T) {
+	store := &memoryNoteStore{content: map[uint]string{2: "заметка"}}
+	hub := collab.NewHub(store)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		name := r.URL.Query().Get("name")
+		hub.Serve(conn, 2, uint(len(name)), name, name != "reader")
+	}))
+	defer server.Close()
+
+	dial := func(name string) (*websocket.Conn, map[string]interface{}) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/?name="+name, nil)
+		require.NoError(t, err)
+		var init map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&init))
+		require.Equal(t, "init", init["type"])
+		return conn, init
+	}
+
+	assert.Empty(t, hub.Presence(2))
+	editor, _ := dial("editor")
+	reader, init := dial("reader")
+	assert.Len(t, init["presence"], 2)
+
+	// Редактор узнает о новом участнике
+	var msg map[string]interface{}
+	require.NoError(t, editor.ReadJSON(&msg))
+	assert.Equal(t, "join", msg["type"])
+	assert.Equal(t, "reader", msg["presence"].(map[string]interface{})["username"])
+
+	// Читатель может передавать курсор, и он доходит до редактора
+	require.NoError(t, reader.WriteJSON(map[string]interface{}{
+		"type": "cursor", "revision": 0, "cursor": map[string]int{"anchor": 3, "head": 3},
+	}))
+	require.NoError(t, editor.ReadJSON(&msg))
+	assert.Equal(t, "cursor", msg["type"])
+	assert.Equal(t, init["client_id"], msg["client_id"])
+	assert.Equal(t, map[string]interface{}{"anchor": float64(3), "head": float64(3)}, msg["cursor"])
+
+	// Правка перед курсором сдвигает его в снимке присутствия
+	require.NoError(t, editor.WriteJSON(map[string]interface{}{
+		"type": "op", "revision": 0, "op": json.RawMessage(`["Общая ", 7]`),
+	}))
+	require.NoError(t, editor.ReadJSON(&msg))
+	assert.Equal(t, "ack", msg["type"])
+	require.NoError(t, reader.ReadJSON(&msg))
+	assert.Equal(t, "op", msg["type"])
+
+	presence := hub.Presence(2)
+	require.Len(t, presence, 2)
+	assert.Equal(t, "editor", presence[0].Username)
+	assert.True(t, presence[0].CanEdit)
+	assert.Equal(t, "reader", presence[1].Username)
+	assert.False(t, presence[1].CanEdit)
+	require.NotNil(t, presence[1].Cursor)
+	assert.Equal(t, collab.Cursor{Anchor: 9, Head: 9}, *presence[1].Cursor)
+
+	// Уход участника рассылается остальным
+	require.NoError(t, reader.WriteJSON(map[string]interface{}{"type": "heartbeat"}))
+	reader.Close()
+	require.NoError(t, editor.ReadJSON(&msg))
+	assert.Equal(t, "leave", msg["type"])
+	assert.Equal(t, init["client_id"], msg["client_id"])
+	assert.Eventually(t, func() bool { return len(hub.Presence(2)) == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	editor.Close()
+	assert.Eventually(t, func() bool { return len(hub.Presence(2)) == 0 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestCollabHubKeepsSessionUntilSaved(t *testing.T) {
+	store := &failingNoteStore{memoryNoteStore: memoryNoteStore{content: map[uint]string{3: "черновик"}}, failures: 1}
+	hub := collab.NewHub(store)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		hub.Serve(conn, 3, 7, "alice", true)
+	}))
+	defer server.Close()
+
+	dial := func() (*websocket.Conn, map[string]interface{}) {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		require.NoError(t, err)
+		var init map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&init))
+		require.Equal(t, "init", init["type"])
+		return conn, init
+	}
+
+	conn, _ := dial()
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "op", "revision": 0, "op": json.RawMessage(`[8, " письма"]`),
+	}))
+	var msg map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.Equal(t, "ack", msg["type"])
+	conn.Close()
+
+	// Первое сохранение не удалось, но сессия осталась: новый клиент получает правку,
+	// а не устаревшее содержимое из хранилища
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, "черновик", store.get(3))
+	conn, init := dial()
+	assert.Equal(t, "черновик письма", init["content"])
+	assert.EqualValues(t, 1, init["revision"])
+	conn.Close()
+
+	// Повторное сохранение проходит, и сессия закрывается
+	assert.Eventually(t, func() bool {
+		return store.get(3) == "черновик письма"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(hub.Presence(3)) == 0 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestCollabHubMergesStaleSave(t *testing.T) {
+	store := &memoryNoteStore{content: map[uint]string{5: "черновик"}}
+	hub := collab.NewHub(store)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		hub.Serve(conn, 5, 7, "alice", true)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	var msg map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.Equal(t, "init", msg["type"])
+
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "op", "revision": 0, "op": json.RawMessage(`[8, " письма"]`),
+	}))
+	require.NoError(t, conn.ReadJSON(&msg))
+	require.Equal(t, "ack", msg["type"])
+
+	// Заметку изменили в обход сессии до ее сохранения: сессия не затирает изменение,
+	// а сливает его со своими правками и присылает клиенту
+	store.set(5, "Новый черновик")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	require.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, "op", msg["type"])
+	assert.Equal(t, []interface{}{"Новый ", float64(15)}, msg["op"])
+
+	assert.Eventually(t, func() bool {
+		return store.get(5) == "Новый черновик письма"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCollabHubRestrictsClients(t *testing.T) {
+	store := &memoryNoteStore{content: map[uint]string{4: "заметка"}}
+	hub := collab.NewHub(store)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		name := r.URL.Query().Get("name")
+		hub.Serve(conn, 4, uint(len(name)), name, true)
+	}))
+	defer server.Close()
+
+	dial := func(name string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/?name="+name, nil)
+		require.NoError(t, err)
+		var init map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&init))
+		require.Equal(t, "init", init["type"])
+		return conn
+	}
+	owner := dial("owner")
+	defer owner.Close()
+	guest := dial("bob")
+	defer guest.Close()
+	var msg map[string]interface{}
+	require.NoError(t, owner.ReadJSON(&msg))
+	require.Equal(t, "join", msg["type"])
+	assert.Equal(t, []uint{4}, hub.UserNotes(3))
+
+	// Без права записи клиент остается читателем и не может отправлять правки
+	hub.Restrict(4, 3, true, false)
+	require.NoError(t, guest.ReadJSON(&msg))
+	assert.Equal(t, "access", msg["type"])
+	assert.Equal(t, false, msg["can_edit"])
+	require.NoError(t, guest.WriteJSON(map[string]interface{}{
+		"type": "op", "revision": 0, "op": json.RawMessage(`[-7]`),
+	}))
+	require.NoError(t, guest.ReadJSON(&msg))
+	assert.Equal(t, "error", msg["type"])
+
+	// Права других пользователей не меняются
+	for _, p := range hub.Presence(4) {
+		assert.Equal(t, p.UserID != 3, p.CanEdit, p.Username)
+	}
+
+	// Без права чтения соединение закрывается, и участники узнают об уходе
+	hub.Restrict(4, 3, false, false)
+	guest.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := guest.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNoStatusReceived), err)
+	require.NoError(t, owner.ReadJSON(&msg))
+	assert.Equal(t, "leave", msg["type"])
+	assert.EqualValues(t, 3, msg["user_id"])
+	assert.Empty(t, hub.UserNotes(3))
+	assert.Equal(t, "заметка", store.get(4))
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/omega/notes-app/internal/diff"
+	"github.com/stretchr/testify/assert"
+)
+
+// applyEdits восстанавливает исходный и новый тексты из сценария правки
+func applyEdits(edits []diff.Edit) (string, string) {
+	var from, to strings.Builder
+	for _, e := range edits {
+		if e.Op != diff.OpInsert {
+			from.WriteString(e.Text)
+		}
+		if e.Op != diff.OpDelete {
+			to.WriteString(e.Text)
+		}
+	}
+	return from.String(), to.String()
+}
+
+func TestDiffLines(t *testing.T) {
+	a := "первая\nвторая\nтретья\n"
+	b := "первая\nновая\nтретья\nчетвертая\n"
+
+	edits := diff.Lines(a, b)
+	assert.Equal(t, []diff.Edit{
+		{Op: diff.OpEqual, Text: "первая\n"},
+		{Op: diff.OpDelete, Text: "вторая\n"},
+		{Op: diff.OpInsert, Text: "новая\n"},
+		{Op: diff.OpEqual, Text: "третья\n"},
+		{Op: diff.OpInsert, Text: "четвертая\n"},
+	}, edits)
+}
+
+func TestDiffWords(t *testing.T) {
+	edits := diff.Words("быстрая рыжая лиса", "быстрая бурая лиса прыгает")
+	assert.Equal(t, []diff.Edit{
+		{Op: diff.OpEqual, Text: "быстрая "},
+		{Op: diff.OpDelete, Text: "рыжая"},
+		{Op: diff.OpInsert, Text: "бурая"},
+		{Op: diff.OpEqual, Text: " лиса"},
+		{Op: diff.OpInsert, Text: " прыгает"},
+	}, edits)
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"", "новый текст"},
+		{"старый текст", ""},
+		{"a b c d e f", "a c e g f b"},
+		{"x\ny\nz", "z\ny\nx\n"},
+		{"одинаковый текст", "одинаковый текст"},
+	}
+	for _, c := range cases {
+		from, to := applyEdits(diff.Words(c[0], c[1]))
+		assert.Equal(t, c[0], from)
+		assert.Equal(t, c[1], to)
+
+		from, to = applyEdits(diff.Lines(c[0], c[1]))
+		assert.Equal(t, c[0], from)
+		assert.Equal(t, c[1], to)
+	}
+}
+
+// lcsLength считает длину наибольшей общей подпоследовательности строк динамикой
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomText := func() string {
+		var lines []string
+		for i := rng.Intn(30); i > 0; i-- {
+			lines = append(lines, string(rune('a'+rng.Intn(4)))+"\n")
+		}
+		return strings.Join(lines, "")
+	}
+
+	for i := 0; i < 300; i++ {
+		a, b := randomText(), randomText()
+		edits := diff.Lines(a, b)
+		from, to := applyEdits(edits)
+		assert.Equal(t, a, from)
+		assert.Equal(t, b, to)
+
+		// Совпавшие строки сценария должны составлять наибольшую общую подпоследовательность
+		equal := 0
+		for _, e := range edits {
+			if e.Op == diff.OpEqual {
+				equal += strings.Count(e.Text, "\n")
+			}
+		}
+		assert.Equal(t, lcsLength(strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n")), equal+1, "%q -> %q", a, b)
+	}
+}
+
+func TestDiffLargeInputs(t *testing.T) {
+	var before, after, similar strings.Builder
+	for i := 0; i < 200000; i++ {
+		before.WriteString("строка " + string(rune('а'+i%32)) + strings.Repeat("x", i%7) + "\n")
+		after.WriteString("другая " + string(rune('a'+i%26)) + strings.Repeat("y", i%5) + "\n")
+		if i%50000 == 0 {
+			similar.WriteString("измененная строка\n")
+		} else {
+			similar.WriteString("строка " + string(rune('а'+i%32)) + strings.Repeat("x", i%7) + "\n")
+		}
+	}
+
+	// Полностью различные тексты сравниваются быстро и превращаются в одну замену
+	started := time.Now()
+	edits := diff.Lines(before.String(), after.String())
+	assert.Less(t, time.Since(started), 5*time.Second)
+	from, to := applyEdits(edits)
+	assert.Equal(t, before.String(), from)
+	assert.Equal(t, after.String(), to)
+
+	// Редкие изменения в большом тексте находятся точно
+	edits = diff.Lines(before.String(), similar.String())
+	from, to = applyEdits(edits)
+	assert.Equal(t, before.String(), from)
+	assert.Equal(t, similar.String(), to)
+	changed := 0
+	for _, e := range edits {
+		if e.Op != diff.OpEqual {
+			changed++
+		}
+	}
+	assert.Equal(t, 8, changed)
+}
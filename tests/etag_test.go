@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// versionedNote создает заметку Алисы с версией 3
+func versionedNote(t *testing.T) (*testAPI, *models.User, models.Note) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	note := models.Note{Title: "Заметка", Content: "текст", UserID: alice.ID, Version: 3}
+	api.create(&note)
+	return api, alice, note
+}
+
+func TestGetNoteETag(t *testing.T) {
+	api, alice, note := versionedNote(t)
+	path := fmt.Sprintf("/api/notes/%d", note.ID)
+
+	resp := api.request(alice, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `"3"`, resp.Header().Get("ETag"))
+
+	// Клиент с актуальной версией получает 304 без тела
+	resp = api.request(alice, http.MethodGet, path, nil, "If-None-Match", `"1", "3"`)
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Empty(t, resp.Body.String())
+
+	resp = api.request(alice, http.MethodGet, path, nil, "If-None-Match", `"2"`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestUpdateNoteStaleIfMatch(t *testing.T) {
+	api, alice, note := versionedNote(t)
+
+	resp := api.request(alice, http.MethodPut, fmt.Sprintf("/api/notes/%d", note.ID), gin.H{"title": "Новый заголовок"}, "If-Match", `"2"`)
+	require.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	assert.Equal(t, `"3"`, resp.Header().Get("ETag"))
+
+	// Вместе с ошибкой клиент получает текущую заметку, а сама заметка не меняется
+	var body struct {
+		Note models.Note `json:"note"`
+	}
+	api.decode(resp, http.StatusPreconditionFailed, &body)
+	assert.Equal(t, 3, body.Note.Version)
+	assert.Equal(t, "Заметка", api.note(note.ID).Title)
+}
+
+func TestUpdateNoteIfMatchChangesETag(t *testing.T) {
+	for _, ifMatch := range []string{`"3"`, `"1", "3"`, "*", ""} {
+		api, alice, note := versionedNote(t)
+
+		resp := api.request(alice, http.MethodPut, fmt.Sprintf("/api/notes/%d", note.ID), gin.H{"title": "Новый заголовок"}, "If-Match", ifMatch)
+		require.Equal(t, http.StatusOK, resp.Code, "If-Match %q", ifMatch)
+		assert.Equal(t, `"4"`, resp.Header().Get("ETag"), "If-Match %q", ifMatch)
+
+		stored := api.note(note.ID)
+		assert.Equal(t, 4, stored.Version)
+		assert.Equal(t, "Новый заголовок", stored.Title)
+	}
+}
+
+// changeNoteConcurrently увеличивает версию заметки перед ближайшим обновлением в базе,
+// как если бы заметку успел сохранить другой запрос
+func changeNoteConcurrently(t *testing.T, api *testAPI, noteID uint) {
+	t.Helper()
+	done := false
+	err := api.DB.Callback().Update().Before("gorm:update").Register("test:concurrent_update", func(tx *gorm.DB) {
+		if done {
+			return
+		}
+		done = true
+		// Запрос идет через отдельное соединение, вне транзакции обработчика
+		api.DB.Exec("UPDATE notes SET version = version + 1 WHERE id = ?", noteID)
+	})
+	require.NoError(t, err)
+}
+
+func TestUpdateNoteVersionRace(t *testing.T) {
+	// Версию изменили между чтением и записью: условный запрос получает 412
+	api, alice, note := versionedNote(t)
+	changeNoteConcurrently(t, api, note.ID)
+
+	resp := api.request(alice, http.MethodPut, fmt.Sprintf("/api/notes/%d", note.ID), gin.H{"title": "Новый заголовок"}, "If-Match", `"3"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	assert.Equal(t, `"4"`, resp.Header().Get("ETag"))
+	assert.Equal(t, "Заметка", api.note(note.ID).Title)
+
+	// Безусловный запрос получает 409 и текущую версию
+	api, alice, note = versionedNote(t)
+	changeNoteConcurrently(t, api, note.ID)
+
+	resp = api.request(alice, http.MethodPut, fmt.Sprintf("/api/notes/%d", note.ID), gin.H{"title": "Новый заголовок"})
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Equal(t, `"4"`, resp.Header().Get("ETag"))
+	assert.Equal(t, "Заметка", api.note(note.ID).Title)
+}
+
+func TestDeleteNoteStaleIfMatch(t *testing.T) {
+	api, alice, note := versionedNote(t)
+	path := fmt.Sprintf("/api/notes/%d", note.ID)
+
+	resp := api.request(alice, http.MethodDelete, path, nil, "If-Match", `"2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	assert.False(t, api.note(note.ID).DeletedAt.Valid)
+
+	resp = api.request(alice, http.MethodDelete, path, nil, "If-Match", `"3"`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.True(t, api.note(note.ID).DeletedAt.Valid)
+}
+
+// noteETagAfter возвращает ETag заметки до и после действия change
+func noteETagAfter(api *testAPI, user *models.User, noteID uint, change func()) (string, string) {
+	api.t.Helper()
+	path := fmt.Sprintf("/api/notes/%d", noteID)
+	before := api.request(user, http.MethodGet, path, nil).Header().Get("ETag")
+	change()
+	after := api.request(user, http.MethodGet, path, nil).Header().Get("ETag")
+	return before, after
+}
+
+func TestNoteETagChangesWithEveryField(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	note := api.createNote(alice, gin.H{"title": "Заметка"})
+	parent := api.createNote(alice, gin.H{"title": "Раздел"})
+	sibling := api.createNote(alice, gin.H{"title": "Соседняя"})
+	var created struct {
+		Notebook models.Notebook `json:"notebook"`
+	}
+	api.decode(api.request(alice, http.MethodPost, "/api/notebooks", gin.H{"name": "Проекты"}), http.StatusCreated, &created)
+
+	changes := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"состояние", http.MethodPost, "/api/notes/state", gin.H{"note_ids": []uint{note.ID}, "pinned": true}},
+		{"порядок", http.MethodPost, fmt.Sprintf("/api/notes/%d/move", note.ID), gin.H{"before_id": sibling.ID}},
+		{"блокнот", http.MethodPost, fmt.Sprintf("/api/notebooks/%d/notes", created.Notebook.ID), gin.H{"note_ids": []uint{note.ID}}},
+		{"родитель", http.MethodPost, fmt.Sprintf("/api/notes/%d/move", note.ID), gin.H{"parent_id": parent.ID}},
+	}
+	for _, change := range changes {
+		before, after := noteETagAfter(api, alice, note.ID, func() {
+			resp := api.request(alice, change.method, change.path, change.body)
+			require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		})
+		assert.NotEqual(t, before, after, change.name)
+	}
+}
+
+func TestRestoredNoteETagChanges(t *testing.T) {
+	api, alice, note := versionedNote(t)
+	path := fmt.Sprintf("/api/notes/%d", note.ID)
+	require.Equal(t, http.StatusOK, api.request(alice, http.MethodDelete, path, nil).Code)
+
+	resp := api.request(alice, http.MethodPost, path+"/restore", nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	// Клиент, сохранивший ETag до удаления, получает новую версию
+	resp = api.request(alice, http.MethodGet, path, nil, "If-None-Match", `"3"`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.NotEqual(t, `"3"`, resp.Header().Get("ETag"))
+}
@@ -0,0 +1,25 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omega/notes-app/internal/jobs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashRetention(t *testing.T) {
+	t.Setenv("TRASH_RETENTION_DAYS", "")
+	assert.Equal(t, jobs.DefaultTrashRetentionDays*24*time.Hour, jobs.TrashRetention())
+
+	t.Setenv("TRASH_RETENTION_DAYS", "7")
+	assert.Equal(t, 7*24*time.Hour, jobs.TrashRetention())
+
+	// Ноль отключает автоматическую очистку
+	t.Setenv("TRASH_RETENTION_DAYS", "0")
+	assert.Equal(t, time.Duration(0), jobs.TrashRetention())
+
+	// Некорректное значение заменяется значением по умолчанию
+	t.Setenv("TRASH_RETENTION_DAYS", "-3")
+	assert.Equal(t, jobs.DefaultTrashRetentionDays*24*time.Hour, jobs.TrashRetention())
+}
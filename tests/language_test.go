@@ -0,0 +1,22 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/omega/notes-app/internal/language"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	assert.Equal(t, language.Russian, language.Detect("Список покупок на неделю"))
+	assert.Equal(t, language.English, language.Detect("Weekly shopping list"))
+	// Отдельные иноязычные термины не меняют язык заметки
+	assert.Equal(t, language.Russian, language.Detect("Настроить деплой через Docker и проверить логи сервиса"))
+	assert.Equal(t, language.Mixed, language.Detect("Meeting notes: обсудили roadmap и сроки релиза"))
+	assert.Equal(t, language.Unknown, language.Detect("12:30 — 14:00 !!!"))
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	assert.Equal(t, "елка и Еж", language.Normalize("ёлка и Ёж"))
+	assert.Equal(t, "plain text", language.Normalize("plain text"))
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopeMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// scopes == nil означает JWT первой стороны
+	serve := func(method string, scopes []string) (int, bool) {
+		var canWrite bool
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if scopes != nil {
+				c.Set("oauth_scopes", scopes)
+			}
+		})
+		router.Use(middleware.ScopeMiddleware(auth.ScopeNotesRead, auth.ScopeNotesWrite))
+		router.Handle(method, "/notes", func(c *gin.Context) {
+			canWrite = middleware.TokenHasScope(c, auth.ScopeNotesWrite)
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/notes", nil))
+		return w.Code, canWrite
+	}
+
+	// Токен только для чтения открывает GET, в том числе WebSocket, но не дает права записи
+	code, canWrite := serve(http.MethodGet, []string{auth.ScopeNotesRead})
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, canWrite)
+
+	code, _ = serve(http.MethodPost, []string{auth.ScopeNotesRead})
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, canWrite = serve(http.MethodGet, []string{auth.ScopeNotesRead, auth.ScopeNotesWrite})
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, canWrite)
+
+	code, canWrite = serve(http.MethodGet, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, canWrite)
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("oauth_scopes", []string{auth.ScopeNotesRead, auth.ScopeNotesWrite})
+	})
+	router.Use(middleware.RequireScope(auth.ScopeProfile))
+	router.GET("/profile", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// Одна область доступа требуется и для чтения
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/profile", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `scope="profile"`)
+}
+
+func TestSocketTokenFromQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logged bytes.Buffer
+	router := gin.New()
+	router.Use(middleware.SocketTokenFromQuery(), gin.LoggerWithWriter(&logged))
+	router.GET("/ws", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetHeader("Authorization"))
+	})
+
+	// Токен переносится в заголовок и не попадает в журнал
+	req := httptest.NewRequest(http.MethodGet, "/ws?access_token=secret-token&mode=edit", nil)
+	req.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "Bearer secret-token", w.Body.String())
+	assert.NotContains(t, logged.String(), "secret-token")
+	assert.Contains(t, logged.String(), "mode=edit")
+
+	// Обычные запросы не принимают токен в адресе
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ws?access_token=secret-token", nil))
+	assert.Empty(t, w.Body.String())
+}
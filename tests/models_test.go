@@ -2,9 +2,12 @@ package tests
 
 import (
 	"testing"
+	"time"
 
+	"github.com/omega/notes-app/internal/collab"
 	"github.com/omega/notes-app/internal/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -34,4 +37,179 @@ func TestUserPasswordHashing(t *testing.T) {
 	// Проверяем метод ValidatePassword с неверным паролем
 	err = user.ValidatePassword("wrongpassword")
 	assert.Error(t, err)
-} 
\ No newline at end of file
+}
+
+func TestUserPasswordLooksLikeHash(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	// Новый пароль, похожий на хеш, все равно хешируется
+	user := models.User{Password: string(hash)}
+	require.NoError(t, user.BeforeSave(nil))
+	assert.NotEqual(t, string(hash), user.Password)
+	assert.Error(t, user.ValidatePassword("secret"))
+	assert.NoError(t, user.ValidatePassword(string(hash)))
+
+	// Загруженный из базы хеш при повторном сохранении не меняется
+	loaded := models.User{Password: string(hash)}
+	require.NoError(t, loaded.AfterFind(nil))
+	require.NoError(t, loaded.BeforeSave(nil))
+	assert.Equal(t, string(hash), loaded.Password)
+
+	// Новый пароль загруженного пользователя хешируется
+	loaded.SetPassword("changed")
+	require.NoError(t, loaded.BeforeSave(nil))
+	assert.NoError(t, loaded.ValidatePassword("changed"))
+}
+
+func TestBuildNoteTree(t *testing.T) {
+	parent := func(id uint) *uint { return &id }
+
+	// Заметка 5 ссылается на родителя вне набора и поэтому становится корнем
+	notes := []models.Note{
+		{ID: 1, Title: "Корень"},
+		{ID: 2, Title: "Глава 1", ParentID: parent(1)},
+		{ID: 3, Title: "Глава 2", ParentID: parent(1)},
+		{ID: 4, Title: "Раздел 1.1", ParentID: parent(2)},
+		{ID: 5, Title: "Сирота", ParentID: parent(42)},
+	}
+
+	roots := models.BuildNoteTree(notes)
+	assert.Len(t, roots, 2)
+	assert.Equal(t, uint(1), roots[0].ID)
+	assert.Equal(t, uint(5), roots[1].ID)
+
+	assert.Len(t, roots[0].Children, 2)
+	assert.Equal(t, uint(2), roots[0].Children[0].ID)
+	assert.Equal(t, uint(3), roots[0].Children[1].ID)
+	assert.Len(t, roots[0].Children[0].Children, 1)
+	assert.Equal(t, uint(4), roots[0].Children[0].Children[0].ID)
+	assert.Empty(t, roots[0].Children[1].Children)
+}
+
+func TestNoteAccessRoles(t *testing.T) {
+	assert.True(t, models.ValidShareRole(models.ShareRoleEditor))
+	assert.False(t, models.ValidShareRole("owner"))
+
+	assert.Equal(t, "viewer", models.NoteAccessView.Role())
+	assert.Equal(t, "commenter", models.NoteAccessComment.Role())
+	assert.Equal(t, "editor", models.NoteAccessEdit.Role())
+	assert.Equal(t, "owner", models.NoteAccessOwner.Role())
+	assert.Less(t, models.NoteAccessView, models.NoteAccessEdit)
+}
+
+func TestPublicLinkPasswordAndExpiry(t *testing.T) {
+	now := time.Now()
+	link := models.PublicLink{}
+	assert.True(t, link.Active(now))
+	assert.True(t, link.CheckPassword(""))
+
+	require.NoError(t, link.SetPassword("секрет"))
+	assert.True(t, link.HasPassword)
+	assert.True(t, link.CheckPassword("секрет"))
+	assert.False(t, link.CheckPassword("неверный"))
+
+	expired := now.Add(-time.Minute)
+	link.ExpiresAt = &expired
+	assert.False(t, link.Active(now))
+
+	link.ExpiresAt = nil
+	link.RevokedAt = &now
+	assert.False(t, link.Active(now))
+}
+
+func TestWorkspaceRolesAndInvitations(t *testing.T) {
+	assert.True(t, models.ValidWorkspaceRole(models.WorkspaceRoleGuest))
+	assert.False(t, models.ValidWorkspaceRole("editor"))
+
+	assert.True(t, models.WorkspaceRoleAtLeast(models.WorkspaceRoleOwner, models.WorkspaceRoleAdmin))
+	assert.True(t, models.WorkspaceRoleAtLeast(models.WorkspaceRoleMember, models.WorkspaceRoleMember))
+	assert.False(t, models.WorkspaceRoleAtLeast(models.WorkspaceRoleGuest, models.WorkspaceRoleMember))
+	assert.False(t, models.WorkspaceRoleAtLeast("", models.WorkspaceRoleGuest))
+
+	now := time.Now()
+	invitation := models.WorkspaceInvitation{ExpiresAt: now.Add(models.WorkspaceInvitationTTL)}
+	assert.True(t, invitation.Pending(now))
+	assert.False(t, invitation.Pending(now.Add(models.WorkspaceInvitationTTL+time.Second)))
+
+	invitation.AcceptedAt = &now
+	assert.False(t, invitation.Pending(now))
+
+	// Участник редактирует чужие заметки, но управляет доступом и удаляет только свои
+	assert.Equal(t, models.NoteAccessOwner, models.WorkspaceNoteAccess(models.WorkspaceRoleOwner, false))
+	assert.Equal(t, models.NoteAccessOwner, models.WorkspaceNoteAccess(models.WorkspaceRoleAdmin, false))
+	assert.Equal(t, models.NoteAccessOwner, models.WorkspaceNoteAccess(models.WorkspaceRoleMember, true))
+	assert.Equal(t, models.NoteAccessEdit, models.WorkspaceNoteAccess(models.WorkspaceRoleMember, false))
+	assert.Equal(t, models.NoteAccessView, models.WorkspaceNoteAccess(models.WorkspaceRoleGuest, true))
+	assert.Equal(t, models.NoteAccessNone, models.WorkspaceNoteAccess("", true))
+}
+
+func TestNoteSuggestionApplyAndRebase(t *testing.T) {
+	content := "Встреча во вторник 😀 в офисе"
+
+	_, err := models.NewNoteSuggestion(content, 5, 3, "")
+	assert.ErrorIs(t, err, models.ErrSuggestionRange)
+	_, err = models.NewNoteSuggestion(content, 0, 100, "")
+	assert.ErrorIs(t, err, models.ErrSuggestionRange)
+	// Позиция 20 приходится на середину эмодзи
+	_, err = models.NewNoteSuggestion(content, 20, 20, "!")
+	assert.ErrorIs(t, err, models.ErrSuggestionRange)
+
+	// Заменяем "вторник" на "среду"
+	suggestion, err := models.NewNoteSuggestion(content, 11, 18, "среду")
+	require.NoError(t, err)
+	assert.Equal(t, "вторник", suggestion.Original)
+	assert.Equal(t, models.SuggestionStatusOpen, suggestion.Status)
+
+	applied, err := suggestion.Apply(content)
+	require.NoError(t, err)
+	assert.Equal(t, "Встреча во среду 😀 в офисе", applied)
+
+	// Правка после фрагмента не сдвигает предложение
+	edited := "Встреча во вторник 😀 в офисе на втором этаже"
+	assert.False(t, suggestion.Rebase(collab.Diff(content, edited), edited))
+	assert.Equal(t, 11, suggestion.Start)
+
+	// Вставка перед фрагментом сдвигает его
+	content, edited = edited, "Важно! "+edited
+	assert.True(t, suggestion.Rebase(collab.Diff(content, edited), edited))
+	assert.Equal(t, 18, suggestion.Start)
+	assert.Equal(t, 25, suggestion.End)
+	applied, err = suggestion.Apply(edited)
+	require.NoError(t, err)
+	assert.Equal(t, "Важно! Встреча во среду 😀 в офисе на втором этаже", applied)
+
+	// Изменение самого фрагмента делает предложение устаревшим
+	content, edited = edited, "Важно! Встреча во вторник утром 😀 в офисе на втором этаже"
+	other, err := models.NewNoteSuggestion(content, 7, 14, "Созвон")
+	require.NoError(t, err)
+	suggestion.Original = "вторник 😀"
+	suggestion.End = suggestion.Start + 10
+	assert.True(t, suggestion.Rebase(collab.Diff(content, edited), edited))
+	assert.Equal(t, models.SuggestionStatusOutdated, suggestion.Status)
+	_, err = suggestion.Apply(edited)
+	assert.ErrorIs(t, err, models.ErrSuggestionOutdated)
+
+	// Соседнее предложение переживает ту же правку
+	assert.False(t, other.Rebase(collab.Diff(content, edited), edited))
+	assert.Equal(t, models.SuggestionStatusOpen, other.Status)
+	applied, err = other.Apply(edited)
+	require.NoError(t, err)
+	assert.Equal(t, "Важно! Созвон во вторник утром 😀 в офисе на втором этаже", applied)
+
+	// Две удаленные друг от друга правки одним сохранением не затрагивают предложение между ними
+	content = "Начало. Встреча во вторник в офисе. Конец."
+	between, err := models.NewNoteSuggestion(content, 19, 26, "среду")
+	require.NoError(t, err)
+	edited = "Самое начало. Встреча во вторник в офисе. Самый конец."
+	change := collab.DiffWords(content, edited)
+	assert.True(t, between.Rebase(change, edited))
+	assert.Equal(t, models.SuggestionStatusOpen, between.Status)
+	assert.Equal(t, 25, between.Start)
+	applied, err = between.Apply(edited)
+	require.NoError(t, err)
+	assert.Equal(t, "Самое начало. Встреча во среду в офисе. Самый конец.", applied)
+
+	assert.True(t, models.ValidSuggestionStatus(models.SuggestionStatusOutdated))
+	assert.False(t, models.ValidSuggestionStatus("pending"))
+}
@@ -0,0 +1,252 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoteAccessScopedToActiveSpace(t *testing.T) {
+	api := newTestAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+	workspace, other := api.workspace(alice), api.workspace(alice)
+	api.member(workspace, bob, models.WorkspaceRoleMember)
+	api.member(other, bob, models.WorkspaceRoleMember)
+	note := api.createNote(alice, gin.H{"title": "План"}, workspaceHeader(workspace)...)
+	path := fmt.Sprintf("/api/notes/%d", note.ID)
+
+	resp := api.request(bob, http.MethodGet, path, nil, workspaceHeader(workspace)...)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	// Из личного пространства и из другого рабочего пространства заметка не видна
+	resp = api.request(bob, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	resp = api.request(bob, http.MethodPut, path, gin.H{"title": "Чужой план"}, workspaceHeader(other)...)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "План", api.note(note.ID).Title)
+
+	// Явно открытый доступ действует из любого пространства, но только в пределах роли
+	api.share(note, bob, models.ShareRoleViewer)
+	resp = api.request(bob, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	resp = api.request(bob, http.MethodPut, path, gin.H{"title": "Чужой план"})
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Equal(t, "План", api.note(note.ID).Title)
+}
+
+// teamAPI создает рабочее пространство Алисы с участником Бобом и заметкой каждого из них
+func teamAPI(t *testing.T) (api *testAPI, workspace *models.Workspace, alice, bob *models.User, aliceNote, bobNote models.Note) {
+	api = newTestAPI(t)
+	alice, bob = api.user("alice"), api.user("bob")
+	workspace = api.workspace(alice)
+	api.member(workspace, bob, models.WorkspaceRoleMember)
+	aliceNote = api.createNote(alice, gin.H{"title": "Заметка Алисы"}, workspaceHeader(workspace)...)
+	bobNote = api.createNote(bob, gin.H{"title": "Заметка Боба"}, workspaceHeader(workspace)...)
+	return api, workspace, alice, bob, aliceNote, bobNote
+}
+
+// trashNote перемещает заметку в корзину от имени ее автора
+func trashNote(api *testAPI, user *models.User, note models.Note, headers ...string) {
+	api.t.Helper()
+	resp := api.request(user, http.MethodDelete, fmt.Sprintf("/api/notes/%d", note.ID), nil, headers...)
+	require.Equal(api.t, http.StatusOK, resp.Code, resp.Body.String())
+}
+
+func TestRestoreNoteRequiresOwnerAccess(t *testing.T) {
+	api, workspace, alice, bob, aliceNote, bobNote := teamAPI(t)
+	header := workspaceHeader(workspace)
+	trashNote(api, alice, aliceNote, header...)
+	trashNote(api, bob, bobNote, header...)
+
+	// Участник не восстанавливает заметку коллеги, но восстанавливает свою
+	resp := api.request(bob, http.MethodPost, fmt.Sprintf("/api/notes/%d/restore", aliceNote.ID), nil, header...)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.True(t, api.note(aliceNote.ID).DeletedAt.Valid)
+
+	resp = api.request(bob, http.MethodPost, fmt.Sprintf("/api/notes/%d/restore", bobNote.ID), nil, header...)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.False(t, api.note(bobNote.ID).DeletedAt.Valid)
+
+	// Администратор восстанавливает любую заметку
+	resp = api.request(alice, http.MethodPost, fmt.Sprintf("/api/notes/%d/restore", aliceNote.ID), nil, header...)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.False(t, api.note(aliceNote.ID).DeletedAt.Valid)
+}
+
+func TestEmptyTrashByMember(t *testing.T) {
+	api, workspace, alice, bob, aliceNote, bobNote := teamAPI(t)
+	header := workspaceHeader(workspace)
+	trashNote(api, alice, aliceNote, header...)
+	trashNote(api, bob, bobNote, header...)
+
+	// Участник удаляет из корзины только свои заметки
+	var body struct {
+		Deleted int `json:"deleted"`
+	}
+	api.decode(api.request(bob, http.MethodDelete, "/api/trash", nil, header...), http.StatusOK, &body)
+	assert.Equal(t, 1, body.Deleted)
+
+	var ids []uint
+	require.NoError(t, api.DB.Unscoped().Model(&models.Note{}).Pluck("id", &ids).Error)
+	assert.Equal(t, []uint{aliceNote.ID}, ids)
+}
+
+func TestNotebookNotesByMember(t *testing.T) {
+	api, workspace, alice, bob, aliceNote, bobNote := teamAPI(t)
+	header := workspaceHeader(workspace)
+	var created struct {
+		Notebook models.Notebook `json:"notebook"`
+	}
+	api.decode(api.request(alice, http.MethodPost, "/api/notebooks", gin.H{"name": "Проекты"}, header...), http.StatusCreated, &created)
+	path := fmt.Sprintf("/api/notebooks/%d", created.Notebook.ID)
+
+	// Участник переносит в блокнот только свои заметки
+	var moved struct {
+		Moved int64 `json:"moved"`
+	}
+	api.decode(api.request(bob, http.MethodPost, path+"/notes", gin.H{"note_ids": []uint{aliceNote.ID, bobNote.ID}}, header...), http.StatusOK, &moved)
+	assert.Equal(t, int64(1), moved.Moved)
+	assert.Equal(t, aliceNote.NotebookID, api.note(aliceNote.ID).NotebookID)
+	assert.Equal(t, &created.Notebook.ID, api.note(bobNote.ID).NotebookID)
+
+	api.decode(api.request(alice, http.MethodPost, path+"/notes", gin.H{"note_ids": []uint{aliceNote.ID}}, header...), http.StatusOK, &moved)
+	assert.Equal(t, int64(1), moved.Moved)
+
+	// Участник не может отправить в корзину блокнот с заметками коллег
+	resp := api.request(bob, http.MethodDelete, path+"?notes=trash", nil, header...)
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.False(t, api.note(aliceNote.ID).DeletedAt.Valid)
+	assert.False(t, api.note(bobNote.ID).DeletedAt.Valid)
+
+	resp = api.request(alice, http.MethodDelete, path+"?notes=trash", nil, header...)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.True(t, api.note(aliceNote.ID).DeletedAt.Valid)
+	assert.True(t, api.note(bobNote.ID).DeletedAt.Valid)
+}
+
+func TestSharedNoteWritesByRole(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	note := api.createNote(alice, gin.H{"title": "План", "content": "текст"})
+	path := fmt.Sprintf("/api/notes/%d", note.ID)
+
+	writes := []struct {
+		name        string
+		method      string
+		path        string
+		body        interface{}
+		contentType string
+	}{
+		{"PUT", http.MethodPut, path, gin.H{"title": "Чужой план"}, "application/json"},
+		{"PATCH", http.MethodPatch, path, `{"title": "Чужой план"}`, mergePatch},
+		{"перемещение", http.MethodPost, path + "/move", gin.H{"parent_id": nil}, "application/json"},
+		{"удаление", http.MethodDelete, path, nil, ""},
+	}
+
+	// Читатель и комментатор не меняют заметку ни одним способом
+	for _, role := range []string{models.ShareRoleViewer, models.ShareRoleCommenter} {
+		user := api.user(role)
+		api.share(note, user, role)
+		for _, write := range writes {
+			t.Run(role+" "+write.name, func(t *testing.T) {
+				resp := api.request(user, write.method, write.path, write.body, "Content-Type", write.contentType)
+				assert.Equal(t, http.StatusForbidden, resp.Code, resp.Body.String())
+
+				stored := api.note(note.ID)
+				assert.Equal(t, "План", stored.Title)
+				assert.Equal(t, note.Version, stored.Version)
+				assert.False(t, stored.DeletedAt.Valid)
+			})
+		}
+	}
+
+	// Редактор меняет содержимое, но перемещать и удалять заметку может только владелец
+	editor := api.user("editor")
+	api.share(note, editor, models.ShareRoleEditor)
+	resp := api.request(editor, http.MethodPut, path, gin.H{"title": "Общий план"})
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, "Общий план", api.note(note.ID).Title)
+	for _, write := range writes[2:] {
+		resp := api.request(editor, write.method, write.path, write.body, "Content-Type", write.contentType)
+		assert.Equal(t, http.StatusForbidden, resp.Code, write.name)
+	}
+	assert.False(t, api.note(note.ID).DeletedAt.Valid)
+}
+
+func TestWorkspaceGuestCannotWrite(t *testing.T) {
+	api, workspace, _, _, aliceNote, _ := teamAPI(t)
+	header := workspaceHeader(workspace)
+	guest := api.user("guest")
+	api.member(workspace, guest, models.WorkspaceRoleGuest)
+	path := fmt.Sprintf("/api/notes/%d", aliceNote.ID)
+
+	// Гость читает заметки пространства
+	resp := api.request(guest, http.MethodGet, path, nil, header...)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	writes := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodPost, "/api/notes", gin.H{"title": "Заметка гостя"}},
+		{http.MethodPut, path, gin.H{"title": "Чужой план"}},
+		{http.MethodDelete, path, nil},
+		{http.MethodPost, "/api/notebooks", gin.H{"name": "Блокнот гостя"}},
+		{http.MethodPost, "/api/notes/state", gin.H{"note_ids": []uint{aliceNote.ID}, "pinned": true}},
+	}
+	for _, write := range writes {
+		resp := api.request(guest, write.method, write.path, write.body, header...)
+		assert.Equal(t, http.StatusForbidden, resp.Code, write.method+" "+write.path)
+	}
+
+	stored := api.note(aliceNote.ID)
+	assert.Equal(t, "Заметка Алисы", stored.Title)
+	assert.False(t, stored.Pinned)
+	assert.False(t, stored.DeletedAt.Valid)
+	var count int64
+	require.NoError(t, api.DB.Model(&models.Note{}).Where("user_id = ?", guest.ID).Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, api.DB.Model(&models.Notebook{}).Where("user_id = ? AND is_default = ?", guest.ID, false).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestWorkspaceRejectsForeignNoteIDs(t *testing.T) {
+	api, workspace, alice, bob, _, bobNote := teamAPI(t)
+	header := workspaceHeader(workspace)
+	other := api.workspace(bob)
+	otherHeader := workspaceHeader(other)
+	foreign := api.createNote(bob, gin.H{"title": "Другая команда"}, otherHeader...)
+	personal := api.createNote(alice, gin.H{"title": "Личная"})
+
+	// Родитель из другого пространства не найден
+	for _, parent := range []models.Note{foreign, personal} {
+		resp := api.request(bob, http.MethodPost, fmt.Sprintf("/api/notes/%d/move", bobNote.ID), gin.H{"parent_id": parent.ID}, header...)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, parent.Title)
+		assert.Nil(t, api.note(bobNote.ID).ParentID)
+	}
+
+	// Перенос в блокнот и смена состояния не затрагивают заметки других пространств
+	var created struct {
+		Notebook models.Notebook `json:"notebook"`
+	}
+	api.decode(api.request(alice, http.MethodPost, "/api/notebooks", gin.H{"name": "Проекты"}, header...), http.StatusCreated, &created)
+	var moved struct {
+		Moved int64 `json:"moved"`
+	}
+	path := fmt.Sprintf("/api/notebooks/%d/notes", created.Notebook.ID)
+	api.decode(api.request(bob, http.MethodPost, path, gin.H{"note_ids": []uint{foreign.ID, bobNote.ID}}, header...), http.StatusOK, &moved)
+	assert.Equal(t, int64(1), moved.Moved)
+	assert.Equal(t, foreign.NotebookID, api.note(foreign.ID).NotebookID)
+
+	// Блокнот другого пространства недоступен
+	resp := api.request(bob, http.MethodPost, path, gin.H{"note_ids": []uint{foreign.ID}}, otherHeader...)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	resp = api.request(alice, http.MethodPost, "/api/notes", gin.H{"title": "Новая", "notebook_id": created.Notebook.ID})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+}
@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// setNoteStates меняет состояния заметок и возвращает число измененных
+func setNoteStates(api *testAPI, user *models.User, body gin.H, headers ...string) int64 {
+	api.t.Helper()
+	var resp struct {
+		Updated int64 `json:"updated"`
+	}
+	api.decode(api.request(user, http.MethodPost, "/api/notes/state", body, headers...), http.StatusOK, &resp)
+	return resp.Updated
+}
+
+func TestSetNoteStatesScopedToActiveSpace(t *testing.T) {
+	api, workspace, alice, bob, aliceNote, bobNote := teamAPI(t)
+	header := workspaceHeader(workspace)
+	personal := api.createNote(alice, gin.H{"title": "Личная"})
+	private := api.createNote(bob, gin.H{"title": "Личная Боба"})
+	ids := []uint{aliceNote.ID, bobNote.ID, personal.ID, private.ID}
+
+	// В рабочем пространстве меняются только его заметки, включая заметки коллег
+	assert.Equal(t, int64(2), setNoteStates(api, bob, gin.H{"note_ids": ids, "pinned": true}, header...))
+	assert.True(t, api.note(aliceNote.ID).Pinned)
+	assert.True(t, api.note(bobNote.ID).Pinned)
+	assert.False(t, api.note(personal.ID).Pinned)
+	assert.False(t, api.note(private.ID).Pinned)
+
+	// В личном пространстве — только собственные заметки
+	assert.Equal(t, int64(1), setNoteStates(api, bob, gin.H{"note_ids": ids, "favorite": true}))
+	assert.True(t, api.note(private.ID).Favorite)
+	assert.False(t, api.note(personal.ID).Favorite)
+	assert.False(t, api.note(aliceNote.ID).Favorite)
+
+	// Версия меняется только у измененных заметок
+	assert.Equal(t, private.Version+1, api.note(private.ID).Version)
+	assert.Equal(t, personal.Version, api.note(personal.ID).Version)
+}
+
+func TestSetNoteStatesRequiresState(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	note := api.createNote(alice, gin.H{"title": "План"})
+
+	resp := api.request(alice, http.MethodPost, "/api/notes/state", gin.H{"note_ids": []uint{note.ID}})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = api.request(alice, http.MethodPost, "/api/notes/state", gin.H{"note_ids": []uint{}, "pinned": true})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, note.Version, api.note(note.ID).Version)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noteChildren возвращает прямых потомков заметки
+func noteChildren(api *testAPI, parentID uint) []models.Note {
+	api.t.Helper()
+	var children []models.Note
+	require.NoError(api.t, api.DB.Preload("Tags").Where("parent_id = ?", parentID).Order("id").Find(&children).Error)
+	return children
+}
+
+func TestDuplicateSharedNoteSubtree(t *testing.T) {
+	api := newTestAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+	root := api.createNote(bob, gin.H{"title": "План", "tags": []string{"work"}})
+	child := api.createNote(bob, gin.H{"title": "Этап", "parent_id": root.ID})
+	api.share(root, alice, models.ShareRoleViewer)
+	api.share(child, alice, models.ShareRoleViewer)
+	// Закрытая для Алисы заметка не копируется
+	api.createNote(bob, gin.H{"title": "Секрет", "parent_id": root.ID})
+
+	var body struct {
+		Note models.Note `json:"note"`
+	}
+	api.decode(api.request(alice, http.MethodPost, fmt.Sprintf("/api/notes/%d/duplicate", root.ID), nil), http.StatusCreated, &body)
+
+	// Копия принадлежит Алисе и лежит в ее блокноте по умолчанию
+	duplicate := api.note(body.Note.ID)
+	assert.Equal(t, "План (копия)", duplicate.Title)
+	assert.Equal(t, alice.ID, duplicate.UserID)
+	assert.Nil(t, duplicate.WorkspaceID)
+	assert.Nil(t, duplicate.ParentID)
+	notebook, err := models.DefaultNotebook(api.DB, models.PersonalSpace(alice.ID))
+	require.NoError(t, err)
+	require.NotNil(t, duplicate.NotebookID)
+	assert.Equal(t, notebook.ID, *duplicate.NotebookID)
+
+	children := noteChildren(api, duplicate.ID)
+	require.Len(t, children, 1)
+	assert.Equal(t, "Этап", children[0].Title)
+	assert.Equal(t, alice.ID, children[0].UserID)
+
+	// Теги копии принадлежат пространству Алисы
+	var tags []models.Tag
+	require.NoError(t, api.DB.Model(&duplicate).Association("Tags").Find(&tags))
+	require.Len(t, tags, 1)
+	assert.Equal(t, "work", tags[0].Name)
+	assert.Equal(t, alice.ID, tags[0].UserID)
+
+	// Заметки Боба не изменились
+	assert.Len(t, noteChildren(api, root.ID), 2)
+}
+
+func TestDuplicateWorkspaceNoteByMember(t *testing.T) {
+	api := newTestAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+	workspace := api.workspace(alice)
+	api.member(workspace, bob, models.WorkspaceRoleMember)
+	parent := api.createNote(alice, gin.H{"title": "Раздел"}, workspaceHeader(workspace)...)
+	note := api.createNote(alice, gin.H{"title": "План", "parent_id": parent.ID}, workspaceHeader(workspace)...)
+
+	var body struct {
+		Note models.Note `json:"note"`
+	}
+	resp := api.request(bob, http.MethodPost, fmt.Sprintf("/api/notes/%d/duplicate", note.ID), nil, workspaceHeader(workspace)...)
+	api.decode(resp, http.StatusCreated, &body)
+
+	// Копия остается рядом с оригиналом, но ее автор — участник, сделавший копию
+	duplicate := api.note(body.Note.ID)
+	assert.Equal(t, bob.ID, duplicate.UserID)
+	require.NotNil(t, duplicate.WorkspaceID)
+	assert.Equal(t, workspace.ID, *duplicate.WorkspaceID)
+	require.NotNil(t, duplicate.ParentID)
+	assert.Equal(t, parent.ID, *duplicate.ParentID)
+	assert.Equal(t, note.NotebookID, duplicate.NotebookID)
+}
+
+func TestDuplicateInaccessibleNote(t *testing.T) {
+	api := newTestAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+	note := api.createNote(bob, gin.H{"title": "Секрет"})
+
+	resp := api.request(alice, http.MethodPost, fmt.Sprintf("/api/notes/%d/duplicate", note.ID), nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	var count int64
+	require.NoError(t, api.DB.Model(&models.Note{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestMoveNoteInvalidBody(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	parent := api.createNote(alice, gin.H{"title": "Раздел"})
+	note := api.createNote(alice, gin.H{"title": "План", "parent_id": parent.ID})
+
+	for _, body := range []string{`{"parent_id":`, `[1]`, `{"parent_id": "1"}`} {
+		resp := api.request(alice, http.MethodPost, fmt.Sprintf("/api/notes/%d/move", note.ID), body)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, body)
+	}
+	// Родитель не изменился
+	stored := api.note(note.ID)
+	require.NotNil(t, stored.ParentID)
+	assert.Equal(t, parent.ID, *stored.ParentID)
+}
+
+func TestMoveNoteRejectsCycles(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	root := api.createNote(alice, gin.H{"title": "Раздел"})
+	child := api.createNote(alice, gin.H{"title": "Подраздел", "parent_id": root.ID})
+	grandchild := api.createNote(alice, gin.H{"title": "План", "parent_id": child.ID})
+	path := fmt.Sprintf("/api/notes/%d/move", root.ID)
+
+	// Заметку нельзя сделать потомком ее самой или ее потомков
+	for _, parent := range []models.Note{root, child, grandchild} {
+		resp := api.request(alice, http.MethodPost, path, gin.H{"parent_id": parent.ID})
+		assert.Equal(t, http.StatusBadRequest, resp.Code, parent.Title)
+	}
+	stored := api.note(root.ID)
+	assert.Nil(t, stored.ParentID)
+	assert.Equal(t, root.Version, stored.Version)
+
+	// Перемещение в обратную сторону допустимо
+	resp := api.request(alice, http.MethodPost, fmt.Sprintf("/api/notes/%d/move", grandchild.ID), gin.H{"parent_id": nil})
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	resp = api.request(alice, http.MethodPost, path, gin.H{"parent_id": grandchild.ID})
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	stored = api.note(root.ID)
+	require.NotNil(t, stored.ParentID)
+	assert.Equal(t, grandchild.ID, *stored.ParentID)
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// notebookWithNotes создает блокнот с двумя заметками, одна из которых в корзине
+func notebookWithNotes(t *testing.T) (*testAPI, *models.User, models.Notebook, []models.Note) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+
+	var created struct {
+		Notebook models.Notebook `json:"notebook"`
+	}
+	api.decode(api.request(alice, http.MethodPost, "/api/notebooks", gin.H{"name": "Проекты"}), http.StatusCreated, &created)
+	notebook := created.Notebook
+
+	notes := []models.Note{
+		api.createNote(alice, gin.H{"title": "План", "notebook_id": notebook.ID}),
+		api.createNote(alice, gin.H{"title": "Старый план", "notebook_id": notebook.ID}),
+	}
+	resp := api.request(alice, http.MethodDelete, fmt.Sprintf("/api/notes/%d", notes[1].ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	return api, alice, notebook, notes
+}
+
+func TestDeleteNotebookMovesNotes(t *testing.T) {
+	api, alice, notebook, notes := notebookWithNotes(t)
+
+	resp := api.request(alice, http.MethodDelete, fmt.Sprintf("/api/notebooks/%d", notebook.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	var count int64
+	require.NoError(t, api.DB.Model(&models.Notebook{}).Where("id = ?", notebook.ID).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Заметки, включая удаленные в корзину, переносятся в блокнот по умолчанию
+	defaultNotebook, err := models.DefaultNotebook(api.DB, models.PersonalSpace(alice.ID))
+	require.NoError(t, err)
+	for _, note := range notes {
+		stored := api.note(note.ID)
+		require.NotNil(t, stored.NotebookID)
+		assert.Equal(t, defaultNotebook.ID, *stored.NotebookID)
+	}
+	assert.False(t, api.note(notes[0].ID).DeletedAt.Valid)
+	assert.True(t, api.note(notes[1].ID).DeletedAt.Valid)
+}
+
+func TestDeleteNotebookTrashesNotes(t *testing.T) {
+	api, alice, notebook, notes := notebookWithNotes(t)
+
+	resp := api.request(alice, http.MethodDelete, fmt.Sprintf("/api/notebooks/%d?notes=trash", notebook.ID), nil)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	// Заметки блокнота попадают в корзину, а не переносятся
+	for _, note := range notes {
+		assert.True(t, api.note(note.ID).DeletedAt.Valid)
+	}
+
+	var trash struct {
+		Notes []models.Note `json:"notes"`
+	}
+	api.decode(api.request(alice, http.MethodGet, "/api/trash", nil), http.StatusOK, &trash)
+	assert.Len(t, trash.Notes, 2)
+}
+
+func TestDeleteNotebookErrors(t *testing.T) {
+	api, alice, notebook, notes := notebookWithNotes(t)
+
+	resp := api.request(alice, http.MethodDelete, fmt.Sprintf("/api/notebooks/%d?notes=keep", notebook.ID), nil)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	defaultNotebook, err := models.DefaultNotebook(api.DB, models.PersonalSpace(alice.ID))
+	require.NoError(t, err)
+	resp = api.request(alice, http.MethodDelete, fmt.Sprintf("/api/notebooks/%d", defaultNotebook.ID), nil)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// Чужой блокнот не найден
+	bob := api.user("bob")
+	resp = api.request(bob, http.MethodDelete, fmt.Sprintf("/api/notebooks/%d", notebook.ID), nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	// После ошибок блокнот и заметки не изменились
+	stored := api.note(notes[0].ID)
+	require.NotNil(t, stored.NotebookID)
+	assert.Equal(t, notebook.ID, *stored.NotebookID)
+	assert.False(t, stored.DeletedAt.Valid)
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/omega/notes-app/internal/ordering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderingBetween(t *testing.T) {
+	first, err := ordering.Between("", "")
+	require.NoError(t, err)
+	assert.True(t, ordering.Valid(first))
+
+	for _, bounds := range [][2]string{
+		{"", "V"}, {"V", ""}, {"V", "W"}, {"V", "V1"}, {"1", "2"}, {"", "1"}, {"", "01"}, {"z", ""}, {"zz", ""},
+	} {
+		key, err := ordering.Between(bounds[0], bounds[1])
+		require.NoError(t, err, bounds)
+		assert.True(t, ordering.Valid(key), key)
+		if bounds[0] != "" {
+			assert.Greater(t, key, bounds[0], bounds)
+		}
+		if bounds[1] != "" {
+			assert.Less(t, key, bounds[1], bounds)
+		}
+	}
+
+	_, err = ordering.Between("W", "V")
+	assert.ErrorIs(t, err, ordering.ErrInvalidOrder)
+	_, err = ordering.Between("V", "V")
+	assert.ErrorIs(t, err, ordering.ErrInvalidOrder)
+	_, err = ordering.Between("V0", "")
+	assert.ErrorIs(t, err, ordering.ErrInvalidKey)
+}
+
+func TestOrderingRandomInserts(t *testing.T) {
+	// Случайные вставки между соседями всегда сохраняют строгий порядок
+	rng := rand.New(rand.NewSource(1))
+	keys := []string{}
+	for i := 0; i < 500; i++ {
+		pos := rng.Intn(len(keys) + 1)
+		before, after := "", ""
+		if pos > 0 {
+			before = keys[pos-1]
+		}
+		if pos < len(keys) {
+			after = keys[pos]
+		}
+		key, err := ordering.Between(before, after)
+		require.NoError(t, err)
+		keys = append(keys[:pos], append([]string{key}, keys[pos:]...)...)
+	}
+	assert.True(t, sort.StringsAreSorted(keys))
+	for i := 1; i < len(keys); i++ {
+		assert.NotEqual(t, keys[i-1], keys[i])
+	}
+}
+
+func TestOrderingSpread(t *testing.T) {
+	assert.Empty(t, ordering.Spread(0))
+
+	for _, n := range []int{1, 61, 62, 1000} {
+		keys := ordering.Spread(n)
+		require.Len(t, keys, n)
+		for i, key := range keys {
+			assert.True(t, ordering.Valid(key), key)
+			if i > 0 {
+				assert.Less(t, keys[i-1], key)
+			}
+		}
+	}
+	assert.LessOrEqual(t, len(ordering.Spread(1000)[999]), 2)
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/omega/notes-app/internal/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginationCursor(t *testing.T) {
+	cursor := pagination.Cursor{Sort: "title:asc", Value: "Список покупок", ID: 42}
+	encoded := pagination.Encode(cursor)
+
+	decoded, err := pagination.Decode(encoded, "title:asc")
+	require.NoError(t, err)
+	assert.Equal(t, cursor, decoded)
+
+	// Курсор другой сортировки и поврежденный курсор отклоняются
+	_, err = pagination.Decode(encoded, "created:desc")
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+	_, err = pagination.Decode("не-курсор", "title:asc")
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+
+	// Курсор закрепленной заметки сохраняет признак группы
+	pinned := pagination.Cursor{Sort: "updated:desc", Value: "2025-01-01T00:00:00Z", ID: 3, Pinned: true}
+	decoded, err = pagination.Decode(pagination.Encode(pinned), "updated:desc")
+	require.NoError(t, err)
+	assert.True(t, decoded.Pinned)
+}
+
+func TestPaginationLimit(t *testing.T) {
+	limit, err := pagination.ParseLimit("")
+	require.NoError(t, err)
+	assert.Equal(t, pagination.DefaultLimit, limit)
+
+	limit, err = pagination.ParseLimit("10")
+	require.NoError(t, err)
+	assert.Equal(t, 10, limit)
+
+	limit, err = pagination.ParseLimit("100000")
+	require.NoError(t, err)
+	assert.Equal(t, pagination.MaxLimit, limit)
+
+	_, err = pagination.ParseLimit("0")
+	assert.Error(t, err)
+	_, err = pagination.ParseLimit("abc")
+	assert.Error(t, err)
+}
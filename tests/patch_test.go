@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	mergePatch = "application/merge-patch+json"
+	jsonPatch  = "application/json-patch+json"
+)
+
+// patchFixture — заметка Алисы с тегами work и ideas в блокноте «Проекты»
+type patchFixture struct {
+	api      *testAPI
+	alice    *models.User
+	note     models.Note
+	notebook models.Notebook
+}
+
+func newPatchFixture(t *testing.T) *patchFixture {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+
+	var created struct {
+		Notebook models.Notebook `json:"notebook"`
+	}
+	api.decode(api.request(alice, http.MethodPost, "/api/notebooks", gin.H{"name": "Проекты"}), http.StatusCreated, &created)
+	note := api.createNote(alice, gin.H{
+		"title":       "Заметка",
+		"content":     "текст",
+		"tags":        []string{"work", "ideas"},
+		"notebook_id": created.Notebook.ID,
+	})
+	return &patchFixture{api: api, alice: alice, note: note, notebook: created.Notebook}
+}
+
+// patch отправляет PATCH с телом patch указанного типа
+func (f *patchFixture) patch(contentType, patch string) *httptest.ResponseRecorder {
+	return f.api.request(f.alice, http.MethodPatch, fmt.Sprintf("/api/notes/%d", f.note.ID), patch, "Content-Type", contentType)
+}
+
+// patched проверяет успешный ответ PATCH и возвращает заметку из него
+func (f *patchFixture) patched(resp *httptest.ResponseRecorder) models.Note {
+	f.api.t.Helper()
+	var body struct {
+		Note models.Note `json:"note"`
+	}
+	f.api.decode(resp, http.StatusOK, &body)
+	return body.Note
+}
+
+// defaultNotebookID возвращает блокнот по умолчанию личного пространства Алисы
+func (f *patchFixture) defaultNotebookID() uint {
+	f.api.t.Helper()
+	notebook, err := models.DefaultNotebook(f.api.DB, models.PersonalSpace(f.alice.ID))
+	require.NoError(f.api.t, err)
+	return notebook.ID
+}
+
+// storedTags возвращает имена тегов заметки, сохраненные в базе
+func (f *patchFixture) storedTags() []string {
+	f.api.t.Helper()
+	note := f.api.note(f.note.ID)
+	require.NoError(f.api.t, f.api.DB.Model(&note).Association("Tags").Find(&note.Tags))
+	return tagNames(note)
+}
+
+// tagNames возвращает имена тегов заметки
+func tagNames(note models.Note) []string {
+	names := []string{}
+	for _, tag := range note.Tags {
+		names = append(names, tag.Name)
+	}
+	return names
+}
+
+func TestPatchNoteMergePatch(t *testing.T) {
+	f := newPatchFixture(t)
+
+	// Поля, которых нет в патче, остаются прежними
+	note := f.patched(f.patch(mergePatch, `{"content": "новый текст"}`))
+	assert.Equal(t, "Заметка", note.Title)
+	assert.Equal(t, "новый текст", note.Content)
+	assert.ElementsMatch(t, []string{"work", "ideas"}, tagNames(note))
+	require.NotNil(t, note.NotebookID)
+	assert.Equal(t, f.notebook.ID, *note.NotebookID)
+	assert.Equal(t, f.note.Version+1, note.Version)
+
+	// Массив тегов заменяется целиком
+	note = f.patched(f.patch("application/json", `{"tags": ["home"]}`))
+	assert.Equal(t, []string{"home"}, tagNames(note))
+	assert.Equal(t, []string{"home"}, f.storedTags())
+
+	// null удаляет поле: теги снимаются, заметка возвращается в блокнот по умолчанию
+	note = f.patched(f.patch(mergePatch, `{"tags": null, "notebook_id": null}`))
+	assert.Empty(t, note.Tags)
+	assert.Empty(t, f.storedTags())
+	stored := f.api.note(f.note.ID)
+	require.NotNil(t, stored.NotebookID)
+	assert.Equal(t, f.defaultNotebookID(), *stored.NotebookID)
+	assert.Equal(t, "новый текст", stored.Content)
+}
+
+func TestPatchNoteJSONPatch(t *testing.T) {
+	f := newPatchFixture(t)
+
+	// Операции применяются по порядку и могут менять отдельные элементы массива
+	note := f.patched(f.patch(jsonPatch, `[
+		{"op": "test", "path": "/title", "value": "Заметка"},
+		{"op": "replace", "path": "/title", "value": "План"},
+		{"op": "remove", "path": "/tags/0"},
+		{"op": "add", "path": "/tags/-", "value": "home"}
+	]`))
+	assert.Equal(t, "План", note.Title)
+	assert.Equal(t, "текст", note.Content)
+	assert.ElementsMatch(t, []string{"ideas", "home"}, tagNames(note))
+
+	stored := f.api.note(f.note.ID)
+	assert.Equal(t, "План", stored.Title)
+	assert.ElementsMatch(t, []string{"ideas", "home"}, f.storedTags())
+
+	f.patched(f.patch(jsonPatch, `[{"op": "remove", "path": "/notebook_id"}]`))
+	stored = f.api.note(f.note.ID)
+	require.NotNil(t, stored.NotebookID)
+	assert.Equal(t, f.defaultNotebookID(), *stored.NotebookID)
+}
+
+func TestPatchNoteErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		status      int
+	}{
+		{"неподдерживаемый тип", "text/plain", `{"title": "План"}`, http.StatusUnsupportedMediaType},
+		{"некорректный merge patch", mergePatch, `{"title":`, http.StatusBadRequest},
+		{"некорректный JSON Patch", jsonPatch, `{"op": "replace"}`, http.StatusBadRequest},
+		{"не пройдена проверка test", jsonPatch, `[{"op": "test", "path": "/title", "value": "Другая"}]`, http.StatusConflict},
+		{"несуществующий путь", jsonPatch, `[{"op": "replace", "path": "/missing/0", "value": 1}]`, http.StatusUnprocessableEntity},
+		{"новое поле в merge patch", mergePatch, `{"pinned": true}`, http.StatusUnprocessableEntity},
+		{"новое поле в JSON Patch", jsonPatch, `[{"op": "add", "path": "/pinned", "value": true}]`, http.StatusUnprocessableEntity},
+		{"неверный тип поля", mergePatch, `{"title": 5}`, http.StatusUnprocessableEntity},
+		{"пустой заголовок", mergePatch, `{"title": "  "}`, http.StatusUnprocessableEntity},
+		{"удаление заголовка", jsonPatch, `[{"op": "remove", "path": "/title"}]`, http.StatusUnprocessableEntity},
+		{"пустое имя тега", mergePatch, `{"tags": [""]}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPatchFixture(t)
+			resp := f.patch(tt.contentType, tt.patch)
+			assert.Equal(t, tt.status, resp.Code, resp.Body.String())
+
+			// Отклоненный патч не меняет заметку
+			stored := f.api.note(f.note.ID)
+			assert.Equal(t, "Заметка", stored.Title)
+			assert.Equal(t, f.note.Version, stored.Version)
+			assert.ElementsMatch(t, []string{"work", "ideas"}, f.storedTags())
+		})
+	}
+}
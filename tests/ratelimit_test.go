@@ -0,0 +1,34 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/omega/notes-app/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterWindow(t *testing.T) {
+	limiter := ratelimit.New(2, time.Minute)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		allowed, _ := limiter.Allow("link", start)
+		assert.True(t, allowed)
+		limiter.Fail("link", start)
+	}
+
+	// Лимит исчерпан до конца окна, другие ключи не затронуты
+	allowed, retry := limiter.Allow("link", start.Add(20*time.Second))
+	assert.False(t, allowed)
+	assert.Equal(t, 40*time.Second, retry)
+	allowed, _ = limiter.Allow("other", start.Add(20*time.Second))
+	assert.True(t, allowed)
+
+	// В новом окне попытки снова разрешены
+	allowed, _ = limiter.Allow("link", start.Add(time.Minute))
+	assert.True(t, allowed)
+	limiter.Fail("link", start.Add(time.Minute))
+	allowed, _ = limiter.Allow("link", start.Add(time.Minute))
+	assert.True(t, allowed)
+}
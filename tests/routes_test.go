@@ -0,0 +1,21 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/routes"
+	"github.com/stretchr/testify/assert"
+)
+
+// Статические сегменты вроде /notes/tree соседствуют с параметрами вроде /notes/:id,
+// поэтому проверяем, что маршрутизатор принимает все маршруты без конфликтов
+func TestSetupRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	assert.NotPanics(t, func() {
+		routes.SetupRoutes(router)
+	})
+	assert.NotEmpty(t, router.Routes())
+}
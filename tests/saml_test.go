@@ -0,0 +1,307 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Генерирует самоподписанный сертификат для тестового IdP или SP
+func generateTestCertificate(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+// Тестовый IdP знает только одного SP
+type staticServiceProviders struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (s staticServiceProviders) GetServiceProvider(_ *http.Request, _ string) (*saml.EntityDescriptor, error) {
+	return s.metadata, nil
+}
+
+func newTestIdP(t *testing.T) *saml.IdentityProvider {
+	key, cert := generateTestCertificate(t, "idp.example.com")
+	return &saml.IdentityProvider{
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:      url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+	}
+}
+
+// Проходит SP-initiated вход: SP формирует запрос, IdP подписывает ответ,
+// а форма ответа возвращается в виде запроса к ACS
+func performSAMLLogin(t *testing.T, sp *saml.ServiceProvider, idp *saml.IdentityProvider, session *saml.Session) *http.Request {
+	authnRequest, err := sp.MakeAuthenticationRequest(
+		sp.GetSSOBindingLocation(saml.HTTPRedirectBinding),
+		saml.HTTPRedirectBinding,
+		saml.HTTPPostBinding,
+	)
+	require.NoError(t, err)
+
+	relayState, err := auth.SignRelayState(authnRequest.ID, 0)
+	require.NoError(t, err)
+
+	redirectURL, err := authnRequest.Redirect(relayState, sp)
+	require.NoError(t, err)
+
+	idpRequest, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest(http.MethodGet, redirectURL.String(), nil))
+	require.NoError(t, err)
+	require.NoError(t, idpRequest.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(idpRequest, session))
+
+	form, err := idpRequest.PostBinding()
+	require.NoError(t, err)
+
+	values := url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+	req := httptest.NewRequest(http.MethodPost, form.URL, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	require.NoError(t, req.ParseForm())
+	return req
+}
+
+func newTestSP(t *testing.T, idpMetadata *saml.EntityDescriptor) *saml.ServiceProvider {
+	key, cert := generateTestCertificate(t, "notes.example.com")
+	sp, err := auth.NewServiceProvider(&auth.SAMLConfig{
+		RootURL:     "https://notes.example.com",
+		KeyPair:     tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key},
+		IDPMetadata: idpMetadata,
+	})
+	require.NoError(t, err)
+	return sp
+}
+
+func TestSAMLSignedAssertion(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test_secret")
+
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp.Metadata())
+	idp.ServiceProviderProvider = staticServiceProviders{metadata: sp.Metadata()}
+
+	assert.Equal(t, "https://notes.example.com/api/auth/saml/acs", sp.AcsURL.String())
+
+	req := performSAMLLogin(t, sp, idp, &saml.Session{
+		ID:       "session-1",
+		NameID:   "alice@example.com",
+		UserName: "alice",
+	})
+
+	// ID запроса восстанавливается из подписанного RelayState
+	requestID, _, err := auth.VerifyRelayState(req.PostForm.Get("RelayState"))
+	require.NoError(t, err)
+
+	assertion, err := sp.ParseResponse(req, []string{requestID})
+	require.NoError(t, err)
+
+	identity, err := auth.IdentityFromAssertion(assertion)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", identity.Email)
+	assert.Equal(t, "alice", identity.Username)
+}
+
+func TestSAMLRejectsUntrustedIdP(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test_secret")
+
+	trusted := newTestIdP(t)
+	sp := newTestSP(t, trusted.Metadata())
+
+	// Злоумышленник подписывает ответ своим ключом, выдавая себя за доверенный IdP
+	attacker := newTestIdP(t)
+	attacker.ServiceProviderProvider = staticServiceProviders{metadata: sp.Metadata()}
+
+	req := performSAMLLogin(t, sp, attacker, &saml.Session{
+		ID:     "session-2",
+		NameID: "mallory@example.com",
+	})
+
+	requestID, _, err := auth.VerifyRelayState(req.PostForm.Get("RelayState"))
+	require.NoError(t, err)
+
+	_, err = sp.ParseResponse(req, []string{requestID})
+	assert.Error(t, err)
+}
+
+func TestSAMLRelayStateTampering(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test_secret")
+
+	relayState, err := auth.SignRelayState("id-123", 0)
+	require.NoError(t, err)
+
+	requestID, linkUserID, err := auth.VerifyRelayState(relayState)
+	assert.NoError(t, err)
+	assert.Equal(t, "id-123", requestID)
+	assert.Zero(t, linkUserID)
+
+	_, _, err = auth.VerifyRelayState(strings.Replace(relayState, "id-123", "id-456", 1))
+	assert.Error(t, err)
+
+	// Пользователь, для которого начата привязка, тоже защищен подписью
+	relayState, err = auth.SignRelayState("id-123", 7)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(relayState), 80)
+
+	requestID, linkUserID, err = auth.VerifyRelayState(relayState)
+	assert.NoError(t, err)
+	assert.Equal(t, "id-123", requestID)
+	assert.Equal(t, uint(7), linkUserID)
+
+	_, _, err = auth.VerifyRelayState(strings.Replace(relayState, ":7.", ":8.", 1))
+	assert.Error(t, err)
+}
+
+func TestSAMLLinkDomainAllowed(t *testing.T) {
+	os.Setenv("SAML_LINK_DOMAINS", "example.com, Corp.example.org")
+	defer os.Unsetenv("SAML_LINK_DOMAINS")
+
+	assert.True(t, auth.SAMLLinkDomainAllowed("alice@example.com"))
+	assert.True(t, auth.SAMLLinkDomainAllowed("bob@corp.example.org"))
+	assert.False(t, auth.SAMLLinkDomainAllowed("eve@evil-example.com"))
+	assert.False(t, auth.SAMLLinkDomainAllowed("eve@sub.example.com"))
+	assert.False(t, auth.SAMLLinkDomainAllowed("no-domain"))
+
+	os.Unsetenv("SAML_LINK_DOMAINS")
+	assert.False(t, auth.SAMLLinkDomainAllowed("alice@example.com"))
+}
+
+var (
+	samlAPIOnce sync.Once
+	samlAPIIdP  *saml.IdentityProvider
+)
+
+// configureSAML настраивает SSO приложения на тестовый IdP. SP приложения создается один раз
+// на процесс, поэтому и IdP общий для всех тестов.
+func configureSAML(t *testing.T) *saml.IdentityProvider {
+	samlAPIOnce.Do(func() {
+		dir := t.TempDir()
+		idp := newTestIdP(t)
+		metadata, err := xml.Marshal(idp.Metadata())
+		require.NoError(t, err)
+		key, cert := generateTestCertificate(t, "notes.example.com")
+		files := map[string][]byte{
+			"idp.xml": metadata,
+			"sp.crt":  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+			"sp.key":  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		}
+		for name, data := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+		}
+		os.Setenv("SAML_ROOT_URL", "https://notes.example.com")
+		os.Setenv("SAML_IDP_METADATA_FILE", filepath.Join(dir, "idp.xml"))
+		os.Setenv("SAML_SP_CERT_FILE", filepath.Join(dir, "sp.crt"))
+		os.Setenv("SAML_SP_KEY_FILE", filepath.Join(dir, "sp.key"))
+
+		sp, err := auth.GetServiceProvider()
+		require.NoError(t, err)
+		idp.ServiceProviderProvider = staticServiceProviders{metadata: sp.Metadata()}
+		samlAPIIdP = idp
+	})
+	require.NotNil(t, samlAPIIdP, "SAML не настроен")
+	return samlAPIIdP
+}
+
+// idpResponse проходит вход в IdP по адресу redirectURL и возвращает тело формы для ACS
+func idpResponse(t *testing.T, idp *saml.IdentityProvider, redirectURL string, session *saml.Session) string {
+	idpRequest, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest(http.MethodGet, redirectURL, nil))
+	require.NoError(t, err)
+	require.NoError(t, idpRequest.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(idpRequest, session))
+	form, err := idpRequest.PostBinding()
+	require.NoError(t, err)
+	return url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}.Encode()
+}
+
+func TestSAMLLinkRequiresBrowserAndConfirmation(t *testing.T) {
+	idp := configureSAML(t)
+	api := newTestAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+
+	// Алиса начинает привязку, и ее браузер получает cookie с nonce
+	var started struct {
+		RedirectURL string `json:"redirect_url"`
+	}
+	resp := api.request(alice, http.MethodPost, "/api/auth/saml/link", nil)
+	api.decode(resp, http.StatusOK, &started)
+	var nonce *http.Cookie
+	for _, cookie := range resp.Result().Cookies() {
+		if cookie.Name == "saml_link" {
+			nonce = cookie
+		}
+	}
+	require.NotNil(t, nonce)
+	assert.True(t, nonce.HttpOnly)
+	assert.True(t, nonce.Secure)
+
+	form := idpResponse(t, idp, started.RedirectURL, &saml.Session{ID: "session-3", NameID: "alice@corp.example.com"})
+	acs := func(cookie string) *httptest.ResponseRecorder {
+		headers := []string{"Content-Type", "application/x-www-form-urlencoded"}
+		if cookie != "" {
+			headers = append(headers, "Cookie", cookie)
+		}
+		return api.request(nil, http.MethodPost, "/api/auth/saml/acs", form, headers...)
+	}
+
+	// Ответ IdP, пришедший в другой браузер, например по подброшенной ссылке, не принимается
+	assert.Equal(t, http.StatusBadRequest, acs("").Code)
+
+	// В браузере, начавшем привязку, ответ принимается один раз, но учетная запись IdP
+	// привязывается только после подтверждения
+	var linked struct {
+		Email     string `json:"email"`
+		LinkToken string `json:"link_token"`
+	}
+	api.decode(acs(nonce.Name+"="+nonce.Value), http.StatusOK, &linked)
+	assert.Equal(t, "alice@corp.example.com", linked.Email)
+	require.NotEmpty(t, linked.LinkToken)
+	assert.Equal(t, http.StatusBadRequest, acs(nonce.Name+"="+nonce.Value).Code)
+
+	var stored models.User
+	require.NoError(t, api.DB.First(&stored, alice.ID).Error)
+	assert.Nil(t, stored.SAMLSubject)
+
+	// Подтвердить привязку может только пользователь, который ее начал, и только один раз
+	confirm := gin.H{"token": linked.LinkToken}
+	assert.Equal(t, http.StatusBadRequest, api.request(bob, http.MethodPost, "/api/auth/saml/link/confirm", confirm).Code)
+	resp = api.request(alice, http.MethodPost, "/api/auth/saml/link/confirm", confirm)
+	assert.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	assert.Equal(t, http.StatusBadRequest, api.request(alice, http.MethodPost, "/api/auth/saml/link/confirm", confirm).Code)
+
+	require.NoError(t, api.DB.First(&stored, alice.ID).Error)
+	require.NotNil(t, stored.SAMLSubject)
+	assert.Equal(t, "alice@corp.example.com", *stored.SAMLSubject)
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/handlers"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// savedSearchNotes возвращает заголовки заметок сохраненного поиска и общее количество
+func savedSearchNotes(api *testAPI, user *models.User, path string, headers ...string) ([]string, int64) {
+	api.t.Helper()
+	var body struct {
+		Notes []models.Note `json:"notes"`
+		Meta  struct {
+			Total int64 `json:"total"`
+		} `json:"meta"`
+	}
+	api.decode(api.request(user, http.MethodGet, path, nil, headers...), http.StatusOK, &body)
+	titles := []string{}
+	for _, note := range body.Notes {
+		titles = append(titles, note.Title)
+	}
+	return titles, body.Meta.Total
+}
+
+func TestSavedSearchNotesEvaluatesQuery(t *testing.T) {
+	api := newTestAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+	search := models.SavedSearch{Name: "Работа", Query: "tag:work -черновик", UserID: alice.ID}
+	api.create(&search)
+	path := fmt.Sprintf("/api/saved-searches/%d/notes", search.ID)
+
+	plan := api.createNote(alice, gin.H{"title": "План", "tags": []string{"work"}})
+	report := api.createNote(alice, gin.H{"title": "Отчет", "tags": []string{"work"}})
+	api.createNote(alice, gin.H{"title": "Черновик", "content": "черновик", "tags": []string{"work"}})
+	api.createNote(alice, gin.H{"title": "Покупки", "tags": []string{"home"}})
+	api.createNote(bob, gin.H{"title": "Чужая", "tags": []string{"work"}})
+	// Как и поиск, сохраненный запрос находит архивные заметки
+	require.NoError(t, api.DB.Model(&models.Note{}).Where("id = ?", report.ID).Update("archived", true).Error)
+
+	titles, total := savedSearchNotes(api, alice, path)
+	assert.ElementsMatch(t, []string{"План", "Отчет"}, titles)
+	assert.Equal(t, int64(2), total)
+
+	// Запрос вычисляется при каждом обращении, а не сохраняет найденные заметки
+	api.createNote(alice, gin.H{"title": "Задачи", "tags": []string{"work"}})
+	titles, total = savedSearchNotes(api, alice, path)
+	assert.ElementsMatch(t, []string{"План", "Отчет", "Задачи"}, titles)
+	assert.Equal(t, int64(3), total)
+
+	// Параметры списка заметок применяются поверх сохраненного запроса
+	require.NoError(t, api.DB.Model(&models.Note{}).Where("id = ?", plan.ID).Update("pinned", true).Error)
+	titles, _ = savedSearchNotes(api, alice, path+"?pinned=false")
+	assert.ElementsMatch(t, []string{"Отчет", "Задачи"}, titles)
+
+	// Чужой сохраненный поиск не найден
+	resp := api.request(bob, http.MethodGet, path, nil)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestSavedSearchNotesInWorkspace(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	workspace := api.workspace(alice)
+	search := models.SavedSearch{Name: "Работа", Query: "tag:work", UserID: alice.ID}
+	api.create(&search)
+	path := fmt.Sprintf("/api/saved-searches/%d/notes", search.ID)
+
+	api.createNote(alice, gin.H{"title": "Личная", "tags": []string{"work"}})
+	api.createNote(alice, gin.H{"title": "Командная", "tags": []string{"work"}}, workspaceHeader(workspace)...)
+
+	// Сохраненный поиск выполняется в активном пространстве
+	titles, _ := savedSearchNotes(api, alice, path)
+	assert.Equal(t, []string{"Личная"}, titles)
+	titles, _ = savedSearchNotes(api, alice, path, workspaceHeader(workspace)...)
+	assert.Equal(t, []string{"Командная"}, titles)
+}
+
+func TestSavedSearchNotesBrokenQuery(t *testing.T) {
+	// Запрос, который больше не разбирается, возвращает ошибку, а не все заметки
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	api.createNote(alice, gin.H{"title": "План"})
+	search := models.SavedSearch{Name: "Старый", Query: "color:red", UserID: alice.ID}
+	api.create(&search)
+
+	var body map[string]interface{}
+	api.decode(api.request(alice, http.MethodGet, fmt.Sprintf("/api/saved-searches/%d/notes", search.ID), nil), http.StatusBadRequest, &body)
+	assert.Contains(t, body, "error")
+	assert.NotContains(t, body, "notes")
+}
+
+func TestSavedSearchesNoteCounts(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	for _, search := range []models.SavedSearch{
+		{Name: "Важное", Query: "is:pinned", UserID: alice.ID},
+		{Name: "Старый", Query: "color:red", UserID: alice.ID},
+		{Name: "Работа", Query: "tag:work", UserID: alice.ID},
+	} {
+		api.create(&search)
+	}
+	plan := api.createNote(alice, gin.H{"title": "План", "tags": []string{"work"}})
+	api.createNote(alice, gin.H{"title": "Отчет", "tags": []string{"work"}})
+	api.createNote(alice, gin.H{"title": "Покупки"})
+	require.NoError(t, api.DB.Model(&models.Note{}).Where("id = ?", plan.ID).Update("pinned", true).Error)
+
+	var body struct {
+		SavedSearches []handlers.SavedSearchWithCount `json:"saved_searches"`
+	}
+	api.decode(api.request(alice, http.MethodGet, "/api/saved-searches", nil), http.StatusOK, &body)
+
+	// Количество считается для каждого запроса, ошибочный запрос получает ошибку вместо количества
+	counts := map[string]*int64{}
+	failures := map[string]string{}
+	for _, search := range body.SavedSearches {
+		counts[search.Name] = search.NoteCount
+		failures[search.Name] = search.Error
+	}
+	require.Len(t, counts, 3)
+	require.NotNil(t, counts["Важное"])
+	assert.Equal(t, int64(1), *counts["Важное"])
+	require.NotNil(t, counts["Работа"])
+	assert.Equal(t, int64(2), *counts["Работа"])
+	assert.Nil(t, counts["Старый"])
+	assert.NotEmpty(t, failures["Старый"])
+	assert.Empty(t, failures["Работа"])
+}
+
+func TestCreateSavedSearchRejectsInvalidQuery(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+
+	resp := api.request(alice, http.MethodPost, "/api/saved-searches", gin.H{"name": "Старый", "query": "is:secret"})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	var count int64
+	require.NoError(t, api.DB.Model(&models.SavedSearch{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Корректный запрос сохраняется
+	resp = api.request(alice, http.MethodPost, "/api/saved-searches", gin.H{"name": "Работа", "query": "tag:work"})
+	assert.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	require.NoError(t, api.DB.Model(&models.SavedSearch{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
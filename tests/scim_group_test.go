@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/scim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSCIMAPI включает SCIM; владельцем создаваемых групп становится пользователь owner
+func newSCIMAPI(t *testing.T) *testAPI {
+	api := newTestAPI(t)
+	owner := api.user("owner")
+	t.Setenv("SCIM_TOKEN", "scim-secret")
+	t.Setenv("SCIM_GROUP_OWNER", owner.Email)
+	return api
+}
+
+// scimRequest выполняет запрос к SCIM с токеном IdP
+func scimRequest(api *testAPI, method, path string, body interface{}) *httptest.ResponseRecorder {
+	api.t.Helper()
+	return api.request(nil, method, path, body, "Authorization", "Bearer scim-secret")
+}
+
+// scimMembers возвращает значения участников группы
+func scimMembers(users ...*models.User) []gin.H {
+	members := []gin.H{}
+	for _, user := range users {
+		members = append(members, gin.H{"value": strconv.FormatUint(uint64(user.ID), 10)})
+	}
+	return members
+}
+
+// workspaceRoles возвращает роли участников рабочего пространства по именам пользователей
+func workspaceRoles(api *testAPI, workspaceID uint) map[string]string {
+	api.t.Helper()
+	var members []models.WorkspaceMember
+	require.NoError(api.t, api.DB.Preload("User").Where("workspace_id = ?", workspaceID).Find(&members).Error)
+	roles := map[string]string{}
+	for _, member := range members {
+		roles[member.User.Username] = member.Role
+	}
+	return roles
+}
+
+func TestSCIMGroupsHideUserWorkspaces(t *testing.T) {
+	api := newSCIMAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+	workspace := api.workspace(alice)
+	api.member(workspace, bob, models.WorkspaceRoleMember)
+	path := fmt.Sprintf("/scim/v2/Groups/%d", workspace.ID)
+
+	// Пространство, созданное пользователем, не видно IdP и не меняется через SCIM
+	var list scim.ListResponse
+	api.decode(scimRequest(api, http.MethodGet, "/scim/v2/Groups", nil), http.StatusOK, &list)
+	assert.Zero(t, list.TotalResults)
+
+	assert.Equal(t, http.StatusNotFound, scimRequest(api, http.MethodGet, path, nil).Code)
+	resp := scimRequest(api, http.MethodPut, path, gin.H{"displayName": "Захват", "externalId": "grp-1", "members": []gin.H{}})
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	resp = scimRequest(api, http.MethodPatch, path, gin.H{"Operations": []gin.H{{"op": "remove", "path": "members"}}})
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, http.StatusNotFound, scimRequest(api, http.MethodDelete, path, nil).Code)
+
+	var stored models.Workspace
+	require.NoError(t, api.DB.First(&stored, workspace.ID).Error)
+	assert.Equal(t, "Команда", stored.Name)
+	assert.Nil(t, stored.ExternalID)
+	assert.Equal(t, map[string]string{"alice": models.WorkspaceRoleOwner, "bob": models.WorkspaceRoleMember}, workspaceRoles(api, workspace.ID))
+}
+
+func TestSCIMGroupLifecycle(t *testing.T) {
+	api := newSCIMAPI(t)
+	alice, bob, carol := api.user("alice"), api.user("bob"), api.user("carol")
+
+	// Без externalId группа не создается: по нему пространство связано с IdP
+	resp := scimRequest(api, http.MethodPost, "/scim/v2/Groups", gin.H{"displayName": "Команда"})
+	assert.Equal(t, http.StatusBadRequest, resp.Code, resp.Body.String())
+
+	var group scim.Group
+	api.decode(scimRequest(api, http.MethodPost, "/scim/v2/Groups", gin.H{
+		"displayName": "Команда",
+		"externalId":  "grp-1",
+		"members":     scimMembers(alice, bob),
+	}), http.StatusCreated, &group)
+	id, err := strconv.ParseUint(group.ID, 10, 32)
+	require.NoError(t, err)
+	workspaceID := uint(id)
+	path := "/scim/v2/Groups/" + group.ID
+
+	// Пространство получает владельца, который в группу IdP не входит
+	assert.Equal(t, map[string]string{
+		"owner": models.WorkspaceRoleOwner,
+		"alice": models.WorkspaceRoleMember,
+		"bob":   models.WorkspaceRoleMember,
+	}, workspaceRoles(api, workspaceID))
+	assert.ElementsMatch(t, scimMemberValues(scimMembers(alice, bob)), groupMemberValues(group))
+
+	// Участника, добавленного вручную, IdP не исключает
+	api.member(&models.Workspace{ID: workspaceID}, carol, models.WorkspaceRoleAdmin)
+	resp = scimRequest(api, http.MethodPut, path, gin.H{"displayName": "Команда", "externalId": "grp-1", "members": scimMembers(alice)})
+	api.decode(resp, http.StatusOK, &group)
+	assert.ElementsMatch(t, scimMemberValues(scimMembers(alice)), groupMemberValues(group))
+	assert.Equal(t, map[string]string{
+		"owner": models.WorkspaceRoleOwner,
+		"alice": models.WorkspaceRoleMember,
+		"carol": models.WorkspaceRoleAdmin,
+	}, workspaceRoles(api, workspaceID))
+
+	// externalId нельзя сбросить
+	resp = scimRequest(api, http.MethodPatch, path, gin.H{"Operations": []gin.H{{"op": "remove", "path": "externalId"}}})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp = scimRequest(api, http.MethodPatch, path, gin.H{"Operations": []gin.H{{"op": "replace", "path": "externalId", "value": ""}}})
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// Удаление группы отвязывает пространство: заметки и участники вне IdP остаются
+	note := api.createNote(carol, gin.H{"title": "План"}, workspaceHeader(&models.Workspace{ID: workspaceID})...)
+	assert.Equal(t, http.StatusNoContent, scimRequest(api, http.MethodDelete, path, nil).Code)
+	assert.Equal(t, http.StatusNotFound, scimRequest(api, http.MethodGet, path, nil).Code)
+
+	var stored models.Workspace
+	require.NoError(t, api.DB.First(&stored, workspaceID).Error)
+	assert.Nil(t, stored.ExternalID)
+	assert.Equal(t, map[string]string{
+		"owner": models.WorkspaceRoleOwner,
+		"carol": models.WorkspaceRoleAdmin,
+	}, workspaceRoles(api, workspaceID))
+	assert.Equal(t, "План", api.note(note.ID).Title)
+}
+
+func TestSCIMCreateGroupWithoutOwner(t *testing.T) {
+	api := newSCIMAPI(t)
+	t.Setenv("SCIM_GROUP_OWNER", "nobody@example.com")
+
+	resp := scimRequest(api, http.MethodPost, "/scim/v2/Groups", gin.H{"displayName": "Команда", "externalId": "grp-1"})
+	assert.Equal(t, http.StatusNotImplemented, resp.Code, resp.Body.String())
+
+	var count int64
+	require.NoError(t, api.DB.Model(&models.Workspace{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+// groupMemberValues возвращает значения участников группы из ответа SCIM
+func groupMemberValues(group scim.Group) []string {
+	values := []string{}
+	for _, member := range group.Members {
+		values = append(values, member.Value)
+	}
+	return values
+}
+
+// scimMemberValues возвращает значения участников из тела запроса
+func scimMemberValues(members []gin.H) []string {
+	values := []string{}
+	for _, member := range members {
+		values = append(values, member["value"].(string))
+	}
+	return values
+}
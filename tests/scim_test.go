@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/omega/notes-app/internal/scim"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSCIMAttributes = map[string]scim.Attribute{
+	"userName":   {Column: "username"},
+	"externalId": {Column: "external_id", CaseExact: true},
+	"active":     {Column: "suspended_at", Kind: scim.KindNullAsTrue},
+	"id":         {Column: "id", Kind: scim.KindInt},
+}
+
+func TestSCIMFilterEquality(t *testing.T) {
+	sql, args, err := scim.CompileFilter(`userName eq "Alice"`, testSCIMAttributes)
+	require.NoError(t, err)
+	assert.Equal(t, "LOWER(username) = ?", sql)
+	assert.Equal(t, []interface{}{"alice"}, args)
+}
+
+func TestSCIMFilterLogicalOperators(t *testing.T) {
+	sql, args, err := scim.CompileFilter(`externalId sw "abc" and (active eq false or not (id gt 10))`, testSCIMAttributes)
+	require.NoError(t, err)
+	assert.Equal(t, "(external_id LIKE ? AND ((suspended_at IS NOT NULL OR NOT (id > ?))))", sql)
+	assert.Equal(t, []interface{}{"abc%", int64(10)}, args)
+}
+
+func TestSCIMFilterEscapesLikePatterns(t *testing.T) {
+	_, args, err := scim.CompileFilter(`userName co "50%_off"`, testSCIMAttributes)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{`%50\%\_off%`}, args)
+}
+
+func TestSCIMFilterErrors(t *testing.T) {
+	cases := map[string]int{
+		`password eq "x"`:      0,
+		`userName eq "x`:       12,
+		`userName eq "x" or`:   18,
+		`active gt true`:       7,
+		`userName eq "x")`:     15,
+		`userName unknown "x"`: 9,
+	}
+	for filter, pos := range cases {
+		_, _, err := scim.CompileFilter(filter, testSCIMAttributes)
+		var filterErr *scim.FilterError
+		if assert.ErrorAs(t, err, &filterErr, filter) {
+			assert.Equal(t, pos, filterErr.Pos, filter)
+		}
+	}
+}
+
+func TestSCIMParseValuePath(t *testing.T) {
+	attr, sub, value, err := scim.ParseValuePath(`members[value eq "42"]`)
+	require.NoError(t, err)
+	assert.Equal(t, "members", attr)
+	assert.Equal(t, "value", sub)
+	assert.Equal(t, "42", value)
+
+	cases := map[string]int{
+		`members`:                  0,
+		`members[value co "4"]`:    14,
+		`members[value eq "42" x]`: 22,
+		`members[value eq "42"`:    0,
+		`[value eq "42"]`:          0,
+		`members[value eq "42]`:    17,
+	}
+	for path, pos := range cases {
+		_, _, _, err := scim.ParseValuePath(path)
+		var filterErr *scim.FilterError
+		if assert.ErrorAs(t, err, &filterErr, path) {
+			assert.Equal(t, pos, filterErr.Pos, path)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/handlers"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// searchResponse — ответ поиска
+type searchResponse struct {
+	Results []handlers.SearchResult `json:"results"`
+	Meta    struct {
+		Total int64 `json:"total"`
+		Fuzzy bool  `json:"fuzzy"`
+	} `json:"meta"`
+}
+
+// searchNotes выполняет поиск пользователя user по запросу q
+func searchNotes(api *testAPI, user *models.User, q string) searchResponse {
+	api.t.Helper()
+	var body searchResponse
+	api.decode(api.request(user, http.MethodGet, "/api/notes/search?q="+url.QueryEscape(q), nil), http.StatusOK, &body)
+	return body
+}
+
+func TestSearchHighlightEscaping(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	note := api.createNote(alice, gin.H{
+		"title":   `<b>план</b> & "итоги"`,
+		"content": "<script>alert('план')</script>",
+	})
+
+	body := searchNotes(api, alice, "план")
+	require.Len(t, body.Results, 1)
+	result := body.Results[0]
+
+	// Текст заметки экранируется, разметку <mark> добавляет только подсветка совпадений
+	assert.Equal(t, note.ID, result.Note.ID)
+	assert.Equal(t, "&lt;b&gt;<mark>план</mark>&lt;/b&gt; &amp; &#34;итоги&#34;", result.TitleHighlight)
+	assert.Equal(t, "&lt;script&gt;alert(&#39;<mark>план</mark>&#39;)&lt;/script&gt;", result.Snippet)
+}
+
+func TestSearchHighlightPlainText(t *testing.T) {
+	// Текст, похожий на разметку <mark>, остается текстом
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	api.createNote(alice, gin.H{
+		"title":   "<mark>заголовок</mark>",
+		"content": "a < b && c > d",
+		"tags":    []string{"work"},
+	})
+
+	body := searchNotes(api, alice, "tag:work")
+	require.Len(t, body.Results, 1)
+	assert.Equal(t, "&lt;mark&gt;заголовок&lt;/mark&gt;", body.Results[0].TitleHighlight)
+	assert.Equal(t, "a &lt; b &amp;&amp; c &gt; d", body.Results[0].Snippet)
+}
+
+func TestSearchFuzzyFallback(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	note := api.createNote(alice, gin.H{"title": "Плановое <совещание>", "content": "повестка", "tags": []string{"work"}})
+	api.createNote(alice, gin.H{"title": "Плановое совещание", "content": "без тега"})
+
+	// Полнотекстовый поиск ничего не нашел: повторяем поиск по заголовкам с опечатками,
+	// сохраняя прочие условия запроса
+	body := searchNotes(api, alice, "пландвое tag:work")
+	assert.True(t, body.Meta.Fuzzy)
+	assert.Equal(t, int64(1), body.Meta.Total)
+	require.Len(t, body.Results, 1)
+	assert.Equal(t, note.ID, body.Results[0].Note.ID)
+	assert.Equal(t, "Плановое &lt;совещание&gt;", body.Results[0].TitleHighlight)
+}
+
+func TestSearchWithoutFuzzyFallback(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.user("alice")
+	api.createNote(alice, gin.H{"title": "План", "content": "план работ"})
+	api.createNote(alice, gin.H{"title": "Совещание", "content": "повестка"})
+
+	tests := []struct {
+		name  string
+		q     string
+		total int64
+	}{
+		// Полнотекстовый поиск нашел заметки
+		{"есть совпадения", "план", 1},
+		// Без слов нечеткий поиск не нужен, даже если ничего не нашлось
+		{"нет текста", "tag:work", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := searchNotes(api, alice, tt.q)
+			assert.False(t, body.Meta.Fuzzy)
+			assert.Equal(t, tt.total, body.Meta.Total)
+			assert.Len(t, body.Results, int(tt.total))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/omega/notes-app/internal/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchParse(t *testing.T) {
+	node, err := search.Parse(`отчет tag:work -черновик`)
+	require.NoError(t, err)
+	assert.Equal(t, &search.And{
+		Left: &search.And{
+			Left:  &search.Text{Value: "отчет", Pos: 0},
+			Right: &search.Field{Name: "tag", Value: "work", Pos: 6, ValuePos: 10},
+		},
+		Right: &search.Not{Expr: &search.Text{Value: "черновик", Pos: 16}},
+	}, node)
+
+	node, err = search.Parse(`notebook:"Мои проекты" OR "план на неделю"`)
+	require.NoError(t, err)
+	assert.Equal(t, &search.Or{
+		Left:  &search.Field{Name: "notebook", Value: "Мои проекты", Pos: 0, ValuePos: 9},
+		Right: &search.Text{Value: "план на неделю", Phrase: true, Pos: 26},
+	}, node)
+
+	// Двоеточие во времени и дефис внутри слова не являются операторами
+	node, err = search.Parse(`встреча 12:30 e-mail`)
+	require.NoError(t, err)
+	assert.Equal(t, &search.And{
+		Left: &search.And{
+			Left:  &search.Text{Value: "встреча", Pos: 0},
+			Right: &search.Text{Value: "12:30", Pos: 8},
+		},
+		Right: &search.Text{Value: "e-mail", Pos: 14},
+	}, node)
+}
+
+func TestSearchParseErrors(t *testing.T) {
+	cases := []struct {
+		query string
+		pos   int
+	}{
+		{``, 0},
+		{`отчет "без конца`, 6},
+		{`(a OR b`, 0},
+		{`a OR`, 4},
+		{`OR a`, 0},
+		{`a )`, 2},
+		{`tag:`, 4},
+	}
+	for _, c := range cases {
+		_, err := search.Parse(c.query)
+		var parseErr *search.ParseError
+		require.ErrorAs(t, err, &parseErr, c.query)
+		assert.Equal(t, c.pos, parseErr.Pos, c.query)
+	}
+}
+
+func TestSearchCompile(t *testing.T) {
+	query, err := search.Compile(`tag:work created:>2025-01-01 -черновик`)
+	require.NoError(t, err)
+	assert.Contains(t, query.Where, "LOWER(tags.name) = LOWER(?)")
+	assert.Contains(t, query.Where, "notes.created_at >= ?")
+	assert.Contains(t, query.Where, "NOT (")
+	assert.NotContains(t, query.Where, "work")
+	// Исключенные слова не участвуют в ранжировании
+	assert.False(t, query.HasText)
+
+	query, err = search.Compile(`"план" OR задача`)
+	require.NoError(t, err)
+	assert.True(t, query.HasText)
+	assert.Contains(t, query.TSQuery, "||")
+	assert.Equal(t, []interface{}{"план", "задача"}, query.TSArgs)
+
+	query, err = search.Compile(`is:pinned -is:archived`)
+	require.NoError(t, err)
+	assert.Contains(t, query.Where, "notes.pinned")
+	assert.Contains(t, query.Where, "NOT (notes.archived)")
+
+	var parseErr *search.ParseError
+	_, err = search.Compile(`color:red`)
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 0, parseErr.Pos)
+
+	_, err = search.Compile(`отчет created:>2025-13-01`)
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 15, parseErr.Pos)
+
+	_, err = search.Compile(`is:secret`)
+	require.ErrorAs(t, err, &parseErr)
+	assert.Equal(t, 3, parseErr.Pos)
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// noteTitles возвращает заголовки заметок из списка GET /api/notes с параметрами query
+func noteTitles(api *testAPI, user *models.User, query url.Values) []string {
+	api.t.Helper()
+	var body struct {
+		Notes []models.Note `json:"notes"`
+	}
+	api.decode(api.request(user, http.MethodGet, "/api/notes?"+query.Encode(), nil), http.StatusOK, &body)
+	titles := []string{}
+	for _, note := range body.Notes {
+		titles = append(titles, note.Title)
+	}
+	return titles
+}
+
+// tagFilterAPI создает заметки с тегами: у Боба есть своя заметка с тегом work
+func tagFilterAPI(t *testing.T) (*testAPI, *models.User) {
+	api := newTestAPI(t)
+	alice, bob := api.user("alice"), api.user("bob")
+	api.createNote(alice, gin.H{"title": "План", "tags": []string{"Work", "Big Plans"}})
+	api.createNote(alice, gin.H{"title": "Отчет", "tags": []string{"work"}})
+	api.createNote(alice, gin.H{"title": "Покупки", "tags": []string{"home"}})
+	api.createNote(alice, gin.H{"title": "Черновик"})
+	api.createNote(bob, gin.H{"title": "Чужая", "tags": []string{"work", "big plans"}})
+	return api, alice
+}
+
+func TestFilterNotesByTagsAll(t *testing.T) {
+	api, alice := tagFilterAPI(t)
+
+	for _, mode := range []string{"", "all"} {
+		// Заметка должна иметь все теги: повторы, регистр и лишние пробелы не учитываются
+		query := url.Values{"tag": {"Work", " work ", "Big   Plans"}, "tag_mode": {mode}}
+		assert.Equal(t, []string{"План"}, noteTitles(api, alice, query), "mode %q", mode)
+	}
+}
+
+func TestFilterNotesByTagsAny(t *testing.T) {
+	api, alice := tagFilterAPI(t)
+
+	// Достаточно одного тега из списка
+	query := url.Values{"tag": {"work", "HOME"}, "tag_mode": {"any"}}
+	assert.ElementsMatch(t, []string{"План", "Отчет", "Покупки"}, noteTitles(api, alice, query))
+}
+
+func TestFilterNotesByTagsEmpty(t *testing.T) {
+	api, alice := tagFilterAPI(t)
+
+	// Без тегов фильтр не применяется, даже при неизвестном режиме
+	query := url.Values{"tag": {"", "   "}, "tag_mode": {"bogus"}}
+	assert.ElementsMatch(t, []string{"План", "Отчет", "Покупки", "Черновик"}, noteTitles(api, alice, query))
+}
+
+func TestFilterNotesByTagsInvalidMode(t *testing.T) {
+	api, alice := tagFilterAPI(t)
+
+	resp := api.request(alice, http.MethodGet, "/api/notes?tag=work&tag_mode=none", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
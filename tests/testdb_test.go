@@ -0,0 +1,3445 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/omega/notes-app/internal/auth"
+	"github.com/omega/notes-app/internal/database"
+	"github.com/omega/notes-app/internal/models"
+	"github.com/omega/notes-app/internal/routes"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Тесты обработчиков работают с базой в памяти: драйвер database/sql ниже разбирает
+// SQL, который строит GORM с диалектом PostgreSQL, и выполняет его над таблицами моделей.
+// Поддерживается то подмножество SQL, которое использует приложение, включая
+// рекурсивные CTE и упрощенный полнотекстовый поиск; транзакции откатываются по снимку.
+
+// testModels — модели, таблицы которых создаются в тестовой базе
+var testModels = []interface{}{
+	&models.User{},
+	&models.Workspace{},
+	&models.WorkspaceMember{},
+	&models.WorkspaceInvitation{},
+	&models.Notebook{},
+	&models.Tag{},
+	&models.Note{},
+	&models.NoteRevision{},
+	&models.NoteShare{},
+	&models.PublicLink{},
+	&models.NoteSuggestion{},
+	&models.BurnNote{},
+	&models.SavedSearch{},
+	&models.OAuthClient{},
+	&models.OAuthCode{},
+	&models.OAuthToken{},
+	&models.SAMLLinkRequest{},
+}
+
+// newTestDB создает пустую базу в памяти и подключает к ней обработчики до конца теста
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	store, err := newMemStore(testModels)
+	require.NoError(t, err)
+
+	sqlDB := sql.OpenDB(memConnector{store: store})
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// testAPI — маршруты приложения поверх тестовой базы
+type testAPI struct {
+	t      *testing.T
+	DB     *gorm.DB
+	router *gin.Engine
+}
+
+// newTestAPI подключает все маршруты приложения к новой тестовой базе
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	api := &testAPI{t: t, DB: newTestDB(t), router: gin.New()}
+	routes.SetupRoutes(api.router)
+	return api
+}
+
+// create сохраняет запись в тестовой базе
+func (api *testAPI) create(value interface{}) {
+	api.t.Helper()
+	require.NoError(api.t, api.DB.Create(value).Error)
+}
+
+// user создает пользователя с указанным именем
+func (api *testAPI) user(name string) *models.User {
+	api.t.Helper()
+	user := &models.User{Username: name, Email: name + "@example.com"}
+	user.SetPassword("password")
+	api.create(user)
+	return user
+}
+
+// request выполняет запрос к API от имени user (без авторизации, если user равен nil).
+// Тело, если оно не строка, кодируется в JSON; headers попарно задают заголовки запроса.
+func (api *testAPI) request(user *models.User, method, path string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	api.t.Helper()
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(body)
+	default:
+		encoded, err := json.Marshal(body)
+		require.NoError(api.t, err)
+		reader = strings.NewReader(string(encoded))
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if user != nil {
+		token, err := auth.GenerateToken(user)
+		require.NoError(api.t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp := httptest.NewRecorder()
+	api.router.ServeHTTP(resp, req)
+	return resp
+}
+
+// decode проверяет код ответа и разбирает JSON-тело в body
+func (api *testAPI) decode(resp *httptest.ResponseRecorder, status int, body interface{}) {
+	api.t.Helper()
+	require.Equal(api.t, status, resp.Code, resp.Body.String())
+	require.NoError(api.t, json.Unmarshal(resp.Body.Bytes(), body), resp.Body.String())
+}
+
+// createNote создает заметку через API от имени user и возвращает ее из ответа
+func (api *testAPI) createNote(user *models.User, body interface{}, headers ...string) models.Note {
+	api.t.Helper()
+	var created struct {
+		Note models.Note `json:"note"`
+	}
+	api.decode(api.request(user, http.MethodPost, "/api/notes", body, headers...), http.StatusCreated, &created)
+	return created.Note
+}
+
+// workspace создает рабочее пространство с владельцем owner
+func (api *testAPI) workspace(owner *models.User) *models.Workspace {
+	api.t.Helper()
+	workspace := &models.Workspace{Name: "Команда"}
+	api.create(workspace)
+	api.member(workspace, owner, models.WorkspaceRoleOwner)
+	return workspace
+}
+
+// member добавляет пользователя в рабочее пространство с ролью role
+func (api *testAPI) member(workspace *models.Workspace, user *models.User, role string) {
+	api.t.Helper()
+	api.create(&models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: user.ID, Role: role})
+}
+
+// share открывает пользователю доступ к заметке с ролью role
+func (api *testAPI) share(note models.Note, user *models.User, role string) {
+	api.t.Helper()
+	api.create(&models.NoteShare{NoteID: note.ID, UserID: user.ID, Role: role, SharedByID: note.UserID})
+}
+
+// note загружает заметку из базы, включая удаленные в корзину
+func (api *testAPI) note(id uint) models.Note {
+	api.t.Helper()
+	var note models.Note
+	require.NoError(api.t, api.DB.Unscoped().First(&note, id).Error)
+	return note
+}
+
+// workspaceHeader возвращает заголовок, выбирающий рабочее пространство запроса
+func workspaceHeader(workspace *models.Workspace) []string {
+	return []string{"X-Workspace-ID", strconv.FormatUint(uint64(workspace.ID), 10)}
+}
+
+// ---------------------------------------------------------------------------
+// Хранилище
+
+// memColumn — столбец таблицы в памяти
+type memColumn struct {
+	name          string
+	defaultValue  interface{}
+	autoIncrement bool
+}
+
+// memIndex — уникальный индекс; where задает условие частичного индекса
+type memIndex struct {
+	name    string
+	columns []string
+	where   sqlExpr
+}
+
+// memTable — таблица в памяти; строки хранят значения в порядке столбцов
+type memTable struct {
+	name    string
+	columns []memColumn
+	indexes []memIndex
+	rows    [][]interface{}
+	serial  int64
+}
+
+// column возвращает номер столбца или -1
+func (t *memTable) column(name string) int {
+	for i, column := range t.columns {
+		if column.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// rowIndex возвращает номер строки row в таблице или -1. Строки изменяются на месте,
+// поэтому срез строки остается ее идентификатором.
+func (t *memTable) rowIndex(row []interface{}) int {
+	for i, other := range t.rows {
+		if &other[0] == &row[0] {
+			return i
+		}
+	}
+	return -1
+}
+
+// memStore — база в памяти. Транзакции не изолированы друг от друга: изменения сразу
+// видны всем соединениям, а откат отменяет только изменения своей транзакции.
+type memStore struct {
+	mu     sync.Mutex
+	tables map[string]*memTable
+}
+
+// undoEntry отменяет одно изменение строки: вставку (old и index не заданы),
+// обновление (old — прежние значения) или удаление (index — прежнее место строки)
+type undoEntry struct {
+	table *memTable
+	row   []interface{}
+	old   []interface{}
+	index int
+}
+
+func (u undoEntry) apply() {
+	current := u.table.rowIndex(u.row)
+	switch {
+	case u.old != nil:
+		copy(u.row, u.old)
+	case u.index >= 0:
+		if current < 0 {
+			index := u.index
+			if index > len(u.table.rows) {
+				index = len(u.table.rows)
+			}
+			u.table.rows = append(u.table.rows[:index], append([][]interface{}{u.row}, u.table.rows[index:]...)...)
+		}
+	case current >= 0:
+		u.table.rows = append(u.table.rows[:current], u.table.rows[current+1:]...)
+	}
+}
+
+// savepointMark — точка сохранения: длина журнала отмены в момент ее создания
+type savepointMark struct {
+	name string
+	undo int
+}
+
+// newMemStore создает таблицы моделей и их таблиц связей многие-ко-многим
+func newMemStore(values []interface{}) (*memStore, error) {
+	store := &memStore{tables: map[string]*memTable{}}
+	cache := &sync.Map{}
+	namer := schema.NamingStrategy{}
+	for _, value := range values {
+		s, err := schema.Parse(value, cache, namer)
+		if err != nil {
+			return nil, err
+		}
+		if err := store.addSchema(s); err != nil {
+			return nil, err
+		}
+		for _, rel := range s.Relationships.Relations {
+			if rel.JoinTable != nil {
+				if err := store.addSchema(rel.JoinTable); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return store, nil
+}
+
+func (s *memStore) addSchema(sch *schema.Schema) error {
+	if _, exists := s.tables[sch.Table]; exists {
+		return nil
+	}
+	table := &memTable{name: sch.Table}
+	for _, name := range sch.DBNames {
+		field := sch.FieldsByDBName[name]
+		column := memColumn{name: name, autoIncrement: field.AutoIncrement}
+		if field.DefaultValueInterface != nil {
+			column.defaultValue = normalizeValue(field.DefaultValueInterface)
+		}
+		table.columns = append(table.columns, column)
+		if field.Unique {
+			table.indexes = append(table.indexes, memIndex{name: sch.Table + "_" + name + "_key", columns: []string{name}})
+		}
+	}
+
+	var primary []string
+	for _, field := range sch.PrimaryFields {
+		primary = append(primary, field.DBName)
+	}
+	if len(primary) > 0 {
+		table.indexes = append(table.indexes, memIndex{name: sch.Table + "_pkey", columns: primary})
+	}
+
+	for _, index := range sch.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		unique := memIndex{name: index.Name}
+		for _, option := range index.Fields {
+			unique.columns = append(unique.columns, option.DBName)
+		}
+		if index.Where != "" {
+			where, err := parseSQLExpr(index.Where)
+			if err != nil {
+				return fmt.Errorf("индекс %s: %w", index.Name, err)
+			}
+			unique.where = where
+		}
+		table.indexes = append(table.indexes, unique)
+	}
+	s.tables[sch.Table] = table
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Драйвер database/sql
+
+type memConnector struct {
+	store *memStore
+}
+
+func (c memConnector) Connect(context.Context) (driver.Conn, error) {
+	return &memConn{store: c.store}, nil
+}
+
+func (c memConnector) Driver() driver.Driver { return memDriver{} }
+
+type memDriver struct{}
+
+func (memDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("тестовая база открывается через memConnector")
+}
+
+// memConn — соединение с базой; в транзакции оно ведет журнал отмены изменений
+type memConn struct {
+	store      *memStore
+	inTx       bool
+	undo       []undoEntry
+	savepoints []savepointMark
+}
+
+func (c *memConn) Prepare(query string) (driver.Stmt, error) {
+	return &memStmt{conn: c, query: query}, nil
+}
+
+func (c *memConn) Close() error { return nil }
+
+func (c *memConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *memConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	if c.inTx {
+		return nil, errors.New("транзакция уже начата")
+	}
+	c.inTx = true
+	return &memTx{conn: c}, nil
+}
+
+// rollbackTo отменяет изменения журнала после позиции mark
+func (c *memConn) rollbackTo(mark int) {
+	for i := len(c.undo) - 1; i >= mark; i-- {
+		c.undo[i].apply()
+	}
+	c.undo = c.undo[:mark]
+}
+
+// endTx завершает транзакцию, отменяя ее изменения, если commit равен false
+func (c *memConn) endTx(commit bool) error {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	if !c.inTx {
+		return errors.New("транзакция не начата")
+	}
+	if !commit {
+		c.rollbackTo(0)
+	}
+	c.inTx, c.undo, c.savepoints = false, nil, nil
+	return nil
+}
+
+// CheckNamedValue принимает значения, уже приведенные database/sql
+func (c *memConn) CheckNamedValue(value *driver.NamedValue) error {
+	converted, err := driver.DefaultParameterConverter.ConvertValue(value.Value)
+	if err != nil {
+		return err
+	}
+	value.Value = converted
+	return nil
+}
+
+func (c *memConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &memRows{columns: result.columns, rows: result.rows}, nil
+}
+
+func (c *memConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.affected), nil
+}
+
+func (c *memConn) exec(query string, args []driver.NamedValue) (*queryResult, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = normalizeValue(arg.Value)
+	}
+
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+
+	if result, handled, err := c.savepoint(query); handled {
+		return result, err
+	}
+	stmt, err := parseSQL(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, query)
+	}
+	exec := &executor{store: c.store, args: values}
+	if c.inTx {
+		exec.undo = &c.undo
+	}
+	result, err := exec.run(stmt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, query)
+	}
+	return result, nil
+}
+
+// savepoint выполняет команды точек сохранения, которые GORM использует во вложенных транзакциях
+func (c *memConn) savepoint(query string) (*queryResult, bool, error) {
+	fields := strings.Fields(strings.ReplaceAll(query, `"`, ""))
+	var name string
+	switch {
+	case len(fields) == 2 && strings.EqualFold(fields[0], "SAVEPOINT"):
+		c.savepoints = append(c.savepoints, savepointMark{name: fields[1], undo: len(c.undo)})
+		return &queryResult{}, true, nil
+	case len(fields) == 3 && strings.EqualFold(fields[0], "RELEASE"):
+		name = fields[2]
+	case len(fields) == 4 && strings.EqualFold(fields[0], "ROLLBACK"):
+		name = fields[3]
+	default:
+		return nil, false, nil
+	}
+
+	for i := len(c.savepoints) - 1; i >= 0; i-- {
+		if c.savepoints[i].name != name {
+			continue
+		}
+		if strings.EqualFold(fields[0], "ROLLBACK") {
+			// После отката к точке сохранения она продолжает действовать
+			c.rollbackTo(c.savepoints[i].undo)
+			c.savepoints = c.savepoints[:i+1]
+		} else {
+			c.savepoints = c.savepoints[:i]
+		}
+		return &queryResult{}, true, nil
+	}
+	return nil, true, fmt.Errorf("нет точки сохранения %q", name)
+}
+
+type memTx struct {
+	conn *memConn
+}
+
+func (tx *memTx) Commit() error   { return tx.conn.endTx(true) }
+func (tx *memTx) Rollback() error { return tx.conn.endTx(false) }
+
+type memStmt struct {
+	conn  *memConn
+	query string
+}
+
+func (s *memStmt) Close() error  { return nil }
+func (s *memStmt) NumInput() int { return -1 }
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type memRows struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func (r *memRows) Columns() []string { return r.columns }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	for i, value := range r.rows[0] {
+		dest[i] = driverValue(value)
+	}
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// driverValue приводит значения выражений, которых нет в database/sql, к строке
+func driverValue(value interface{}) driver.Value {
+	switch v := value.(type) {
+	case tsVector:
+		return v.title + " " + v.content
+	case *tsQuery:
+		return v.String()
+	}
+	return value
+}
+
+// normalizeValue приводит числа к int64 и float64, а текст в байтах — к строке
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		return v.UTC()
+	}
+	return value
+}
+
+// ---------------------------------------------------------------------------
+// Лексер
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuoted
+	tokNumber
+	tokString
+	tokParam
+	tokOp
+)
+
+type sqlToken struct {
+	kind tokenKind
+	text string
+}
+
+func lexSQL(input string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(input)
+	params := 0
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokIdent, string(runes[start:i])})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokNumber, string(runes[start:i])})
+		case r == '"' || r == '\'':
+			var text strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, errors.New("незакрытая строка")
+				}
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						text.WriteRune(r)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				text.WriteRune(runes[i])
+				i++
+			}
+			kind := tokString
+			if r == '"' {
+				kind = tokQuoted
+			}
+			tokens = append(tokens, sqlToken{kind, text.String()})
+		case r == '$' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			start := i + 1
+			i++
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{tokParam, string(runes[start:i])})
+		case r == '?':
+			params++
+			tokens = append(tokens, sqlToken{tokParam, strconv.Itoa(params)})
+			i++
+		default:
+			op := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "<>", "<=", ">=", "!=", "||", "&&", "@@", "::":
+					op = two
+				}
+			}
+			if !strings.Contains("=<>!|&@:+-*/(),.;%", op[:1]) {
+				return nil, fmt.Errorf("неожиданный символ %q", r)
+			}
+			tokens = append(tokens, sqlToken{tokOp, op})
+			i += len([]rune(op))
+		}
+	}
+	return append(tokens, sqlToken{kind: tokEOF}), nil
+}
+
+// ---------------------------------------------------------------------------
+// Синтаксическое дерево
+
+type sqlExpr interface{}
+
+type (
+	litExpr    struct{ value interface{} }
+	paramExpr  struct{ index int }
+	columnExpr struct{ table, name string }
+	starExpr   struct{ table string }
+	unaryExpr  struct {
+		op string
+		x  sqlExpr
+	}
+	binaryExpr struct {
+		op   string
+		l, r sqlExpr
+	}
+	isExpr struct {
+		x        sqlExpr
+		not      bool
+		distinct sqlExpr // IS [NOT] DISTINCT FROM; nil — IS [NOT] NULL
+	}
+	inExpr struct {
+		x    sqlExpr
+		not  bool
+		list []sqlExpr
+		sub  *selectStmt
+	}
+	likeExpr struct {
+		x, pattern      sqlExpr
+		not, ignoreCase bool
+	}
+	betweenExpr struct {
+		x, low, high sqlExpr
+		not          bool
+	}
+	existsExpr   struct{ sub *selectStmt }
+	subqueryExpr struct{ sub *selectStmt }
+	funcExpr     struct {
+		name     string
+		args     []sqlExpr
+		distinct bool
+		star     bool
+	}
+	caseExpr struct {
+		operand sqlExpr
+		whens   [][2]sqlExpr
+		orElse  sqlExpr
+	}
+)
+
+type selectColumn struct {
+	expr  sqlExpr
+	alias string
+}
+
+type fromItem struct {
+	table string
+	alias string
+	sub   *selectStmt
+}
+
+type joinItem struct {
+	left bool
+	item fromItem
+	on   sqlExpr
+}
+
+type orderItem struct {
+	expr       sqlExpr
+	desc       bool
+	nullsFirst *bool
+}
+
+type cteItem struct {
+	name    string
+	columns []string
+	query   *selectStmt
+}
+
+type selectStmt struct {
+	with       []cteItem
+	recursive  bool
+	distinct   bool
+	distinctOn []sqlExpr
+	columns    []selectColumn
+	from       []fromItem
+	joins      []joinItem
+	where      sqlExpr
+	groupBy    []sqlExpr
+	having     sqlExpr
+	orderBy    []orderItem
+	limit      sqlExpr
+	offset     sqlExpr
+	union      *selectStmt
+	unionAll   bool
+}
+
+type assignment struct {
+	column string
+	expr   sqlExpr
+}
+
+type insertStmt struct {
+	table      string
+	columns    []string
+	values     [][]sqlExpr
+	query      *selectStmt
+	conflict   bool
+	conflictOn []string
+	updates    []assignment
+	returning  []selectColumn
+}
+
+type updateStmt struct {
+	table     string
+	alias     string
+	sets      []assignment
+	where     sqlExpr
+	returning []selectColumn
+}
+
+type deleteStmt struct {
+	table     string
+	alias     string
+	where     sqlExpr
+	returning []selectColumn
+}
+
+// ---------------------------------------------------------------------------
+// Парсер
+
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func parseSQL(input string) (interface{}, error) {
+	tokens, err := lexSQL(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+	var stmt interface{}
+	switch {
+	case p.isKeyword("SELECT"), p.isKeyword("WITH"), p.isOp("("):
+		stmt, err = p.parseSelect()
+	case p.isKeyword("INSERT"):
+		stmt, err = p.parseInsert()
+	case p.isKeyword("UPDATE"):
+		stmt, err = p.parseUpdate()
+	case p.isKeyword("DELETE"):
+		stmt, err = p.parseDelete()
+	default:
+		return nil, fmt.Errorf("неподдерживаемый запрос")
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.acceptOp(";")
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("лишний текст после запроса: %q", p.peek().text)
+	}
+	return stmt, nil
+}
+
+func parseSQLExpr(input string) (sqlExpr, error) {
+	tokens, err := lexSQL(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("лишний текст после выражения: %q", p.peek().text)
+	}
+	return expr, nil
+}
+
+func (p *sqlParser) peek() sqlToken { return p.tokens[p.pos] }
+
+func (p *sqlParser) peekAt(offset int) sqlToken {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return sqlToken{kind: tokEOF}
+}
+
+func (p *sqlParser) next() sqlToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *sqlParser) isKeyword(words ...string) bool {
+	for i, word := range words {
+		token := p.peekAt(i)
+		if token.kind != tokIdent || !strings.EqualFold(token.text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *sqlParser) acceptKeyword(words ...string) bool {
+	if !p.isKeyword(words...) {
+		return false
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *sqlParser) expectKeyword(words ...string) error {
+	if !p.acceptKeyword(words...) {
+		return fmt.Errorf("ожидается %s, получено %q", strings.Join(words, " "), p.peek().text)
+	}
+	return nil
+}
+
+func (p *sqlParser) isOp(op string) bool {
+	token := p.peek()
+	return token.kind == tokOp && token.text == op
+}
+
+func (p *sqlParser) acceptOp(op string) bool {
+	if !p.isOp(op) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *sqlParser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		return fmt.Errorf("ожидается %q, получено %q", op, p.peek().text)
+	}
+	return nil
+}
+
+// reserved — слова, которые не могут быть псевдонимом без AS
+var reserved = map[string]bool{
+	"FROM": true, "WHERE": true, "JOIN": true, "LEFT": true, "INNER": true, "ON": true,
+	"GROUP": true, "ORDER": true, "HAVING": true, "LIMIT": true, "OFFSET": true, "UNION": true,
+	"FOR": true, "SET": true, "RETURNING": true, "AND": true, "OR": true, "AS": true,
+	"VALUES": true, "SELECT": true, "ASC": true, "DESC": true, "NULLS": true, "USING": true,
+	"CROSS": true, "RIGHT": true, "FULL": true, "OUTER": true, "ESCAPE": true,
+}
+
+func (p *sqlParser) identifier() (string, error) {
+	token := p.next()
+	switch token.kind {
+	case tokIdent:
+		return strings.ToLower(token.text), nil
+	case tokQuoted:
+		return token.text, nil
+	}
+	return "", fmt.Errorf("ожидается идентификатор, получено %q", token.text)
+}
+
+// alias читает необязательный псевдоним таблицы или столбца
+func (p *sqlParser) alias() (string, error) {
+	if p.acceptKeyword("AS") {
+		return p.identifier()
+	}
+	token := p.peek()
+	if token.kind == tokQuoted || (token.kind == tokIdent && !reserved[strings.ToUpper(token.text)]) {
+		return p.identifier()
+	}
+	return "", nil
+}
+
+func (p *sqlParser) identifierList() ([]string, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptOp(",") {
+			break
+		}
+	}
+	return names, p.expectOp(")")
+}
+
+func (p *sqlParser) parseSelect() (*selectStmt, error) {
+	var with []cteItem
+	recursive := false
+	if p.acceptKeyword("WITH") {
+		recursive = p.acceptKeyword("RECURSIVE")
+		for {
+			name, err := p.identifier()
+			if err != nil {
+				return nil, err
+			}
+			cte := cteItem{name: name}
+			if p.isOp("(") {
+				if cte.columns, err = p.identifierList(); err != nil {
+					return nil, err
+				}
+			}
+			if err := p.expectKeyword("AS"); err != nil {
+				return nil, err
+			}
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			if cte.query, err = p.parseSelect(); err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			with = append(with, cte)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	stmt, err := p.parseSelectCore()
+	if err != nil {
+		return nil, err
+	}
+	stmt.with, stmt.recursive = with, recursive
+
+	if p.acceptKeyword("UNION") {
+		stmt.unionAll = p.acceptKeyword("ALL")
+		if stmt.union, err = p.parseSelectCore(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("ORDER", "BY") {
+		for {
+			item := orderItem{}
+			if item.expr, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("DESC") {
+				item.desc = true
+			} else {
+				p.acceptKeyword("ASC")
+			}
+			if p.acceptKeyword("NULLS") {
+				first := p.acceptKeyword("FIRST")
+				if !first {
+					if err := p.expectKeyword("LAST"); err != nil {
+						return nil, err
+					}
+				}
+				item.nullsFirst = &first
+			}
+			stmt.orderBy = append(stmt.orderBy, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+	for {
+		switch {
+		case p.acceptKeyword("LIMIT"):
+			if stmt.limit, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("OFFSET"):
+			if stmt.offset, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("FOR"):
+			// Блокировки строк не нужны: запросы к базе в памяти выполняются по очереди
+			for p.acceptKeyword("UPDATE") || p.acceptKeyword("SHARE") || p.acceptKeyword("NOWAIT") ||
+				p.acceptKeyword("SKIP", "LOCKED") || p.acceptKeyword("NO", "KEY") {
+			}
+		default:
+			return stmt, nil
+		}
+	}
+}
+
+func (p *sqlParser) parseSelectCore() (*selectStmt, error) {
+	if p.acceptOp("(") {
+		stmt, err := p.parseSelect()
+		if err != nil {
+			return nil, err
+		}
+		return stmt, p.expectOp(")")
+	}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	stmt := &selectStmt{}
+	if p.acceptKeyword("DISTINCT") {
+		stmt.distinct = true
+		if p.acceptKeyword("ON") {
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			list, err := p.exprList()
+			if err != nil {
+				return nil, err
+			}
+			stmt.distinctOn = list
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	columns, err := p.selectColumns()
+	if err != nil {
+		return nil, err
+	}
+	stmt.columns = columns
+
+	if p.acceptKeyword("FROM") {
+		for {
+			item, err := p.fromItem()
+			if err != nil {
+				return nil, err
+			}
+			stmt.from = append(stmt.from, item)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+		for {
+			join := joinItem{}
+			switch {
+			case p.acceptKeyword("LEFT", "OUTER", "JOIN"), p.acceptKeyword("LEFT", "JOIN"):
+				join.left = true
+			case p.acceptKeyword("INNER", "JOIN"), p.acceptKeyword("JOIN"):
+			default:
+				goto joined
+			}
+			if join.item, err = p.fromItem(); err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("ON"); err != nil {
+				return nil, err
+			}
+			if join.on, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			stmt.joins = append(stmt.joins, join)
+		}
+	}
+joined:
+	if p.acceptKeyword("WHERE") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("GROUP", "BY") {
+		if stmt.groupBy, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		if stmt.having, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *sqlParser) selectColumns() ([]selectColumn, error) {
+	var columns []selectColumn
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		column := selectColumn{expr: expr}
+		if column.alias, err = p.alias(); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+		if !p.acceptOp(",") {
+			return columns, nil
+		}
+	}
+}
+
+func (p *sqlParser) fromItem() (fromItem, error) {
+	item := fromItem{}
+	var err error
+	if p.acceptOp("(") {
+		if item.sub, err = p.parseSelect(); err != nil {
+			return item, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return item, err
+		}
+	} else if item.table, err = p.identifier(); err != nil {
+		return item, err
+	}
+	item.alias, err = p.alias()
+	return item, err
+}
+
+func (p *sqlParser) exprList() ([]sqlExpr, error) {
+	var list []sqlExpr
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if !p.acceptOp(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *sqlParser) returning() ([]selectColumn, error) {
+	if !p.acceptKeyword("RETURNING") {
+		return nil, nil
+	}
+	return p.selectColumns()
+}
+
+func (p *sqlParser) parseInsert() (*insertStmt, error) {
+	if err := p.expectKeyword("INSERT", "INTO"); err != nil {
+		return nil, err
+	}
+	stmt := &insertStmt{}
+	var err error
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if p.isOp("(") {
+		if stmt.columns, err = p.identifierList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("VALUES") {
+		for {
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			row, err := p.exprList()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			stmt.values = append(stmt.values, row)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	} else if stmt.query, err = p.parseSelect(); err != nil {
+		return nil, err
+	}
+
+	if p.acceptKeyword("ON", "CONFLICT") {
+		stmt.conflict = true
+		if p.isOp("(") {
+			if stmt.conflictOn, err = p.identifierList(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectKeyword("DO"); err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("NOTHING") {
+			if err := p.expectKeyword("UPDATE", "SET"); err != nil {
+				return nil, err
+			}
+			if stmt.updates, err = p.assignments(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	stmt.returning, err = p.returning()
+	return stmt, err
+}
+
+func (p *sqlParser) assignments() ([]assignment, error) {
+	var sets []assignment
+	for {
+		column, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		// Столбец может быть указан с именем таблицы
+		if p.acceptOp(".") {
+			if column, err = p.identifier(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectOp("="); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, assignment{column: column, expr: expr})
+		if !p.acceptOp(",") {
+			return sets, nil
+		}
+	}
+}
+
+func (p *sqlParser) parseUpdate() (*updateStmt, error) {
+	p.next()
+	stmt := &updateStmt{}
+	var err error
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if stmt.alias, err = p.alias(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	if stmt.sets, err = p.assignments(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	stmt.returning, err = p.returning()
+	return stmt, err
+}
+
+func (p *sqlParser) parseDelete() (*deleteStmt, error) {
+	if err := p.expectKeyword("DELETE", "FROM"); err != nil {
+		return nil, err
+	}
+	stmt := &deleteStmt{}
+	var err error
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if stmt.alias, err = p.alias(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	stmt.returning, err = p.returning()
+	return stmt, err
+}
+
+// parseExpr разбирает выражение с приоритетами PostgreSQL:
+// OR < AND < NOT < сравнения, IS, IN, LIKE < прочие операторы < + - < * / < унарный минус
+func (p *sqlParser) parseExpr() (sqlExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "OR", l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (sqlExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "AND", l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (sqlExpr, error) {
+	if p.acceptKeyword("NOT") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "NOT", x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *sqlParser) parseComparison() (sqlExpr, error) {
+	left, err := p.parseOther()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := p.peek()
+		switch {
+		case token.kind == tokOp && (token.text == "=" || token.text == "<>" || token.text == "!=" ||
+			token.text == "<" || token.text == "<=" || token.text == ">" || token.text == ">="):
+			p.next()
+			right, err := p.parseOther()
+			if err != nil {
+				return nil, err
+			}
+			op := token.text
+			if op == "!=" {
+				op = "<>"
+			}
+			left = &binaryExpr{op: op, l: left, r: right}
+		case p.isKeyword("IS"):
+			p.next()
+			is := &isExpr{x: left, not: p.acceptKeyword("NOT")}
+			switch {
+			case p.acceptKeyword("NULL"):
+			case p.acceptKeyword("DISTINCT", "FROM"):
+				if is.distinct, err = p.parseOther(); err != nil {
+					return nil, err
+				}
+			case p.acceptKeyword("TRUE"):
+				is.distinct = &litExpr{value: true}
+				is.not = !is.not
+			case p.acceptKeyword("FALSE"):
+				is.distinct = &litExpr{value: false}
+				is.not = !is.not
+			default:
+				return nil, fmt.Errorf("неподдерживаемое выражение IS %q", p.peek().text)
+			}
+			left = is
+		case p.isKeyword("NOT", "IN"), p.isKeyword("IN"):
+			in := &inExpr{x: left, not: p.acceptKeyword("NOT")}
+			p.next()
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			if p.isKeyword("SELECT") || p.isKeyword("WITH") {
+				if in.sub, err = p.parseSelect(); err != nil {
+					return nil, err
+				}
+			} else if in.list, err = p.exprList(); err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			left = in
+		case p.isKeyword("NOT", "LIKE"), p.isKeyword("NOT", "ILIKE"), p.isKeyword("LIKE"), p.isKeyword("ILIKE"):
+			like := &likeExpr{x: left, not: p.acceptKeyword("NOT")}
+			like.ignoreCase = strings.EqualFold(p.next().text, "ILIKE")
+			if like.pattern, err = p.parseOther(); err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("ESCAPE") {
+				if escape := p.next(); escape.kind != tokString || escape.text != `\` {
+					return nil, errors.New("поддерживается только ESCAPE '\\'")
+				}
+			}
+			left = like
+		case p.isKeyword("NOT", "BETWEEN"), p.isKeyword("BETWEEN"):
+			between := &betweenExpr{x: left, not: p.acceptKeyword("NOT")}
+			p.next()
+			if between.low, err = p.parseOther(); err != nil {
+				return nil, err
+			}
+			if err := p.expectKeyword("AND"); err != nil {
+				return nil, err
+			}
+			if between.high, err = p.parseOther(); err != nil {
+				return nil, err
+			}
+			left = between
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *sqlParser) parseOther() (sqlExpr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||") || p.isOp("&&") || p.isOp("@@") {
+		op := p.next().text
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseAdditive() (sqlExpr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseMultiplicative() (sqlExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		op := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *sqlParser) parseUnary() (sqlExpr, error) {
+	if p.acceptOp("-") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{op: "-", x: x}, nil
+	}
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	// Приведения типов не влияют на значения в памяти
+	for p.acceptOp("::") {
+		if _, err := p.identifier(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("COLLATE") {
+		p.next()
+	}
+	return x, nil
+}
+
+func (p *sqlParser) parsePrimary() (sqlExpr, error) {
+	token := p.peek()
+	switch token.kind {
+	case tokNumber:
+		p.next()
+		if strings.Contains(token.text, ".") {
+			value, err := strconv.ParseFloat(token.text, 64)
+			return &litExpr{value: value}, err
+		}
+		value, err := strconv.ParseInt(token.text, 10, 64)
+		return &litExpr{value: value}, err
+	case tokString:
+		p.next()
+		return &litExpr{value: token.text}, nil
+	case tokParam:
+		p.next()
+		index, _ := strconv.Atoi(token.text)
+		return &paramExpr{index: index - 1}, nil
+	case tokOp:
+		switch token.text {
+		case "*":
+			p.next()
+			return &starExpr{}, nil
+		case "(":
+			p.next()
+			if p.isKeyword("SELECT") || p.isKeyword("WITH") {
+				sub, err := p.parseSelect()
+				if err != nil {
+					return nil, err
+				}
+				return &subqueryExpr{sub: sub}, p.expectOp(")")
+			}
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expectOp(")")
+		}
+		return nil, fmt.Errorf("неожиданный оператор %q", token.text)
+	case tokEOF:
+		return nil, errors.New("неожиданный конец выражения")
+	}
+
+	if token.kind == tokIdent {
+		switch strings.ToUpper(token.text) {
+		case "NULL":
+			p.next()
+			return &litExpr{}, nil
+		case "TRUE":
+			p.next()
+			return &litExpr{value: true}, nil
+		case "FALSE":
+			p.next()
+			return &litExpr{value: false}, nil
+		case "EXISTS":
+			p.next()
+			if err := p.expectOp("("); err != nil {
+				return nil, err
+			}
+			sub, err := p.parseSelect()
+			if err != nil {
+				return nil, err
+			}
+			return &existsExpr{sub: sub}, p.expectOp(")")
+		case "CASE":
+			return p.parseCase()
+		}
+	}
+
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptOp("(") {
+		return p.parseCall(name)
+	}
+	if p.acceptOp(".") {
+		if p.acceptOp("*") {
+			return &starExpr{table: name}, nil
+		}
+		column, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		return &columnExpr{table: name, name: column}, nil
+	}
+	return &columnExpr{name: name}, nil
+}
+
+func (p *sqlParser) parseCall(name string) (sqlExpr, error) {
+	call := &funcExpr{name: strings.ToLower(name)}
+	if p.acceptOp(")") {
+		return call, nil
+	}
+	if p.acceptOp("*") {
+		call.star = true
+		return call, p.expectOp(")")
+	}
+	call.distinct = p.acceptKeyword("DISTINCT")
+	args, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	call.args = args
+	return call, p.expectOp(")")
+}
+
+func (p *sqlParser) parseCase() (sqlExpr, error) {
+	p.next()
+	expr := &caseExpr{}
+	var err error
+	if !p.isKeyword("WHEN") {
+		if expr.operand, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	for p.acceptKeyword("WHEN") {
+		var when [2]sqlExpr
+		if when[0], err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if when[1], err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		expr.whens = append(expr.whens, when)
+	}
+	if p.acceptKeyword("ELSE") {
+		if expr.orElse, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return expr, p.expectKeyword("END")
+}
+
+// ---------------------------------------------------------------------------
+// Выполнение
+
+// queryResult — результат запроса: строки для SELECT и RETURNING и число затронутых строк
+type queryResult struct {
+	columns  []string
+	rows     [][]interface{}
+	affected int64
+}
+
+// boundSource — строка одного источника запроса (таблицы, подзапроса или CTE)
+type boundSource struct {
+	name    string
+	table   *memTable
+	columns []string
+	values  []interface{}
+}
+
+// rowScope — строка, над которой вычисляются выражения; parent — строка внешнего запроса
+type rowScope struct {
+	sources []boundSource
+	parent  *rowScope
+	// group — строки группы для агрегатных функций
+	group []*rowScope
+	// output — значения столбцов результата для ORDER BY по псевдониму
+	output map[string]interface{}
+}
+
+type executor struct {
+	store *memStore
+	args  []interface{}
+	ctes  []map[string]*queryResult
+	// undo — журнал отмены транзакции; вне транзакции nil
+	undo *[]undoEntry
+}
+
+func (e *executor) logUndo(entry undoEntry) {
+	if e.undo != nil {
+		*e.undo = append(*e.undo, entry)
+	}
+}
+
+// replaceRow записывает в строку новые значения на месте
+func (e *executor) replaceRow(table *memTable, row, values []interface{}) {
+	e.logUndo(undoEntry{table: table, row: row, old: append([]interface{}(nil), row...), index: -1})
+	copy(row, values)
+}
+
+func (e *executor) run(stmt interface{}) (*queryResult, error) {
+	switch stmt := stmt.(type) {
+	case *selectStmt:
+		return e.selectRows(stmt, nil)
+	case *insertStmt:
+		return e.insert(stmt)
+	case *updateStmt:
+		return e.update(stmt)
+	case *deleteStmt:
+		return e.delete(stmt)
+	}
+	return nil, fmt.Errorf("неподдерживаемый запрос %T", stmt)
+}
+
+func (e *executor) table(name string) (*memTable, error) {
+	table, ok := e.store.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("таблица %q не существует", name)
+	}
+	return table, nil
+}
+
+func (e *executor) cte(name string) *queryResult {
+	for i := len(e.ctes) - 1; i >= 0; i-- {
+		if result, ok := e.ctes[i][name]; ok {
+			return result
+		}
+	}
+	return nil
+}
+
+// visibleColumns — столбцы таблицы, которые видны запросам: хранимые и вычисляемые
+func visibleColumns(table *memTable) []string {
+	columns := make([]string, 0, len(table.columns)+1)
+	for _, column := range table.columns {
+		columns = append(columns, column.name)
+	}
+	if table.name == "notes" {
+		columns = append(columns, "search_vector")
+	}
+	return columns
+}
+
+// tableRow возвращает строку таблицы со значениями вычисляемых столбцов
+func tableRow(table *memTable, row []interface{}) []interface{} {
+	if table.name != "notes" {
+		return row
+	}
+	title, _ := row[table.column("title")].(string)
+	content, _ := row[table.column("content")].(string)
+	return append(append([]interface{}(nil), row...), tsVector{title: title, content: content})
+}
+
+// sourceRows возвращает строки элемента FROM
+func (e *executor) sourceRows(item fromItem, parent *rowScope) ([]boundSource, error) {
+	name := item.alias
+	if item.sub != nil {
+		result, err := e.selectRows(item.sub, parent)
+		if err != nil {
+			return nil, err
+		}
+		return resultSources(name, result), nil
+	}
+	if name == "" {
+		name = item.table
+	}
+	if result := e.cte(item.table); result != nil {
+		return resultSources(name, result), nil
+	}
+	table, err := e.table(item.table)
+	if err != nil {
+		return nil, err
+	}
+	columns := visibleColumns(table)
+	rows := make([]boundSource, len(table.rows))
+	for i, row := range table.rows {
+		rows[i] = boundSource{name: name, table: table, columns: columns, values: tableRow(table, row)}
+	}
+	return rows, nil
+}
+
+func resultSources(name string, result *queryResult) []boundSource {
+	rows := make([]boundSource, len(result.rows))
+	for i, row := range result.rows {
+		rows[i] = boundSource{name: name, columns: result.columns, values: row}
+	}
+	return rows
+}
+
+// emptySource — строка LEFT JOIN без совпадения: все столбцы равны NULL
+func emptySource(sample boundSource) boundSource {
+	return boundSource{name: sample.name, table: sample.table, columns: sample.columns, values: make([]interface{}, len(sample.columns))}
+}
+
+func (e *executor) joinedRows(stmt *selectStmt, parent *rowScope) ([]*rowScope, error) {
+	scopes := []*rowScope{{parent: parent}}
+	for _, item := range stmt.from {
+		rows, err := e.sourceRows(item, parent)
+		if err != nil {
+			return nil, err
+		}
+		var next []*rowScope
+		for _, scope := range scopes {
+			for _, row := range rows {
+				next = append(next, &rowScope{sources: append(append([]boundSource(nil), scope.sources...), row), parent: parent})
+			}
+		}
+		scopes = next
+	}
+
+	for _, join := range stmt.joins {
+		rows, err := e.sourceRows(join.item, parent)
+		if err != nil {
+			return nil, err
+		}
+		var template boundSource
+		if join.left {
+			template, err = e.joinTemplate(join.item, rows)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var next []*rowScope
+		for _, scope := range scopes {
+			matched := false
+			for _, row := range rows {
+				candidate := &rowScope{sources: append(append([]boundSource(nil), scope.sources...), row), parent: parent}
+				ok, err := e.truth(join.on, candidate)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					matched = true
+					next = append(next, candidate)
+				}
+			}
+			if !matched && join.left {
+				next = append(next, &rowScope{sources: append(append([]boundSource(nil), scope.sources...), emptySource(template)), parent: parent})
+			}
+		}
+		scopes = next
+	}
+	return scopes, nil
+}
+
+// joinTemplate описывает столбцы присоединяемого источника, даже если в нем нет строк
+func (e *executor) joinTemplate(item fromItem, rows []boundSource) (boundSource, error) {
+	if len(rows) > 0 {
+		return rows[0], nil
+	}
+	name := item.alias
+	if name == "" {
+		name = item.table
+	}
+	if item.sub == nil && e.cte(item.table) == nil {
+		table, err := e.table(item.table)
+		if err != nil {
+			return boundSource{}, err
+		}
+		return boundSource{name: name, table: table, columns: visibleColumns(table)}, nil
+	}
+	var result *queryResult
+	if item.sub != nil {
+		var err error
+		if result, err = e.selectRows(item.sub, nil); err != nil {
+			return boundSource{}, err
+		}
+	} else {
+		result = e.cte(item.table)
+	}
+	return boundSource{name: name, columns: result.columns}, nil
+}
+
+func (e *executor) selectRows(stmt *selectStmt, parent *rowScope) (*queryResult, error) {
+	if len(stmt.with) > 0 {
+		ctes := map[string]*queryResult{}
+		e.ctes = append(e.ctes, ctes)
+		defer func() { e.ctes = e.ctes[:len(e.ctes)-1] }()
+		for _, cte := range stmt.with {
+			result, err := e.cteRows(cte, stmt.recursive, ctes, parent)
+			if err != nil {
+				return nil, err
+			}
+			ctes[cte.name] = result
+		}
+	}
+
+	result, scopes, err := e.selectCore(stmt, parent)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.union != nil {
+		other, otherScopes, err := e.selectCore(stmt.union, parent)
+		if err != nil {
+			return nil, err
+		}
+		result.rows = append(result.rows, other.rows...)
+		scopes = append(scopes, otherScopes...)
+		if !stmt.unionAll {
+			result.rows, scopes = distinctRows(result.rows, scopes)
+		}
+	}
+
+	if err := e.order(stmt.orderBy, result, scopes); err != nil {
+		return nil, err
+	}
+	return result, e.limit(stmt, result)
+}
+
+// cteRows вычисляет CTE; рекурсивная часть UNION повторяется, пока появляются новые строки
+func (e *executor) cteRows(cte cteItem, recursive bool, ctes map[string]*queryResult, parent *rowScope) (*queryResult, error) {
+	rename := func(result *queryResult) *queryResult {
+		if len(cte.columns) > 0 {
+			result.columns = cte.columns
+		}
+		return result
+	}
+	if !recursive || cte.query.union == nil {
+		result, err := e.selectRows(cte.query, parent)
+		if err != nil {
+			return nil, err
+		}
+		return rename(result), nil
+	}
+
+	anchor, _, err := e.selectCore(cte.query, parent)
+	if err != nil {
+		return nil, err
+	}
+	result := rename(anchor)
+	working := &queryResult{columns: result.columns, rows: result.rows}
+	for step := 0; len(working.rows) > 0; step++ {
+		if step > 10000 {
+			return nil, fmt.Errorf("рекурсия CTE %s не завершается", cte.name)
+		}
+		ctes[cte.name] = working
+		next, _, err := e.selectCore(cte.query.union, parent)
+		if err != nil {
+			return nil, err
+		}
+		var fresh [][]interface{}
+		for _, row := range next.rows {
+			if cte.query.unionAll || !containsRow(result.rows, row) && !containsRow(fresh, row) {
+				fresh = append(fresh, row)
+			}
+		}
+		result.rows = append(result.rows, fresh...)
+		working = &queryResult{columns: result.columns, rows: fresh}
+	}
+	return result, nil
+}
+
+func containsRow(rows [][]interface{}, row []interface{}) bool {
+	key := rowKey(row)
+	for _, other := range rows {
+		if rowKey(other) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func rowKey(row []interface{}) string {
+	var key strings.Builder
+	for _, value := range row {
+		fmt.Fprintf(&key, "%T:%v|", value, value)
+	}
+	return key.String()
+}
+
+func distinctRows(rows [][]interface{}, scopes []*rowScope) ([][]interface{}, []*rowScope) {
+	seen := map[string]bool{}
+	var keptRows [][]interface{}
+	var keptScopes []*rowScope
+	for i, row := range rows {
+		key := rowKey(row)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keptRows = append(keptRows, row)
+		keptScopes = append(keptScopes, scopes[i])
+	}
+	return keptRows, keptScopes
+}
+
+// selectCore выполняет SELECT без ORDER BY и LIMIT и возвращает строки вместе с их контекстом
+func (e *executor) selectCore(stmt *selectStmt, parent *rowScope) (*queryResult, []*rowScope, error) {
+	var scopes []*rowScope
+	if len(stmt.from) == 0 {
+		scopes = []*rowScope{{parent: parent}}
+	} else {
+		var err error
+		if scopes, err = e.joinedRows(stmt, parent); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if stmt.where != nil {
+		var kept []*rowScope
+		for _, scope := range scopes {
+			ok, err := e.truth(stmt.where, scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				kept = append(kept, scope)
+			}
+		}
+		scopes = kept
+	}
+
+	if len(stmt.groupBy) > 0 || stmt.having != nil || hasAggregate(stmt) {
+		var err error
+		if scopes, err = e.group(stmt, scopes, parent); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	result := &queryResult{}
+	for i, scope := range scopes {
+		var row []interface{}
+		var columns []string
+		for _, column := range stmt.columns {
+			if star, ok := column.expr.(*starExpr); ok {
+				for _, source := range scope.sources {
+					if star.table != "" && source.name != star.table {
+						continue
+					}
+					for j, name := range source.columns {
+						if source.table != nil && name == "search_vector" {
+							continue
+						}
+						columns = append(columns, name)
+						row = append(row, source.values[j])
+					}
+				}
+				continue
+			}
+			value, err := e.eval(column.expr, scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			columns = append(columns, columnName(column))
+			row = append(row, value)
+		}
+		if i == 0 {
+			result.columns = columns
+		}
+		scope.output = map[string]interface{}{}
+		for j, name := range columns {
+			scope.output[name] = row[j]
+		}
+		result.rows = append(result.rows, row)
+	}
+	if len(scopes) == 0 {
+		result.columns = e.emptyColumns(stmt)
+	}
+
+	if stmt.distinct {
+		if len(stmt.distinctOn) == 0 {
+			result.rows, scopes = distinctRows(result.rows, scopes)
+		} else {
+			seen := map[string]bool{}
+			var rows [][]interface{}
+			var kept []*rowScope
+			for i, scope := range scopes {
+				var key []interface{}
+				for _, expr := range stmt.distinctOn {
+					value, err := e.eval(expr, scope)
+					if err != nil {
+						return nil, nil, err
+					}
+					key = append(key, value)
+				}
+				if !seen[rowKey(key)] {
+					seen[rowKey(key)] = true
+					rows = append(rows, result.rows[i])
+					kept = append(kept, scope)
+				}
+			}
+			result.rows, scopes = rows, kept
+		}
+	}
+	return result, scopes, nil
+}
+
+// emptyColumns называет столбцы пустого результата
+func (e *executor) emptyColumns(stmt *selectStmt) []string {
+	var columns []string
+	for _, column := range stmt.columns {
+		star, ok := column.expr.(*starExpr)
+		if !ok {
+			columns = append(columns, columnName(column))
+			continue
+		}
+		for _, item := range append([]fromItem(nil), stmt.from...) {
+			if star.table != "" && star.table != item.alias && star.table != item.table {
+				continue
+			}
+			if table, err := e.table(item.table); err == nil {
+				for _, column := range table.columns {
+					columns = append(columns, column.name)
+				}
+			}
+		}
+		for _, join := range stmt.joins {
+			if star.table != "" && star.table != join.item.alias && star.table != join.item.table {
+				continue
+			}
+			if table, err := e.table(join.item.table); err == nil {
+				for _, column := range table.columns {
+					columns = append(columns, column.name)
+				}
+			}
+		}
+	}
+	return columns
+}
+
+func columnName(column selectColumn) string {
+	if column.alias != "" {
+		return column.alias
+	}
+	switch expr := column.expr.(type) {
+	case *columnExpr:
+		return expr.name
+	case *funcExpr:
+		return expr.name
+	}
+	return "?column?"
+}
+
+var aggregateFuncs = map[string]bool{"count": true, "max": true, "min": true, "sum": true, "avg": true, "bool_or": true, "bool_and": true}
+
+func hasAggregate(stmt *selectStmt) bool {
+	for _, column := range stmt.columns {
+		if exprHasAggregate(column.expr) {
+			return true
+		}
+	}
+	return false
+}
+
+func exprHasAggregate(expr sqlExpr) bool {
+	switch expr := expr.(type) {
+	case *funcExpr:
+		if aggregateFuncs[expr.name] {
+			return true
+		}
+		for _, arg := range expr.args {
+			if exprHasAggregate(arg) {
+				return true
+			}
+		}
+	case *binaryExpr:
+		return exprHasAggregate(expr.l) || exprHasAggregate(expr.r)
+	case *unaryExpr:
+		return exprHasAggregate(expr.x)
+	case *caseExpr:
+		for _, when := range expr.whens {
+			if exprHasAggregate(when[0]) || exprHasAggregate(when[1]) {
+				return true
+			}
+		}
+		return exprHasAggregate(expr.orElse)
+	}
+	return false
+}
+
+// group объединяет строки по GROUP BY; без GROUP BY агрегаты дают одну строку
+func (e *executor) group(stmt *selectStmt, scopes []*rowScope, parent *rowScope) ([]*rowScope, error) {
+	var order []string
+	groups := map[string][]*rowScope{}
+	for _, scope := range scopes {
+		var key []interface{}
+		for _, expr := range stmt.groupBy {
+			value, err := e.eval(expr, scope)
+			if err != nil {
+				return nil, err
+			}
+			key = append(key, value)
+		}
+		k := rowKey(key)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], scope)
+	}
+	if len(stmt.groupBy) == 0 && len(order) == 0 {
+		order = append(order, "")
+		groups[""] = nil
+	}
+
+	var result []*rowScope
+	for _, k := range order {
+		members := groups[k]
+		grouped := &rowScope{parent: parent, group: members}
+		if len(members) > 0 {
+			grouped.sources = members[0].sources
+		}
+		if stmt.having != nil {
+			ok, err := e.truth(stmt.having, grouped)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		result = append(result, grouped)
+	}
+	return result, nil
+}
+
+func (e *executor) order(items []orderItem, result *queryResult, scopes []*rowScope) error {
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([][]interface{}, len(scopes))
+	for i, scope := range scopes {
+		for _, item := range items {
+			var value interface{}
+			var err error
+			if column, ok := item.expr.(*columnExpr); ok && column.table == "" {
+				if output, found := scope.output[column.name]; found {
+					value = output
+				} else if value, err = e.eval(item.expr, scope); err != nil {
+					return err
+				}
+			} else if literal, ok := item.expr.(*litExpr); ok {
+				// ORDER BY 1 — номер столбца результата
+				position, _ := literal.value.(int64)
+				value = result.rows[i][position-1]
+			} else if value, err = e.eval(item.expr, scope); err != nil {
+				return err
+			}
+			keys[i] = append(keys[i], value)
+		}
+	}
+
+	index := make([]int, len(scopes))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(a, b int) bool {
+		for k, item := range items {
+			x, y := keys[index[a]][k], keys[index[b]][k]
+			nullsFirst := item.desc
+			if item.nullsFirst != nil {
+				nullsFirst = *item.nullsFirst
+			}
+			switch {
+			case x == nil && y == nil:
+				continue
+			case x == nil:
+				return nullsFirst
+			case y == nil:
+				return !nullsFirst
+			}
+			c, ok := compareValues(x, y)
+			if !ok || c == 0 {
+				continue
+			}
+			if item.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	rows := make([][]interface{}, len(index))
+	ordered := make([]*rowScope, len(index))
+	for i, j := range index {
+		rows[i], ordered[i] = result.rows[j], scopes[j]
+	}
+	result.rows = rows
+	copy(scopes, ordered)
+	return nil
+}
+
+func (e *executor) limit(stmt *selectStmt, result *queryResult) error {
+	if stmt.offset != nil {
+		value, err := e.eval(stmt.offset, &rowScope{})
+		if err != nil {
+			return err
+		}
+		if offset, ok := value.(int64); ok {
+			if int(offset) >= len(result.rows) {
+				result.rows = nil
+			} else {
+				result.rows = result.rows[offset:]
+			}
+		}
+	}
+	if stmt.limit != nil {
+		value, err := e.eval(stmt.limit, &rowScope{})
+		if err != nil {
+			return err
+		}
+		if limit, ok := value.(int64); ok && int(limit) < len(result.rows) {
+			result.rows = result.rows[:limit]
+		}
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Изменение данных
+
+func (e *executor) insert(stmt *insertStmt) (*queryResult, error) {
+	table, err := e.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	columns := stmt.columns
+	if len(columns) == 0 {
+		for _, column := range table.columns {
+			columns = append(columns, column.name)
+		}
+	}
+
+	var inputs [][]interface{}
+	if stmt.query != nil {
+		selected, err := e.selectRows(stmt.query, nil)
+		if err != nil {
+			return nil, err
+		}
+		inputs = selected.rows
+	} else {
+		for _, exprs := range stmt.values {
+			var values []interface{}
+			for _, expr := range exprs {
+				value, err := e.eval(expr, &rowScope{})
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			}
+			inputs = append(inputs, values)
+		}
+	}
+
+	result := &queryResult{}
+	for _, values := range inputs {
+		if len(values) != len(columns) {
+			return nil, errors.New("число значений не совпадает с числом столбцов")
+		}
+		row := make([]interface{}, len(table.columns))
+		given := make([]bool, len(table.columns))
+		for i, name := range columns {
+			index := table.column(name)
+			if index < 0 {
+				return nil, fmt.Errorf("столбец %q таблицы %q не существует", name, table.name)
+			}
+			row[index], given[index] = values[i], true
+		}
+		for i, column := range table.columns {
+			if given[i] {
+				if id, ok := row[i].(int64); ok && column.autoIncrement && id > table.serial {
+					table.serial = id
+				}
+				continue
+			}
+			if column.autoIncrement {
+				table.serial++
+				row[i] = table.serial
+			} else {
+				row[i] = column.defaultValue
+			}
+		}
+
+		conflict, err := e.conflictingRow(table, row, -1, stmt.conflictOn)
+		if err != nil {
+			return nil, err
+		}
+		if conflict >= 0 {
+			if !stmt.conflict {
+				return nil, fmt.Errorf("duplicate key value violates unique constraint on %q", table.name)
+			}
+			if len(stmt.updates) == 0 {
+				continue
+			}
+			existing := table.rows[conflict]
+			scope := &rowScope{sources: []boundSource{
+				{name: table.name, table: table, columns: visibleColumns(table), values: tableRow(table, existing)},
+				{name: "excluded", table: table, columns: visibleColumns(table), values: tableRow(table, row)},
+			}}
+			updated, err := e.assign(table, existing, stmt.updates, scope)
+			if err != nil {
+				return nil, err
+			}
+			e.replaceRow(table, existing, updated)
+			row = existing
+		} else {
+			table.rows = append(table.rows, row)
+			e.logUndo(undoEntry{table: table, row: row, index: -1})
+		}
+		result.affected++
+		if err := e.returnRow(result, stmt.returning, table, row); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// conflictingRow возвращает номер строки, с которой row нарушает уникальный индекс, или -1.
+// Если указаны columns, проверяются только индексы по этим столбцам.
+func (e *executor) conflictingRow(table *memTable, row []interface{}, skip int, columns []string) (int, error) {
+	for _, index := range table.indexes {
+		if len(columns) > 0 && strings.Join(index.columns, ",") != strings.Join(columns, ",") {
+			continue
+		}
+		applies, err := e.indexApplies(table, index, row)
+		if err != nil {
+			return -1, err
+		}
+		if !applies {
+			continue
+		}
+		for i, other := range table.rows {
+			if i == skip {
+				continue
+			}
+			otherApplies, err := e.indexApplies(table, index, other)
+			if err != nil {
+				return -1, err
+			}
+			if otherApplies && sameKey(table, index, row, other) {
+				return i, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+// indexApplies сообщает, входит ли строка в индекс: NULL в ключе и условие частичного
+// индекса исключают строку, как в PostgreSQL
+func (e *executor) indexApplies(table *memTable, index memIndex, row []interface{}) (bool, error) {
+	for _, name := range index.columns {
+		if row[table.column(name)] == nil {
+			return false, nil
+		}
+	}
+	if index.where == nil {
+		return true, nil
+	}
+	scope := &rowScope{sources: []boundSource{{name: table.name, table: table, columns: visibleColumns(table), values: tableRow(table, row)}}}
+	return e.truth(index.where, scope)
+}
+
+func sameKey(table *memTable, index memIndex, a, b []interface{}) bool {
+	for _, name := range index.columns {
+		i := table.column(name)
+		if c, ok := compareValues(a[i], b[i]); !ok || c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// assign вычисляет новые значения столбцов по старой строке
+func (e *executor) assign(table *memTable, row []interface{}, sets []assignment, scope *rowScope) ([]interface{}, error) {
+	updated := append([]interface{}(nil), row...)
+	for _, set := range sets {
+		index := table.column(set.column)
+		if index < 0 {
+			return nil, fmt.Errorf("столбец %q таблицы %q не существует", set.column, table.name)
+		}
+		value, err := e.eval(set.expr, scope)
+		if err != nil {
+			return nil, err
+		}
+		updated[index] = value
+	}
+	return updated, nil
+}
+
+func (e *executor) returnRow(result *queryResult, returning []selectColumn, table *memTable, row []interface{}) error {
+	if len(returning) == 0 {
+		return nil
+	}
+	scope := &rowScope{sources: []boundSource{{name: table.name, table: table, columns: visibleColumns(table), values: tableRow(table, row)}}}
+	var columns []string
+	var values []interface{}
+	for _, column := range returning {
+		if _, ok := column.expr.(*starExpr); ok {
+			for i, c := range table.columns {
+				columns = append(columns, c.name)
+				values = append(values, row[i])
+			}
+			continue
+		}
+		value, err := e.eval(column.expr, scope)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, columnName(column))
+		values = append(values, value)
+	}
+	result.columns = columns
+	result.rows = append(result.rows, values)
+	return nil
+}
+
+// matchingRows возвращает номера строк таблицы, удовлетворяющих условию
+func (e *executor) matchingRows(table *memTable, alias string, where sqlExpr) ([]int, error) {
+	if alias == "" {
+		alias = table.name
+	}
+	var matched []int
+	for i, row := range table.rows {
+		if where != nil {
+			scope := &rowScope{sources: []boundSource{{name: alias, table: table, columns: visibleColumns(table), values: tableRow(table, row)}}}
+			ok, err := e.truth(where, scope)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		matched = append(matched, i)
+	}
+	return matched, nil
+}
+
+func (e *executor) update(stmt *updateStmt) (*queryResult, error) {
+	table, err := e.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := e.matchingRows(table, stmt.alias, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	alias := stmt.alias
+	if alias == "" {
+		alias = table.name
+	}
+
+	// Все присваивания вычисляются по исходным значениям строк
+	updated := make([][]interface{}, len(matched))
+	for i, index := range matched {
+		row := table.rows[index]
+		scope := &rowScope{sources: []boundSource{{name: alias, table: table, columns: visibleColumns(table), values: tableRow(table, row)}}}
+		if updated[i], err = e.assign(table, row, stmt.sets, scope); err != nil {
+			return nil, err
+		}
+	}
+	previous := make([][]interface{}, len(matched))
+	for i, index := range matched {
+		previous[i] = append([]interface{}(nil), table.rows[index]...)
+		e.replaceRow(table, table.rows[index], updated[i])
+	}
+	for _, index := range matched {
+		conflict, err := e.conflictingRow(table, table.rows[index], index, nil)
+		if err == nil && conflict >= 0 {
+			err = fmt.Errorf("duplicate key value violates unique constraint on %q", table.name)
+		}
+		if err != nil {
+			// Ошибочный запрос не меняет данных и вне транзакции
+			for i, index := range matched {
+				copy(table.rows[index], previous[i])
+			}
+			return nil, err
+		}
+	}
+
+	result := &queryResult{affected: int64(len(matched))}
+	for _, index := range matched {
+		if err := e.returnRow(result, stmt.returning, table, table.rows[index]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (e *executor) delete(stmt *deleteStmt) (*queryResult, error) {
+	table, err := e.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := e.matchingRows(table, stmt.alias, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	result := &queryResult{affected: int64(len(matched))}
+	deleted := map[int]bool{}
+	for _, index := range matched {
+		deleted[index] = true
+		if err := e.returnRow(result, stmt.returning, table, table.rows[index]); err != nil {
+			return nil, err
+		}
+	}
+	// Строки восстанавливаются при откате в обратном порядке, поэтому их места верны
+	for _, index := range matched {
+		e.logUndo(undoEntry{table: table, row: table.rows[index], index: index})
+	}
+	kept := table.rows[:0:0]
+	for i, row := range table.rows {
+		if !deleted[i] {
+			kept = append(kept, row)
+		}
+	}
+	table.rows = kept
+	return result, nil
+}
+
+// ---------------------------------------------------------------------------
+// Выражения
+
+// truth вычисляет условие; NULL, как в SQL, не выполняет условие
+func (e *executor) truth(expr sqlExpr, scope *rowScope) (bool, error) {
+	value, err := e.eval(expr, scope)
+	if err != nil {
+		return false, err
+	}
+	b, _ := value.(bool)
+	return b, nil
+}
+
+func (e *executor) lookup(column *columnExpr, scope *rowScope) (interface{}, error) {
+	for s := scope; s != nil; s = s.parent {
+		for _, source := range s.sources {
+			if column.table != "" && source.name != column.table {
+				continue
+			}
+			for i, name := range source.columns {
+				if name == column.name {
+					return source.values[i], nil
+				}
+			}
+			if column.table != "" {
+				return nil, fmt.Errorf("столбец %s.%s не существует", column.table, column.name)
+			}
+		}
+		if column.table == "" && s.output != nil {
+			if value, ok := s.output[column.name]; ok {
+				return value, nil
+			}
+		}
+	}
+	if column.table == "excluded" {
+		return nil, fmt.Errorf("столбец excluded.%s не существует", column.name)
+	}
+	return nil, fmt.Errorf("столбец %q не существует", qualifiedName(column))
+}
+
+func qualifiedName(column *columnExpr) string {
+	if column.table == "" {
+		return column.name
+	}
+	return column.table + "." + column.name
+}
+
+func (e *executor) eval(expr sqlExpr, scope *rowScope) (interface{}, error) {
+	switch expr := expr.(type) {
+	case *litExpr:
+		return expr.value, nil
+	case *paramExpr:
+		if expr.index < 0 || expr.index >= len(e.args) {
+			return nil, fmt.Errorf("нет значения параметра $%d", expr.index+1)
+		}
+		return e.args[expr.index], nil
+	case *columnExpr:
+		return e.lookup(expr, scope)
+	case *unaryExpr:
+		value, err := e.eval(expr.x, scope)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		if expr.op == "NOT" {
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("NOT применяется к %T", value)
+			}
+			return !b, nil
+		}
+		return arithmetic("-", int64(0), value)
+	case *binaryExpr:
+		return e.evalBinary(expr, scope)
+	case *isExpr:
+		value, err := e.eval(expr.x, scope)
+		if err != nil {
+			return nil, err
+		}
+		if expr.distinct == nil {
+			return (value == nil) != expr.not, nil
+		}
+		other, err := e.eval(expr.distinct, scope)
+		if err != nil {
+			return nil, err
+		}
+		same := value == nil && other == nil
+		if value != nil && other != nil {
+			c, ok := compareValues(value, other)
+			same = ok && c == 0
+		}
+		return !same != expr.not, nil
+	case *inExpr:
+		return e.evalIn(expr, scope)
+	case *likeExpr:
+		value, err := e.eval(expr.x, scope)
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := e.eval(expr.pattern, scope)
+		if err != nil || value == nil || pattern == nil {
+			return nil, err
+		}
+		text, pat := toText(value), toText(pattern)
+		if expr.ignoreCase {
+			text, pat = strings.ToLower(text), strings.ToLower(pat)
+		}
+		return likeMatch([]rune(text), []rune(pat)) != expr.not, nil
+	case *betweenExpr:
+		value, err := e.eval(expr.x, scope)
+		if err != nil {
+			return nil, err
+		}
+		low, err := e.eval(expr.low, scope)
+		if err != nil {
+			return nil, err
+		}
+		high, err := e.eval(expr.high, scope)
+		if err != nil {
+			return nil, err
+		}
+		c1, ok1 := compareValues(value, low)
+		c2, ok2 := compareValues(value, high)
+		if !ok1 || !ok2 {
+			return nil, nil
+		}
+		return (c1 >= 0 && c2 <= 0) != expr.not, nil
+	case *existsExpr:
+		result, err := e.selectRows(expr.sub, scope)
+		if err != nil {
+			return nil, err
+		}
+		return len(result.rows) > 0, nil
+	case *subqueryExpr:
+		result, err := e.selectRows(expr.sub, scope)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.rows) == 0 {
+			return nil, nil
+		}
+		if len(result.rows) > 1 {
+			return nil, errors.New("подзапрос вернул больше одной строки")
+		}
+		return result.rows[0][0], nil
+	case *funcExpr:
+		return e.evalFunc(expr, scope)
+	case *caseExpr:
+		var operand interface{}
+		if expr.operand != nil {
+			var err error
+			if operand, err = e.eval(expr.operand, scope); err != nil {
+				return nil, err
+			}
+		}
+		for _, when := range expr.whens {
+			value, err := e.eval(when[0], scope)
+			if err != nil {
+				return nil, err
+			}
+			matched := false
+			if expr.operand != nil {
+				c, ok := compareValues(operand, value)
+				matched = ok && c == 0
+			} else {
+				matched, _ = value.(bool)
+			}
+			if matched {
+				return e.eval(when[1], scope)
+			}
+		}
+		if expr.orElse != nil {
+			return e.eval(expr.orElse, scope)
+		}
+		return nil, nil
+	case *starExpr:
+		return nil, errors.New("* вне списка столбцов")
+	}
+	return nil, fmt.Errorf("неподдерживаемое выражение %T", expr)
+}
+
+func (e *executor) evalBinary(expr *binaryExpr, scope *rowScope) (interface{}, error) {
+	left, err := e.eval(expr.l, scope)
+	if err != nil {
+		return nil, err
+	}
+	switch expr.op {
+	case "AND", "OR":
+		// Трехзначная логика SQL: NULL означает неизвестное значение
+		l, lok := left.(bool)
+		if lok && (l == (expr.op == "OR")) {
+			return l, nil
+		}
+		right, err := e.eval(expr.r, scope)
+		if err != nil {
+			return nil, err
+		}
+		r, rok := right.(bool)
+		if rok && (r == (expr.op == "OR")) {
+			return r, nil
+		}
+		if !lok || !rok {
+			return nil, nil
+		}
+		return r, nil
+	}
+
+	right, err := e.eval(expr.r, scope)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	switch expr.op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		c, ok := compareValues(left, right)
+		if !ok {
+			return nil, fmt.Errorf("нельзя сравнить %T и %T", left, right)
+		}
+		switch expr.op {
+		case "=":
+			return c == 0, nil
+		case "<>":
+			return c != 0, nil
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	case "||":
+		if lq, ok := left.(*tsQuery); ok {
+			return &tsQuery{op: "|", left: lq, right: right.(*tsQuery)}, nil
+		}
+		return toText(left) + toText(right), nil
+	case "&&":
+		lq, lok := left.(*tsQuery)
+		rq, rok := right.(*tsQuery)
+		if !lok || !rok {
+			return nil, errors.New("&& поддерживается только для tsquery")
+		}
+		return &tsQuery{op: "&", left: lq, right: rq}, nil
+	case "@@":
+		vector, vok := left.(tsVector)
+		query, qok := right.(*tsQuery)
+		if !vok || !qok {
+			return nil, errors.New("@@ поддерживается только для tsvector и tsquery")
+		}
+		return query.matches(vector.words()), nil
+	}
+	return arithmetic(expr.op, left, right)
+}
+
+func (e *executor) evalIn(expr *inExpr, scope *rowScope) (interface{}, error) {
+	value, err := e.eval(expr.x, scope)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []interface{}
+	if expr.sub != nil {
+		result, err := e.selectRows(expr.sub, scope)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range result.rows {
+			candidates = append(candidates, row[0])
+		}
+	} else {
+		for _, item := range expr.list {
+			candidate, err := e.eval(item, scope)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	if value == nil {
+		return nil, nil
+	}
+	sawNull := false
+	for _, candidate := range candidates {
+		if candidate == nil {
+			sawNull = true
+			continue
+		}
+		if c, ok := compareValues(value, candidate); ok && c == 0 {
+			return !expr.not, nil
+		}
+	}
+	if sawNull {
+		return nil, nil
+	}
+	return expr.not, nil
+}
+
+func (e *executor) evalFunc(expr *funcExpr, scope *rowScope) (interface{}, error) {
+	if aggregateFuncs[expr.name] {
+		return e.evalAggregate(expr, scope)
+	}
+
+	args := make([]interface{}, len(expr.args))
+	for i, arg := range expr.args {
+		value, err := e.eval(arg, scope)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	switch expr.name {
+	case "now", "current_timestamp":
+		return time.Now().UTC(), nil
+	case "coalesce":
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("функция %s без аргументов не поддерживается", expr.name)
+	}
+	if args[0] == nil && expr.name != "ts_headline" {
+		return nil, nil
+	}
+
+	switch expr.name {
+	case "lower":
+		return strings.ToLower(toText(args[0])), nil
+	case "upper":
+		return strings.ToUpper(toText(args[0])), nil
+	case "length", "char_length":
+		return int64(len([]rune(toText(args[0])))), nil
+	case "left":
+		runes := []rune(toText(args[0]))
+		n, _ := args[1].(int64)
+		if int(n) < len(runes) {
+			runes = runes[:n]
+		}
+		return string(runes), nil
+	case "plainto_tsquery", "phraseto_tsquery", "to_tsquery":
+		text := toText(args[len(args)-1])
+		return &tsQuery{terms: tsWords(text), phrase: expr.name == "phraseto_tsquery"}, nil
+	case "numnode":
+		return int64(args[0].(*tsQuery).size()), nil
+	case "ts_rank":
+		vector, query := args[0].(tsVector), args[1].(*tsQuery)
+		return query.rank(vector), nil
+	case "ts_headline":
+		text, query := toText(args[1]), args[2].(*tsQuery)
+		options := ""
+		if len(args) > 3 {
+			options = toText(args[3])
+		}
+		return query.headline(text, options), nil
+	case "word_similarity":
+		return wordSimilarity(toText(args[0]), toText(args[1])), nil
+	case "similarity":
+		return trigramSimilarity(toText(args[0]), toText(args[1])), nil
+	}
+	return nil, fmt.Errorf("функция %s не поддерживается", expr.name)
+}
+
+func (e *executor) evalAggregate(expr *funcExpr, scope *rowScope) (interface{}, error) {
+	if scope.group == nil && len(scope.sources) > 0 {
+		return nil, fmt.Errorf("агрегат %s вне группировки", expr.name)
+	}
+	var values []interface{}
+	seen := map[string]bool{}
+	for _, member := range scope.group {
+		if expr.star {
+			values = append(values, int64(1))
+			continue
+		}
+		value, err := e.eval(expr.args[0], member)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		if expr.distinct {
+			key := rowKey([]interface{}{value})
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		values = append(values, value)
+	}
+
+	switch expr.name {
+	case "count":
+		return int64(len(values)), nil
+	case "max", "min":
+		var best interface{}
+		for _, value := range values {
+			if best == nil {
+				best = value
+				continue
+			}
+			c, _ := compareValues(value, best)
+			if (expr.name == "max" && c > 0) || (expr.name == "min" && c < 0) {
+				best = value
+			}
+		}
+		return best, nil
+	case "sum", "avg":
+		if len(values) == 0 {
+			return nil, nil
+		}
+		var sum interface{} = int64(0)
+		for _, value := range values {
+			var err error
+			if sum, err = arithmetic("+", sum, value); err != nil {
+				return nil, err
+			}
+		}
+		if expr.name == "avg" {
+			return toFloat(sum) / float64(len(values)), nil
+		}
+		return sum, nil
+	case "bool_or", "bool_and":
+		result := expr.name == "bool_and"
+		for _, value := range values {
+			b, _ := value.(bool)
+			if expr.name == "bool_or" {
+				result = result || b
+			} else {
+				result = result && b
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("агрегат %s не поддерживается", expr.name)
+}
+
+// compareValues сравнивает значения одного рода; ok равен false для несравнимых значений
+func compareValues(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case int64, float64:
+		switch b.(type) {
+		case int64, float64:
+			if xi, ok := x.(int64); ok {
+				if yi, ok := b.(int64); ok {
+					return compareOrdered(xi, yi), true
+				}
+			}
+			return compareOrdered(toFloat(a), toFloat(b)), true
+		case string:
+			if f, err := strconv.ParseFloat(b.(string), 64); err == nil {
+				return compareOrdered(toFloat(a), f), true
+			}
+		}
+	case string:
+		switch y := b.(type) {
+		case string:
+			return strings.Compare(x, y), true
+		case []byte:
+			return strings.Compare(x, string(y)), true
+		case int64, float64:
+			c, ok := compareValues(b, a)
+			return -c, ok
+		}
+	case []byte:
+		return compareValues(string(x), b)
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case !x:
+				return -1, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), true
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+func toText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func arithmetic(op string, a, b interface{}) (interface{}, error) {
+	if t, ok := a.(time.Time); ok {
+		return nil, fmt.Errorf("арифметика над временем %v не поддерживается", t)
+	}
+	x, xok := a.(int64)
+	y, yok := b.(int64)
+	if xok && yok {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/":
+			if y == 0 {
+				return nil, errors.New("деление на ноль")
+			}
+			return x / y, nil
+		case "%":
+			if y == 0 {
+				return nil, errors.New("деление на ноль")
+			}
+			return x % y, nil
+		}
+	}
+	fx, fy := toFloat(a), toFloat(b)
+	if math.IsNaN(fx) || math.IsNaN(fy) {
+		return nil, fmt.Errorf("оператор %s не применим к %T и %T", op, a, b)
+	}
+	switch op {
+	case "+":
+		return fx + fy, nil
+	case "-":
+		return fx - fy, nil
+	case "*":
+		return fx * fy, nil
+	case "/":
+		return fx / fy, nil
+	}
+	return nil, fmt.Errorf("неподдерживаемый оператор %s", op)
+}
+
+// likeMatch сопоставляет текст с шаблоном LIKE; обратная косая черта экранирует % и _
+func likeMatch(text, pattern []rune) bool {
+	if len(pattern) == 0 {
+		return len(text) == 0
+	}
+	switch pattern[0] {
+	case '%':
+		for i := 0; i <= len(text); i++ {
+			if likeMatch(text[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	case '_':
+		return len(text) > 0 && likeMatch(text[1:], pattern[1:])
+	case '\\':
+		if len(pattern) > 1 {
+			pattern = pattern[1:]
+		}
+	}
+	return len(text) > 0 && text[0] == pattern[0] && likeMatch(text[1:], pattern[1:])
+}
+
+// ---------------------------------------------------------------------------
+// Упрощенный полнотекстовый поиск: слова сравниваются по общей основе без учета регистра,
+// совпадения в заголовке весят больше совпадений в содержимом
+
+// tsVector — значение столбца notes.search_vector
+type tsVector struct {
+	title, content string
+}
+
+func (v tsVector) words() []string {
+	return append(tsWords(v.title), tsWords(v.content)...)
+}
+
+// tsQuery — дерево запроса: слова (фраза, если phrase) или операция & и | над поддеревьями
+type tsQuery struct {
+	op          string
+	left, right *tsQuery
+	terms       []string
+	phrase      bool
+}
+
+func (q *tsQuery) String() string {
+	if q.op != "" {
+		return "(" + q.left.String() + " " + q.op + " " + q.right.String() + ")"
+	}
+	return strings.Join(q.terms, " & ")
+}
+
+func (q *tsQuery) size() int {
+	if q.op != "" {
+		return q.left.size() + q.right.size()
+	}
+	return len(q.terms)
+}
+
+func (q *tsQuery) matches(words []string) bool {
+	switch q.op {
+	case "&":
+		return q.left.matches(words) && q.right.matches(words)
+	case "|":
+		return q.left.matches(words) || q.right.matches(words)
+	}
+	if q.phrase {
+		for start := range words {
+			if start+len(q.terms) > len(words) {
+				break
+			}
+			found := true
+			for i, term := range q.terms {
+				if !sameStem(words[start+i], term) {
+					found = false
+					break
+				}
+			}
+			if found {
+				return true
+			}
+		}
+		return len(q.terms) == 0
+	}
+	for _, term := range q.terms {
+		found := false
+		for _, word := range words {
+			if sameStem(word, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// allTerms возвращает все слова запроса
+func (q *tsQuery) allTerms() []string {
+	if q.op != "" {
+		return append(q.left.allTerms(), q.right.allTerms()...)
+	}
+	return q.terms
+}
+
+func (q *tsQuery) rank(vector tsVector) float64 {
+	rank := 0.0
+	for _, term := range q.allTerms() {
+		for _, word := range tsWords(vector.title) {
+			if sameStem(word, term) {
+				rank += 1
+			}
+		}
+		for _, word := range tsWords(vector.content) {
+			if sameStem(word, term) {
+				rank += 0.1
+			}
+		}
+	}
+	return rank
+}
+
+// headline обрамляет совпавшие слова текста разделителями StartSel и StopSel из options
+func (q *tsQuery) headline(text, options string) string {
+	start, stop := "<b>", "</b>"
+	for _, option := range strings.Split(options, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(option), "=")
+		switch name {
+		case "StartSel":
+			start = value
+		case "StopSel":
+			stop = value
+		}
+	}
+
+	terms := q.allTerms()
+	var out strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		matched := false
+		for _, term := range terms {
+			if sameStem(normalizeWord(word), term) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			out.WriteString(start + word + stop)
+		} else {
+			out.WriteString(word)
+		}
+		i = j
+	}
+	return out.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func normalizeWord(word string) string {
+	return strings.ReplaceAll(strings.ToLower(word), "ё", "е")
+}
+
+func tsWords(text string) []string {
+	return strings.FieldsFunc(normalizeWord(text), func(r rune) bool { return !isWordRune(r) })
+}
+
+// sameStem считает слова формами одного слова, если у них общая основа: совпадение
+// без последних двух букв, но не короче трех букв
+func sameStem(word, term string) bool {
+	w, t := []rune(word), []rune(term)
+	stem := len(t) - 2
+	if stem < 3 {
+		stem = len(t)
+	}
+	if len(w) < stem {
+		return false
+	}
+	return string(w[:stem]) == string(t[:stem])
+}
+
+// trigrams возвращает множество триграмм слова, как в pg_trgm
+func trigrams(word string) map[string]bool {
+	padded := []rune("  " + word + " ")
+	set := map[string]bool{}
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = true
+	}
+	return set
+}
+
+func trigramSimilarity(a, b string) float64 {
+	x, y := trigrams(strings.ToLower(a)), trigrams(strings.ToLower(b))
+	common := 0
+	for t := range x {
+		if y[t] {
+			common++
+		}
+	}
+	total := len(x) + len(y) - common
+	if total == 0 {
+		return 0
+	}
+	return float64(common) / float64(total)
+}
+
+// wordSimilarity — наибольшее сходство a с одним из слов b
+func wordSimilarity(a, b string) float64 {
+	best := 0.0
+	for _, word := range tsWords(b) {
+		if s := trigramSimilarity(a, word); s > best {
+			best = s
+		}
+	}
+	return best
+}